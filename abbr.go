@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	gohtml "html"
+	"regexp"
+	"sort"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// abbrConfig configures the expansion of abbreviations on pages.
+type abbrConfig struct {
+	// Terms lists the abbreviations with their expansions.  It is a list
+	// rather than a map since config keys are not case sensitive.
+	Terms []abbreviation `mapstructure:"Terms"`
+	// All wraps every occurrence of each abbreviation instead of only the
+	// first on each page.
+	All bool `mapstructure:"All"`
+}
+
+// abbreviation is an abbreviation, such as HTML, and its expansion, the
+// title of its abbr elements.
+type abbreviation struct {
+	Abbr  string `mapstructure:"Abbr"`
+	Title string `mapstructure:"Title"`
+}
+
+func (c abbrConfig) validate() error {
+	seen := map[string]bool{}
+	for _, term := range c.Terms {
+		if term.Abbr == "" || term.Title == "" {
+			return fmt.Errorf("abbreviation %q requires an abbreviation and a title", term.Abbr)
+		}
+		if seen[term.Abbr] {
+			return fmt.Errorf("duplicate abbreviation %q", term.Abbr)
+		}
+		seen[term.Abbr] = true
+	}
+	return nil
+}
+
+// abbrPattern returns the regular expression matching an abbreviation as a
+// whole word.  Word boundaries are only required next to letters and digits,
+// so abbreviations like C++ match too.
+func abbrPattern(abbr string) *regexp.Regexp {
+	pattern := regexp.QuoteMeta(abbr)
+	first, _ := utf8.DecodeRuneInString(abbr)
+	last, _ := utf8.DecodeLastRuneInString(abbr)
+	if unicode.IsLetter(first) || unicode.IsDigit(first) {
+		pattern = `\b` + pattern
+	}
+	if unicode.IsLetter(last) || unicode.IsDigit(last) {
+		pattern += `\b`
+	}
+	return regexp.MustCompile(pattern)
+}
+
+// inAbbr reports whether a text node follows the opening tag of an abbr
+// element, written on the page or added by glossary linking.
+func inAbbr(text *ast.Text) bool {
+	prev := ast.GetPrevNode(text)
+	span, ok := prev.(*ast.HTMLSpan)
+	return ok && bytes.Contains(span.Literal, []byte("<abbr"))
+}
+
+// expandAbbreviations wraps the occurrences of the configured abbreviations
+// on a page in abbr elements titled with their expansions: the first of each
+// abbreviation, or all of them.  Longer abbreviations take precedence over
+// the ones they contain.
+func expandAbbreviations(doc ast.Node, conf abbrConfig) {
+	terms := append([]abbreviation(nil), conf.Terms...)
+	sort.SliceStable(terms, func(i, j int) bool { return len(terms[i].Abbr) > len(terms[j].Abbr) })
+	// inserted abbreviations are not searched again for shorter ones
+	expanded := map[ast.Node]bool{}
+	for _, term := range terms {
+		termRe := abbrPattern(term.Abbr)
+		var texts []*ast.Text
+		visitor := func(node ast.Node, entering bool) ast.WalkStatus {
+			text, ok := node.(*ast.Text)
+			if !ok || !entering || expanded[text] || inUnlinkableNode(text) || inAbbr(text) {
+				return ast.GoToNext
+			}
+			if termRe.Match(text.Literal) {
+				texts = append(texts, text)
+				if !conf.All {
+					return ast.Terminate
+				}
+			}
+			return ast.GoToNext
+		}
+		ast.WalkFunc(doc, visitor)
+
+		// modify the tree after walking it
+		open := []byte(fmt.Sprintf(`<abbr title="%s">`, gohtml.EscapeString(term.Title)))
+		for _, text := range texts {
+			lit := text.Literal
+			locs := termRe.FindAllIndex(lit, -1)
+			if !conf.All {
+				locs = locs[:1]
+			}
+			var nodes []ast.Node
+			last := 0
+			for _, loc := range locs {
+				abbr := &ast.Text{Leaf: ast.Leaf{Literal: lit[loc[0]:loc[1]]}}
+				expanded[abbr] = true
+				nodes = append(nodes,
+					&ast.Text{Leaf: ast.Leaf{Literal: lit[last:loc[0]]}},
+					&ast.HTMLSpan{Leaf: ast.Leaf{Literal: open}},
+					abbr,
+					&ast.HTMLSpan{Leaf: ast.Leaf{Literal: []byte("</abbr>")}})
+				last = loc[1]
+			}
+			nodes = append(nodes, &ast.Text{Leaf: ast.Leaf{Literal: lit[last:]}})
+			replaceNode(text, nodes...)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// archiveDir is the directory of the archive pages in the destination.
+const archiveDir = "archive"
+
+// archiveURL returns the URL of an archive page relative to the site root:
+// the landing page for no parts, or the page of a year or month.
+func archiveURL(parts ...string) string {
+	return path.Join(append(append([]string{archiveDir}, parts...), "index.html")...)
+}
+
+// archiveLink returns the link from an archive page to a page beneath it.
+func (c siteConfig) archiveLink(from, to string) string {
+	return c.pageLink(".", strings.TrimPrefix(to, path.Dir(from)+"/"))
+}
+
+// archiveYear holds the posts of a year by month.
+type archiveYear struct {
+	year   int
+	months map[time.Month]postSet
+}
+
+// sortedMonths returns the months of the year with posts, latest first.
+func (ay archiveYear) sortedMonths() []time.Month {
+	months := make([]time.Month, 0, len(ay.months))
+	for month := range ay.months {
+		months = append(months, month)
+	}
+	sort.Slice(months, func(i, j int) bool { return months[i] > months[j] })
+	return months
+}
+
+// collectArchive groups the dated posts by year and month, latest first.
+// Posts are sorted by date within each month.
+func collectArchive(posts postSet) []archiveYear {
+	byYear := map[int]*archiveYear{}
+	for _, p := range posts.SortedByDate() {
+		date := p.date()
+		if date.IsZero() {
+			continue
+		}
+		ay, ok := byYear[date.Year()]
+		if !ok {
+			ay = &archiveYear{year: date.Year(), months: map[time.Month]postSet{}}
+			byYear[date.Year()] = ay
+		}
+		ay.months[date.Month()] = append(ay.months[date.Month()], p)
+	}
+	years := make([]archiveYear, 0, len(byYear))
+	for _, ay := range byYear {
+		years = append(years, *ay)
+	}
+	sort.Slice(years, func(i, j int) bool { return years[i].year > years[j].year })
+	return years
+}
+
+// renderArchivePages generates a page for each year and month with posts
+// under the archive directory, and a landing page listing the years and
+// months.
+func renderArchivePages(posts postSet, data templateData, conf siteConfig) error {
+	if !conf.Archives {
+		return nil
+	}
+	years := collectArchive(posts)
+	if len(years) == 0 {
+		return nil
+	}
+	fmt.Printf(":: Generating archive of %d year%s\n", len(years), plural(len(years)))
+	templateFile := conf.listTemplate()
+	writeListing := func(url, bodystr string) error {
+		outpath := filepath.Join(conf.DestinationPath, filepath.FromSlash(url))
+		if err := os.MkdirAll(filepath.Dir(outpath), 0777); err != nil {
+			return fmt.Errorf("creating path %q: %w", filepath.Dir(outpath), err)
+		}
+		fmt.Printf("   Saving archive page: %s\n", outpath)
+		data.RelRoot = relRootOf(url)
+		data.Permalink = conf.absoluteURL(url)
+		// each listing page gets its own renderer, which keeps heading IDs
+		// the same on every page
+		data.Body = template.HTML(renderBody(parseMD([]byte(bodystr)), newPageRenderer(conf), conf))
+		htmlData, err := makeHTML(data, templateFile, conf)
+		if err != nil {
+			return fmt.Errorf("making html for archive page %q: %w", outpath, err)
+		}
+		if err := os.WriteFile(outpath, htmlData, 0666); err != nil {
+			return fmt.Errorf("writing archive page %q: %w", outpath, err)
+		}
+		return nil
+	}
+
+	// writePages writes the pages of a paginated listing, whose bodies body
+	// renders from the posts of each page
+	writePages := func(url string, posts postSet, body func(posts postSet) string) error {
+		pages := paginate(posts, conf.Pagination.PageSize)
+		for idx, posts := range pages {
+			data.Pagination, data.Canonical = listingPagination(url, idx+1, len(pages), conf)
+			if err := writeListing(paginatedURL(url, idx+1), body(posts)+data.Pagination.markdown()); err != nil {
+				return err
+			}
+		}
+		data.Pagination, data.Canonical = pagination{}, ""
+		return nil
+	}
+
+	landing := "# Archive\n\n"
+	for _, ay := range years {
+		year := fmt.Sprint(ay.year)
+		yearURL := archiveURL(year)
+		var yearPosts postSet
+		var monthLinks string
+		for _, month := range ay.sortedMonths() {
+			monthPosts := ay.months[month]
+			yearPosts = append(yearPosts, monthPosts...)
+			monthURL := archiveURL(year, fmt.Sprintf("%02d", month))
+			err := writePages(monthURL, monthPosts, func(posts postSet) string {
+				return fmt.Sprintf("# Posts from %s %s\n\n%s", month, year, postListMarkdown(posts, relRootOf(monthURL), conf))
+			})
+			if err != nil {
+				return err
+			}
+			if monthLinks != "" {
+				monthLinks += ", "
+			}
+			monthLinks += fmt.Sprintf("[%s](%s) (%d)", month.String()[:3], conf.archiveLink(archiveURL(), monthURL), len(monthPosts))
+		}
+		err := writePages(yearURL, yearPosts, func(posts postSet) string {
+			body := fmt.Sprintf("# Posts from %s\n\n", year)
+			// the posts of the page are grouped by month, and a month can
+			// continue on the next page
+			for start := 0; start < len(posts); {
+				month := posts[start].date().Month()
+				end := start
+				for end < len(posts) && posts[end].date().Month() == month {
+					end++
+				}
+				monthURL := archiveURL(year, fmt.Sprintf("%02d", month))
+				body += fmt.Sprintf("## [%s %s](%s) {#%s}\n\n%s\n", month, year, conf.archiveLink(yearURL, monthURL), strings.ToLower(month.String()), postListMarkdown(posts[start:end], relRootOf(yearURL), conf))
+				start = end
+			}
+			return body
+		})
+		if err != nil {
+			return err
+		}
+		n := len(yearPosts)
+		landing += fmt.Sprintf("- [%s](%s) (%d post%s): %s\n", year, conf.archiveLink(archiveURL(), yearURL), n, plural(n), monthLinks)
+	}
+	return writeListing(archiveURL(), landing)
+}
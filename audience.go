@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// audienceConfig configures a partial site built next to the full site, with
+// only the pages meant for an audience.
+type audienceConfig struct {
+	// Name is the audience that pages list in the audiences field of their
+	// front matter.
+	Name string `mapstructure:"Name"`
+	// DestinationPath is the output directory of the partial site.
+	DestinationPath string `mapstructure:"DestinationPath"`
+	// BaseURL replaces the BaseURL of the config for the partial site.
+	// Empty keeps the BaseURL of the config.
+	BaseURL string `mapstructure:"BaseURL"`
+}
+
+func validateAudiences(audiences []audienceConfig, conf siteConfig) error {
+	seen := map[string]bool{absPath(conf.DestinationPath): true}
+	names := map[string]bool{}
+	for _, audience := range audiences {
+		if audience.Name == "" || strings.ContainsAny(audience.Name, `/\`) {
+			return fmt.Errorf("invalid audience name %q", audience.Name)
+		}
+		if names[audience.Name] {
+			return fmt.Errorf("duplicate audience %q", audience.Name)
+		}
+		names[audience.Name] = true
+		if audience.DestinationPath == "" {
+			return fmt.Errorf("audience %q has no destination path", audience.Name)
+		}
+		dest := absPath(audience.DestinationPath)
+		if seen[dest] {
+			return fmt.Errorf("audience %q: destination %q is already used by the site or another audience", audience.Name, audience.DestinationPath)
+		}
+		seen[dest] = true
+	}
+	return nil
+}
+
+// forAudience returns the config of the partial site of an audience.
+func forAudience(conf siteConfig, audience audienceConfig) siteConfig {
+	conf.audience = audience.Name
+	conf.DestinationPath = audience.DestinationPath
+	if audience.BaseURL != "" {
+		conf.BaseURL = audience.BaseURL
+	}
+	return conf
+}
+
+// excludeAudiences separates the pages that are not meant for the audience
+// of the config from the list of sources.  Pages without audiences are meant
+// for everyone, and the full site, without an audience, has all pages.
+func excludeAudiences(pagesmd []string, conf siteConfig) (included, excluded []string, err error) {
+	if conf.audience == "" {
+		return pagesmd, nil, nil
+	}
+	included = make([]string, 0, len(pagesmd))
+	for _, fname := range pagesmd {
+		pagemd, _, err := readSource(fname)
+		if err != nil {
+			return nil, nil, err
+		}
+		front, _, err := pageFrontMatter(fname, pagemd, conf)
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading file %q: %w", fname, err)
+		}
+		if len(front.Audiences) > 0 && !slices.Contains(front.Audiences, conf.audience) {
+			excluded = append(excluded, fname)
+			continue
+		}
+		included = append(included, fname)
+	}
+	return included, excluded, nil
+}
+
+// buildAudiences builds the partial site of each audience of the config, each
+// under the lock of its destination.
+func buildAudiences(conf siteConfig, wait bool) error {
+	for _, audience := range conf.Audiences {
+		aconf := forAudience(conf, audience)
+		fmt.Printf(":: Building the site for %s into %s\n", audience.Name, aconf.DestinationPath)
+		lock, err := lockDestination(aconf, wait)
+		if err != nil {
+			return err
+		}
+		err = buildSite(&aconf)
+		lock.unlock()
+		if err != nil {
+			return fmt.Errorf("building the site for %s: %w", audience.Name, err)
+		}
+	}
+	return nil
+}
+
+// audienceStore keeps the build state of the partial site of an audience
+// apart from that of the full site.
+type audienceStore struct {
+	buildStore
+	audience string
+}
+
+func (s audienceStore) Load(name string) ([]byte, error) {
+	return s.buildStore.Load(s.audience + "." + name)
+}
+
+func (s audienceStore) Save(name string, data []byte) error {
+	return s.buildStore.Save(s.audience+"."+name, data)
+}
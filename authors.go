@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// authorConfig holds the details of an author of the site.  Authors are keyed
+// by the IDs used in the author field of the front matter or metadata of
+// posts.
+type authorConfig struct {
+	// Name is the display name of the author.  It defaults to the ID.
+	Name string `mapstructure:"Name"`
+	// Bio is markdown shown on the listing page of the author.
+	Bio string `mapstructure:"Bio"`
+	URL string `mapstructure:"URL"`
+	// Avatar is the URL of a picture of the author, absolute or relative
+	// to the site root.
+	Avatar string `mapstructure:"Avatar"`
+}
+
+// authorInfo is the author of a page as exposed to templates.
+type authorInfo struct {
+	ID     string
+	Name   string
+	Bio    string
+	URL    string
+	Avatar string
+	// Page is the URL of the listing page of the author relative to the
+	// site root.
+	Page string
+}
+
+// author returns the details of the author with the given ID.  IDs are
+// matched ignoring case, since config keys are case insensitive.  Authors
+// missing from the config only have a name.
+func (c siteConfig) author(id string) authorInfo {
+	if id == "" {
+		return authorInfo{}
+	}
+	details := c.Authors[strings.ToLower(id)]
+	info := authorInfo{
+		ID:     id,
+		Name:   details.Name,
+		Bio:    details.Bio,
+		URL:    details.URL,
+		Avatar: details.Avatar,
+		Page:   authorTaxonomy(c).termURL(id),
+	}
+	if info.Name == "" {
+		info.Name = id
+	}
+	return info
+}
+
+// authorTaxonomy returns the taxonomy of posts by author, with a listing page
+// per author under authors/ introduced by the details of the author from the
+// config.
+func authorTaxonomy(conf siteConfig) taxonomy {
+	return taxonomy{
+		dir:       "authors",
+		term:      "author",
+		title:     "Authors",
+		termTitle: "Posts by %s",
+		terms: func(p post) []string {
+			if p.author == "" {
+				return nil
+			}
+			return []string{p.author}
+		},
+		label: func(id string) string { return conf.author(id).Name },
+		intro: func(id string) string {
+			author := conf.author(id)
+			var intro string
+			if author.Avatar != "" {
+				avatar := author.Avatar
+				if !isRemoteURL(avatar) && !path.IsAbs(avatar) {
+					// author pages are one level below the site root
+					avatar = path.Join("..", avatar)
+				}
+				intro += fmt.Sprintf("![%s](%s)\n\n", author.Name, avatar)
+			}
+			if author.Bio != "" {
+				intro += strings.TrimSpace(author.Bio) + "\n\n"
+			}
+			if author.URL != "" {
+				intro += fmt.Sprintf("Website: <%s>\n\n", author.URL)
+			}
+			return intro
+		},
+	}
+}
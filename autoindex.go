@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/gomarkdown/markdown"
+	"github.com/gomarkdown/markdown/html"
+)
+
+// humanSize formats a file size in bytes using binary unit prefixes.
+func humanSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// escapeMDTableCell escapes characters that would break a markdown table
+// cell or be interpreted as inline markup.
+func escapeMDTableCell(s string) string {
+	replacer := strings.NewReplacer("|", `\|`, "[", `\[`, "]", `\]`, "*", `\*`, "_", `\_`, "`", "\\`")
+	return replacer.Replace(s)
+}
+
+// renderAutoIndex generates an index.html listing for a single directory.
+// srcdir is the directory under the resource path and dstdir the
+// corresponding directory under the destination path.
+func renderAutoIndex(srcdir, dstdir string, data templateData, renderer *html.Renderer, conf siteConfig) error {
+	entries, err := os.ReadDir(srcdir)
+	if err != nil {
+		return fmt.Errorf("reading directory %q: %w", srcdir, err)
+	}
+
+	dirname := filepath.ToSlash(srcdir)
+	bodystr := fmt.Sprintf("# Index of %s\n\n", escapeMDTableCell(dirname))
+	bodystr += "| Name | Size | Modified |\n|:-----|-----:|:---------|\n"
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return fmt.Errorf("reading file info for %q: %w", name, err)
+		}
+		link := url.PathEscape(name)
+		size := humanSize(info.Size())
+		if entry.IsDir() {
+			name += "/"
+			link += "/"
+			size = "-"
+		}
+		modified := info.ModTime().Format("02 Jan 2006 15:04")
+		bodystr += fmt.Sprintf("| [%s](%s) | %s | %s |\n", escapeMDTableCell(name), link, size, modified)
+	}
+
+	doc := parseMD([]byte(bodystr))
+	data.Body = template.HTML(markdown.Render(doc, renderer))
+	data.RelRoot, _ = filepath.Rel(dstdir, conf.DestinationPath)
+
+	htmlData, err := makeHTML(data, conf.PageTemplateFile, conf)
+	if err != nil {
+		return fmt.Errorf("making html for index of %q: %w", srcdir, err)
+	}
+	outpath := path.Join(dstdir, "index.html")
+	fmt.Printf("   %s -> %s\n", srcdir, outpath)
+	if err := os.WriteFile(outpath, htmlData, 0666); err != nil {
+		return fmt.Errorf("writing index page %q: %w", outpath, err)
+	}
+	return nil
+}
+
+// renderAutoIndexes generates directory listing pages for each of the
+// configured AutoIndexDirs.  The directories are relative to the resource path
+// and the listing is written as index.html in the corresponding directory
+// under the destination path, unless the source directory already contains
+// its own index.html.
+func renderAutoIndexes(conf siteConfig) error {
+	if len(conf.AutoIndexDirs) == 0 {
+		return nil
+	}
+	fmt.Println(":: Generating directory indexes")
+
+	data := newTemplateData(conf)
+	renderer := html.NewRenderer(html.RendererOptions{})
+	for _, dir := range conf.AutoIndexDirs {
+		srcdir := filepath.Join(conf.ResourcePath, dir)
+		if _, err := os.Stat(filepath.Join(srcdir, "index.html")); err == nil {
+			fmt.Printf("   %s has its own index.html; skipping\n", srcdir)
+			continue
+		}
+		dstdir := path.Join(conf.DestinationPath, srcdir)
+		if err := os.MkdirAll(dstdir, 0777); err != nil {
+			return fmt.Errorf("generating directory indexes: creating path %q: %w", dstdir, err)
+		}
+		if err := renderAutoIndex(srcdir, dstdir, data, renderer, conf); err != nil {
+			return fmt.Errorf("generating directory indexes: %w", err)
+		}
+	}
+	return nil
+}
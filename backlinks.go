@@ -0,0 +1,132 @@
+package main
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// pageLink is a link to a page, as exposed to templates.
+type pageLink struct {
+	Title string
+	// URL is relative to the page the link appears on.
+	URL string
+}
+
+// linkTarget returns the site URL of the page a link points to, or an empty
+// string for remote links and links outside the site.
+func linkTarget(dest, pageURL string) string {
+	if dest == "" || isRemoteURL(dest) || strings.HasPrefix(dest, "//") || strings.HasPrefix(dest, "mailto:") {
+		return ""
+	}
+	dest, _, _ = strings.Cut(dest, "#")
+	dest, _, _ = strings.Cut(dest, "?")
+	if dest == "" {
+		// link within the page
+		return ""
+	}
+	var target string
+	if path.IsAbs(dest) {
+		target = path.Clean(dest)[1:]
+	} else {
+		target = path.Join(path.Dir(pageURL), dest)
+	}
+	if strings.HasPrefix(target, "../") {
+		return ""
+	}
+	return target
+}
+
+// backlinks maps the URL of each page to the pages linking to it.
+type backlinks map[string][]pageLink
+
+// linkGraph holds the internal links between pages.  Pages are identified by
+// their URL relative to the site root.
+type linkGraph struct {
+	// urls lists the pages in source order.
+	urls   []string
+	titles map[string]string
+	// links maps each page to the pages it links to, in document order.
+	links map[string][]string
+}
+
+// collectLinks finds the internal links between pages, after resolving refs
+// and wikilinks.
+func collectLinks(pagesmd []string, pages pageIndex, conf siteConfig) (*linkGraph, error) {
+	graph := &linkGraph{titles: map[string]string{}, links: map[string][]string{}}
+	isPage := make(map[string]bool, len(pagesmd))
+	for _, fname := range pagesmd {
+		pageURL := siteURL(outputPath(fname, conf), conf)
+		graph.urls = append(graph.urls, pageURL)
+		isPage[pageURL] = true
+	}
+
+	for idx, fname := range pagesmd {
+		pageURL := graph.urls[idx]
+		pagemd, _, err := readSource(fname)
+		if err != nil {
+			return nil, err
+		}
+		pagemd, err = resolveLinks(pagemd, pageURL, pages)
+		if err != nil {
+			return nil, err
+		}
+		title := parsePost(pagemd).title
+		if title == "" {
+			title = titleFromFilename(fname)
+		}
+		graph.titles[pageURL] = title
+
+		seen := map[string]bool{}
+		visitor := func(node ast.Node, entering bool) ast.WalkStatus {
+			link, ok := node.(*ast.Link)
+			if !ok || !entering {
+				return ast.GoToNext
+			}
+			target := linkTarget(string(link.Destination), pages.sourceURL(pageURL))
+			if pretty, ok := pages.pretty[target]; ok {
+				target = pretty
+			}
+			if isPage[target] && target != pageURL && !seen[target] {
+				seen[target] = true
+				graph.links[pageURL] = append(graph.links[pageURL], target)
+			}
+			return ast.GoToNext
+		}
+		ast.WalkFunc(parseMD(stripFrontMatter(pagemd)), visitor)
+	}
+	return graph, nil
+}
+
+// backlinks indexes the links of the graph by their target.  The URLs of the
+// linking pages are relative to the site root.
+func (g *linkGraph) backlinks() backlinks {
+	bl := backlinks{}
+	for _, source := range g.urls {
+		for _, target := range g.links[source] {
+			bl[target] = append(bl[target], pageLink{Title: g.titles[source], URL: source})
+		}
+	}
+	for _, sources := range bl {
+		sort.SliceStable(sources, func(i, j int) bool {
+			return sources[i].Title < sources[j].Title
+		})
+	}
+	return bl
+}
+
+// of returns the pages linking to the given page, with URLs relative to it.
+func (bl backlinks) of(pageURL string) []pageLink {
+	sources := bl[pageURL]
+	if len(sources) == 0 {
+		return nil
+	}
+	relroot := relRootOf(pageURL)
+	rel := make([]pageLink, len(sources))
+	for idx, source := range sources {
+		rel[idx] = pageLink{Title: source.Title, URL: path.Join(relroot, source.URL)}
+	}
+	return rel
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// validateBaseURL checks that the base URL, if set, is an absolute http or
+// https URL.
+func validateBaseURL(baseURL string) error {
+	if baseURL == "" {
+		return nil
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("BaseURL %q must be an absolute http or https URL", baseURL)
+	}
+	return nil
+}
+
+// absoluteURL returns the absolute URL of a URL relative to the site root,
+// under BaseURL.  Without a BaseURL, and for remote URLs, the URL is returned
+// unchanged, apart from the index.html dropped with PrettyURLs.
+func (c siteConfig) absoluteURL(rel string) string {
+	if rel == "" || isRemoteURL(rel) {
+		return rel
+	}
+	if c.PrettyURLs {
+		rel = c.pageLink(".", rel)
+	}
+	if c.BaseURL == "" {
+		return rel
+	}
+	if rel == "./" {
+		rel = ""
+	}
+	return strings.TrimSuffix(c.BaseURL, "/") + "/" + strings.TrimPrefix(rel, "/")
+}
+
+// siteRelativeURL resolves a link of the page at pageURL to a URL relative to
+// the site root.  Links starting with a slash are relative to the root
+// already, and remote links are returned unchanged.
+func siteRelativeURL(pageURL, link string) string {
+	if link == "" || isRemoteURL(link) {
+		return link
+	}
+	if strings.HasPrefix(link, "/") {
+		return strings.TrimPrefix(link, "/")
+	}
+	return path.Join(path.Dir(pageURL), link)
+}
+
+// pageURLOf returns the URL, relative to the site root, of the page a link
+// from outside the site points to: a URL absolute under BaseURL, or relative
+// to the site root with or without a leading slash.  The query and fragment
+// are dropped, and links to directories point to their index.html, like the
+// page URLs of the site.
+func (c siteConfig) pageURLOf(link string) string {
+	if c.BaseURL != "" {
+		link = strings.TrimPrefix(link, strings.TrimSuffix(c.BaseURL, "/")+"/")
+	}
+	link, _, _ = strings.Cut(link, "#")
+	link, _, _ = strings.Cut(link, "?")
+	link = strings.TrimPrefix(link, "/")
+	if link == "" || strings.HasSuffix(link, "/") {
+		link += "index.html"
+	}
+	return link
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// exitOutputChanged is the exit status of a build with -changed-exit-code
+// that changed the output.  Builds that change nothing exit with 0.
+const exitOutputChanged = 3
+
+// buildOptions are the command line options of a build.
+type buildOptions struct {
+	watch  bool
+	drafts bool
+	// wait queues the build behind a build holding the destination lock
+	// instead of failing.
+	wait bool
+	// changedExitCode makes the exit status report whether the build
+	// changed the output, for wrappers that only deploy changed sites.
+	changedExitCode bool
+	// debugTemplates annotates the output with the templates that produced
+	// it and dumps the template data of each page.
+	debugTemplates bool
+	// siteName, sourcePath, destinationPath, and pageTemplateFile override
+	// the config values when set, e.g. to build into a temporary directory
+	// in CI.
+	siteName         string
+	sourcePath       string
+	destinationPath  string
+	pageTemplateFile string
+	// metricsAddr is the address of the build metrics endpoint while
+	// watching.  Empty disables the endpoint.
+	metricsAddr string
+	// preview marks builds that are served locally and never published,
+	// like builds while watching and builds with drafts.
+	preview bool
+}
+
+// register adds the build flags to a flag set.  The current options are the
+// defaults, so options given to an outer flag set are kept.
+func (opts *buildOptions) register(flags *flag.FlagSet) {
+	flags.BoolVar(&opts.watch, "watch", opts.watch, "rebuild the site when sources, templates, resources, or the config change")
+	flags.BoolVar(&opts.drafts, "drafts", opts.drafts, "include draft pages, for local previews")
+	flags.BoolVar(&opts.wait, "wait", opts.wait, "wait for other builds of the site to finish instead of failing")
+	flags.BoolVar(&opts.debugTemplates, "debug-templates", opts.debugTemplates, "mark the output of each template with HTML comments and dump the template data of each page as JSON")
+	flags.BoolVar(&opts.changedExitCode, "changed-exit-code", opts.changedExitCode, fmt.Sprintf("exit with status %d if the build changed the output and 0 if it did not", exitOutputChanged))
+	flags.StringVar(&opts.siteName, "site-name", opts.siteName, "override SiteName from the config")
+	flags.StringVar(&opts.sourcePath, "source", opts.sourcePath, "override SourcePath from the config")
+	flags.StringVar(&opts.destinationPath, "dest", opts.destinationPath, "override DestinationPath from the config")
+	flags.StringVar(&opts.pageTemplateFile, "template", opts.pageTemplateFile, "override PageTemplateFile from the config")
+	flags.StringVar(&opts.metricsAddr, "metrics", opts.metricsAddr, "with -watch, serve build metrics as JSON at "+metricsPath+" on this address, e.g. localhost:9100")
+}
+
+// apply sets the config values given by the options.  They are kept when
+// the config is reloaded in watch mode.
+func (opts buildOptions) apply() {
+	if opts.drafts {
+		viper.Set("Drafts", true)
+	}
+	if opts.debugTemplates {
+		viper.Set("DebugTemplates", true)
+	}
+	if opts.siteName != "" {
+		viper.Set("SiteName", opts.siteName)
+	}
+	// paths are relative to the directory statiko was started in
+	if opts.sourcePath != "" {
+		viper.Set("SourcePath", argPath(opts.sourcePath))
+	}
+	if opts.destinationPath != "" {
+		viper.Set("DestinationPath", argPath(opts.destinationPath))
+	}
+	if opts.pageTemplateFile != "" {
+		viper.Set("PageTemplateFile", argPath(opts.pageTemplateFile))
+	}
+}
+
+// treeSnapshot maps the files under a directory to the hashes of their
+// contents.
+type treeSnapshot map[string][sha256.Size]byte
+
+func snapshotTree(root string) (treeSnapshot, error) {
+	snapshot := treeSnapshot{}
+	walker := func(loc string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		sum, err := hashFile(loc)
+		if err != nil {
+			return err
+		}
+		snapshot[loc] = sum
+		return nil
+	}
+	if err := filepath.Walk(root, walker); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("hashing output %q: %w", root, err)
+	}
+	return snapshot, nil
+}
+
+// outputManifestName is the name of the manifest of the output in the build
+// store.
+const outputManifestName = "output-manifest.json"
+
+// hashes returns the snapshot of the tree under root as a map of paths
+// relative to root to hex encoded hashes.
+func (ts treeSnapshot) hashes(root string) (map[string]string, error) {
+	manifest := make(map[string]string, len(ts))
+	for loc, sum := range ts {
+		rel, err := filepath.Rel(root, loc)
+		if err != nil {
+			return nil, err
+		}
+		manifest[filepath.ToSlash(rel)] = hex.EncodeToString(sum[:])
+	}
+	return manifest, nil
+}
+
+// encode returns the snapshot of the tree under root as JSON, mapping paths
+// relative to root to hex encoded hashes.
+func (ts treeSnapshot) encode(root string) ([]byte, error) {
+	manifest, err := ts.hashes(root)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(manifest, "", "  ")
+}
+
+// decodeSnapshot reads a snapshot of the tree under root encoded by encode.
+func decodeSnapshot(data []byte, root string) (treeSnapshot, error) {
+	var manifest map[string]string
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+	snapshot := make(treeSnapshot, len(manifest))
+	for rel, hexsum := range manifest {
+		var sum [sha256.Size]byte
+		if n, err := hex.Decode(sum[:], []byte(hexsum)); err != nil || n != sha256.Size {
+			return nil, fmt.Errorf("invalid hash %q of %q", hexsum, rel)
+		}
+		snapshot[filepath.Join(root, filepath.FromSlash(rel))] = sum
+	}
+	return snapshot, nil
+}
+
+// previousOutput returns the snapshot of the output of the previous build:
+// the manifest saved in the store if there is one, or else the current
+// contents of the destination.
+func previousOutput(store buildStore, conf siteConfig) (treeSnapshot, error) {
+	if store != nil {
+		data, err := store.Load(outputManifestName)
+		if err != nil {
+			return nil, fmt.Errorf("loading output manifest: %w", err)
+		}
+		if data != nil {
+			snapshot, err := decodeSnapshot(data, conf.DestinationPath)
+			if err != nil {
+				return nil, fmt.Errorf("loading output manifest: %w", err)
+			}
+			return snapshot, nil
+		}
+	}
+	return snapshotTree(conf.DestinationPath)
+}
+
+// changedFiles returns the files that were added, modified, or removed
+// between two snapshots.
+func changedFiles(before, after treeSnapshot) []string {
+	var changed []string
+	for fname, sum := range after {
+		if prev, ok := before[fname]; !ok || prev != sum {
+			changed = append(changed, fname)
+		}
+	}
+	for fname := range before {
+		if _, ok := after[fname]; !ok {
+			changed = append(changed, fname)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// published reports whether the build is a build of the site to be
+// published.  Previews, builds while watching, and builds with drafts are
+// not, so that they never change the record of what was published.
+func (opts buildOptions) published(conf siteConfig) bool {
+	return !opts.preview && !opts.watch && !conf.Drafts
+}
+
+// runBuild builds the site and, with -watch, keeps rebuilding it.  It reports
+// whether the initial build changed the output.
+func runBuild(opts buildOptions) (bool, error) {
+	start := time.Now()
+	opts.apply()
+	conf, err := loadConfig()
+	if err != nil {
+		return false, err
+	}
+
+	lock, err := lockDestination(conf, opts.wait)
+	if err != nil {
+		return false, err
+	}
+	store := newBuildStore(conf.Storage)
+	var before treeSnapshot
+	if opts.changedExitCode {
+		if before, err = previousOutput(store, conf); err != nil {
+			lock.unlock()
+			return false, err
+		}
+	}
+	// interrupting the build keeps the pages rendered so far; while
+	// watching, interrupting exits as usual
+	release := catchInterrupts()
+	err = buildSite(&conf)
+	if err == nil && !opts.watch {
+		// builds while watching are previews of the full site
+		err = buildAudiences(conf, opts.wait)
+	}
+	release()
+	if err == nil && opts.published(conf) {
+		err = writeFreezeManifest(conf, time.Now())
+	}
+	var after treeSnapshot
+	if err == nil && (opts.changedExitCode || store != nil) {
+		after, err = snapshotTree(conf.DestinationPath)
+	}
+	if err == nil && store != nil {
+		var manifest []byte
+		if manifest, err = after.encode(conf.DestinationPath); err == nil {
+			err = store.Save(outputManifestName, manifest)
+		}
+		if err != nil {
+			err = fmt.Errorf("saving output manifest: %w", err)
+		}
+	}
+	if err == nil && store != nil && opts.published(conf) {
+		err = checkFrozenURLs(store, *conf.rendered, conf, time.Now())
+	}
+	lock.unlock()
+	if err != nil {
+		return false, err
+	}
+
+	changed := false
+	if opts.changedExitCode {
+		files := changedFiles(before, after)
+		if len(files) == 0 {
+			fmt.Println(":: No changes")
+		} else {
+			fmt.Printf(":: %d changed file%s\n", len(files), plural(len(files)))
+			for _, fname := range files {
+				fmt.Printf("   %s\n", fname)
+			}
+		}
+		changed = len(files) > 0
+	}
+
+	if opts.watch {
+		metrics, err := startMetrics(opts.metricsAddr, start)
+		if err != nil {
+			return changed, err
+		}
+		if err := watchSite(conf, nil, metrics); err != nil {
+			return changed, err
+		}
+	}
+	return changed, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// bundler processes the assets of BundlePath that pages request in their
+// front matter.  Like theme assets, they are minified and fingerprinted, but
+// only the assets some page uses are written to the destination.
+type bundler struct {
+	conf siteConfig
+	// urls maps the processed assets to their URLs relative to the site
+	// root.
+	urls map[string]string
+}
+
+func newBundler(conf siteConfig) *bundler {
+	return &bundler{conf: conf, urls: map[string]string{}}
+}
+
+// url returns the URL, relative to the site root, of an asset given by its
+// path relative to BundlePath, processing the asset on first use.
+func (b *bundler) url(name string) (string, error) {
+	rel := path.Clean(filepath.ToSlash(name))
+	if url, ok := b.urls[rel]; ok {
+		return url, nil
+	}
+	if path.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", fmt.Errorf("bundle asset %q is outside BundlePath", name)
+	}
+	srcloc := filepath.Join(b.conf.BundlePath, filepath.FromSlash(rel))
+	content, err := os.ReadFile(srcloc)
+	if err != nil {
+		return "", fmt.Errorf("reading bundle asset: %w", err)
+	}
+	switch strings.ToLower(path.Ext(rel)) {
+	case ".css":
+		content = minifyCSS(content)
+	case ".js":
+		content = minifyJS(content)
+	}
+	outrel := path.Join(filepath.ToSlash(b.conf.BundlePath), fingerprint(rel, content))
+	dstloc := filepath.Join(b.conf.DestinationPath, filepath.FromSlash(outrel))
+	if err := os.MkdirAll(filepath.Dir(dstloc), 0777); err != nil {
+		return "", fmt.Errorf("creating path %q: %w", filepath.Dir(dstloc), err)
+	}
+	if err := os.WriteFile(dstloc, content, 0666); err != nil {
+		return "", fmt.Errorf("writing bundle asset %q: %w", dstloc, err)
+	}
+	b.urls[rel] = outrel
+	return outrel, nil
+}
+
+// pageAssets returns the URLs of the stylesheets and scripts requested by a
+// page.
+func (b *bundler) pageAssets(front frontMatter) (styles, scripts []string, err error) {
+	for _, name := range front.Styles {
+		url, err := b.url(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		styles = append(styles, url)
+	}
+	for _, name := range front.Scripts {
+		url, err := b.url(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		scripts = append(scripts, url)
+	}
+	return styles, scripts, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// cacheManifestFile is the name of the cache manifest in the destination.
+const cacheManifestFile = "cache-manifest.json"
+
+// cacheManifestConfig configures the cache manifest: a JSON file mapping
+// the URL path of each output file to a recommended Cache-Control value, for
+// server config generators and deploy tools.
+type cacheManifestConfig struct {
+	Enabled bool `mapstructure:"Enabled"`
+	// Immutable is the Cache-Control value of fingerprinted files, whose
+	// content never changes under the same name.
+	Immutable string `mapstructure:"Immutable"`
+	// Pages is the Cache-Control value of HTML pages.
+	Pages string `mapstructure:"Pages"`
+	// Default is the Cache-Control value of the other files.
+	Default string `mapstructure:"Default"`
+}
+
+// fingerprintRe matches the names produced by fingerprint.
+var fingerprintRe = regexp.MustCompile(`\.[0-9a-f]{10}\.[^./]+$`)
+
+// cacheControl returns the Cache-Control value for an output file.
+func (c cacheManifestConfig) cacheControl(rel string) string {
+	switch {
+	case fingerprintRe.MatchString(rel):
+		return c.Immutable
+	case strings.EqualFold(filepath.Ext(rel), ".html"):
+		return c.Pages
+	}
+	return c.Default
+}
+
+// writeCacheManifest writes the cache manifest of the files in the
+// destination.
+func writeCacheManifest(conf siteConfig) error {
+	if !conf.CacheManifest.Enabled {
+		return nil
+	}
+	files, err := outputFiles(conf.DestinationPath, []string{cacheManifestFile})
+	if err != nil {
+		return fmt.Errorf("writing cache manifest: %w", err)
+	}
+	manifest := make(map[string]string, len(files))
+	for rel := range files {
+		manifest["/"+rel] = conf.CacheManifest.cacheControl(rel)
+	}
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding cache manifest: %w", err)
+	}
+	fname := filepath.Join(conf.DestinationPath, cacheManifestFile)
+	fmt.Printf(":: Writing cache manifest %s (%d file%s)\n", fname, len(manifest), plural(len(manifest)))
+	if err := os.WriteFile(fname, content, 0666); err != nil {
+		return fmt.Errorf("writing cache manifest %q: %w", fname, err)
+	}
+	return nil
+}
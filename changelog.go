@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gomarkdown/markdown"
+	"github.com/gomarkdown/markdown/html"
+)
+
+type changelogConfig struct {
+	// File is a JSON file with a list of releases.
+	File string `mapstructure:"File"`
+	// GitTags reads the releases from the annotated tags of the git
+	// repository in GitDir instead of File.
+	GitTags bool   `mapstructure:"GitTags"`
+	GitDir  string `mapstructure:"GitDir"`
+	// Output is the path of the release notes page, relative to the
+	// destination path.  The RSS feed is written next to it with the .xml
+	// extension.
+	Output string `mapstructure:"Output"`
+	Title  string `mapstructure:"Title"`
+}
+
+func (c changelogConfig) enabled() bool {
+	return c.File != "" || c.GitTags
+}
+
+// release is an entry in the changelog data file.  Notes are markdown.
+type release struct {
+	Version string    `json:"version"`
+	Date    time.Time `json:"date"`
+	Notes   string    `json:"notes"`
+	Changes []string  `json:"changes"`
+}
+
+// markdown returns the release notes and changes as a markdown document
+// without a heading.
+func (r release) markdown() string {
+	md := strings.TrimSpace(r.Notes)
+	if len(r.Changes) > 0 {
+		if md != "" {
+			md += "\n\n"
+		}
+		for _, change := range r.Changes {
+			md += fmt.Sprintf("- %s\n", change)
+		}
+	}
+	return md
+}
+
+// anchor returns the fragment identifier of the release on the release notes
+// page.
+func (r release) anchor() string {
+	return "release-" + strings.NewReplacer(".", "-", " ", "-", "/", "-").Replace(r.Version)
+}
+
+func readChangelogFile(fname string) ([]release, error) {
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		return nil, fmt.Errorf("reading changelog %q: %w", fname, err)
+	}
+	var releases []release
+	if err := json.Unmarshal(data, &releases); err != nil {
+		return nil, fmt.Errorf("reading changelog %q: %w", fname, err)
+	}
+	return releases, nil
+}
+
+// readGitTagReleases reads releases from the tags of a git repository.  The
+// tag message (of annotated tags) becomes the release notes.
+func readGitTagReleases(gitdir string) ([]release, error) {
+	const sep = "\x1f"
+	format := strings.Join([]string{"%(refname:short)", "%(creatordate:iso-strict)", "%(contents)"}, sep) + "\x1e"
+	cmd := exec.Command("git", "for-each-ref", "--format="+format, "refs/tags")
+	cmd.Dir = gitdir
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("reading git tags in %q: %w", gitdir, err)
+	}
+	var releases []release
+	for _, record := range strings.Split(string(out), "\x1e") {
+		record = strings.TrimSpace(record)
+		if record == "" {
+			continue
+		}
+		fields := strings.SplitN(record, sep, 3)
+		if len(fields) != 3 {
+			continue
+		}
+		date, err := time.Parse(time.RFC3339, fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("reading git tag %q: %w", fields[0], err)
+		}
+		// drop the signature of signed tags
+		notes, _, _ := strings.Cut(fields[2], "-----BEGIN PGP SIGNATURE-----")
+		releases = append(releases, release{Version: fields[0], Date: date, Notes: notes})
+	}
+	return releases, nil
+}
+
+// renderChangelog generates the release notes page and the RSS feed of
+// releases from the changelog data file or git tags.
+func renderChangelog(conf siteConfig) error {
+	clconf := conf.Changelog
+	if !clconf.enabled() {
+		return nil
+	}
+	fmt.Println(":: Generating release notes")
+
+	var releases []release
+	var err error
+	if clconf.GitTags {
+		releases, err = readGitTagReleases(clconf.GitDir)
+	} else {
+		releases, err = readChangelogFile(clconf.File)
+	}
+	if err != nil {
+		return fmt.Errorf("generating release notes: %w", err)
+	}
+	sort.SliceStable(releases, func(i, j int) bool { return releases[i].Date.After(releases[j].Date) })
+
+	renderer := html.NewRenderer(html.RendererOptions{})
+	pageURL := conf.absoluteURL(filepath.ToSlash(clconf.Output))
+	channel := rssChannel{
+		Title:       fmt.Sprintf("%s: %s", conf.SiteName, clconf.Title),
+		Link:        pageURL,
+		Description: clconf.Title,
+	}
+	var body strings.Builder
+	fmt.Fprintf(&body, "<h1>%s</h1>\n", template.HTMLEscapeString(clconf.Title))
+	for _, rel := range releases {
+		notes := markdown.Render(parseMD([]byte(rel.markdown())), renderer)
+		fmt.Fprintf(&body, "<section class=\"release\" id=\"%s\">\n<h2>%s</h2>\n<p class=\"release-date\">%s</p>\n%s</section>\n",
+			rel.anchor(), template.HTMLEscapeString(rel.Version), rel.Date.Format("02 Jan 2006"), notes)
+
+		channel.Items = append(channel.Items, rssItem{
+			Title:       rel.Version,
+			Link:        pageURL + "#" + rel.anchor(),
+			Description: string(notes),
+			PubDate:     rssTime(rel.Date),
+			GUID:        rssGUID{Value: rel.Version},
+		})
+	}
+	if len(releases) > 0 {
+		channel.LastBuildDate = rssTime(releases[0].Date)
+	}
+
+	outpath := filepath.Join(conf.DestinationPath, clconf.Output)
+	outpathpar, _ := filepath.Split(outpath)
+	if err := os.MkdirAll(outpathpar, 0777); err != nil {
+		return fmt.Errorf("generating release notes: creating path %q: %w", outpathpar, err)
+	}
+
+	data := newTemplateData(conf)
+	data.Body = template.HTML(body.String())
+	data.RelRoot, _ = filepath.Rel(outpathpar, conf.DestinationPath)
+	htmlData, err := makeHTML(data, conf.PageTemplateFile, conf)
+	if err != nil {
+		return fmt.Errorf("generating release notes: %w", err)
+	}
+	fmt.Printf("   Saving release notes: %s\n", outpath)
+	if err := os.WriteFile(outpath, htmlData, 0666); err != nil {
+		return fmt.Errorf("generating release notes: writing %q: %w", outpath, err)
+	}
+
+	feedpath := strings.TrimSuffix(outpath, filepath.Ext(outpath)) + ".xml"
+	fmt.Printf("   Saving releases feed: %s\n", feedpath)
+	if err := writeRSSFeed(channel, feedpath); err != nil {
+		return fmt.Errorf("generating release notes: %w", err)
+	}
+	return nil
+}
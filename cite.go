@@ -0,0 +1,456 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	gohtml "html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// bibName is the name of an author of a bibliography entry.  Literal names,
+// such as those of organizations, have no given name.
+type bibName struct {
+	Family string
+	Given  string
+}
+
+// bibEntry is a work of the bibliography.
+type bibEntry struct {
+	Key     string
+	Authors []bibName
+	Title   string
+	// Container is the journal, book, or site the work is part of.
+	Container string
+	Publisher string
+	Year      string
+	Volume    string
+	Issue     string
+	Pages     string
+	URL       string
+	DOI       string
+}
+
+// bibliography maps citation keys to their entries.
+type bibliography map[string]bibEntry
+
+// loadBibliography reads the bibliography file of the config: BibTeX, or
+// CSL-JSON for files with the .json extension.
+func loadBibliography(conf siteConfig) (bibliography, error) {
+	if conf.Bibliography == "" {
+		return nil, nil
+	}
+	content, err := os.ReadFile(conf.Bibliography)
+	if err != nil {
+		return nil, fmt.Errorf("reading bibliography: %w", err)
+	}
+	var bib bibliography
+	if strings.EqualFold(filepath.Ext(conf.Bibliography), ".json") {
+		bib, err = parseCSLJSON(content)
+	} else {
+		bib, err = parseBibTeX(string(content))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading bibliography %q: %w", conf.Bibliography, err)
+	}
+	return bib, nil
+}
+
+// cslItem is an item of a CSL-JSON bibliography.
+type cslItem struct {
+	ID     string `json:"id"`
+	Title  string `json:"title"`
+	Author []struct {
+		Family  string `json:"family"`
+		Given   string `json:"given"`
+		Literal string `json:"literal"`
+	} `json:"author"`
+	ContainerTitle string `json:"container-title"`
+	Publisher      string `json:"publisher"`
+	Volume         any    `json:"volume"`
+	Issue          any    `json:"issue"`
+	Page           string `json:"page"`
+	URL            string `json:"URL"`
+	DOI            string `json:"DOI"`
+	Issued         struct {
+		DateParts [][]any `json:"date-parts"`
+		Literal   string  `json:"literal"`
+	} `json:"issued"`
+}
+
+func parseCSLJSON(content []byte) (bibliography, error) {
+	var items []cslItem
+	if err := json.Unmarshal(content, &items); err != nil {
+		return nil, err
+	}
+	bib := bibliography{}
+	for _, item := range items {
+		if item.ID == "" {
+			return nil, fmt.Errorf("item %q without an id", item.Title)
+		}
+		entry := bibEntry{
+			Key:       item.ID,
+			Title:     item.Title,
+			Container: item.ContainerTitle,
+			Publisher: item.Publisher,
+			Pages:     item.Page,
+			URL:       item.URL,
+			DOI:       item.DOI,
+			Year:      item.Issued.Literal,
+		}
+		if item.Volume != nil {
+			entry.Volume = fmt.Sprint(item.Volume)
+		}
+		if item.Issue != nil {
+			entry.Issue = fmt.Sprint(item.Issue)
+		}
+		if len(item.Issued.DateParts) > 0 && len(item.Issued.DateParts[0]) > 0 {
+			entry.Year = fmt.Sprint(item.Issued.DateParts[0][0])
+		}
+		for _, author := range item.Author {
+			if author.Literal != "" {
+				entry.Authors = append(entry.Authors, bibName{Family: author.Literal})
+			} else {
+				entry.Authors = append(entry.Authors, bibName{Family: author.Family, Given: author.Given})
+			}
+		}
+		bib[entry.Key] = entry
+	}
+	return bib, nil
+}
+
+var (
+	// bibtexEntryRe matches the start of a BibTeX entry up to its key.
+	bibtexEntryRe = regexp.MustCompile(`@(\w+)\s*[{(]\s*([^,\s]+)\s*,`)
+	// bibtexNamesRe matches the separators of the names of a BibTeX field.
+	bibtexNamesRe = regexp.MustCompile(`\s+and\s+`)
+)
+
+// parseBibTeX reads the entries of a BibTeX file.  Field values may be
+// braced, quoted, or bare numbers; braces inside values, used in BibTeX to
+// protect capitalization, are dropped.  String macros are not supported.
+func parseBibTeX(src string) (bibliography, error) {
+	bib := bibliography{}
+	for _, loc := range bibtexEntryRe.FindAllStringSubmatchIndex(src, -1) {
+		kind := strings.ToLower(src[loc[2]:loc[3]])
+		if kind == "comment" || kind == "string" || kind == "preamble" {
+			continue
+		}
+		key := src[loc[4]:loc[5]]
+		fields, err := parseBibTeXFields(src[loc[1]:])
+		if err != nil {
+			return nil, fmt.Errorf("entry %q: %w", key, err)
+		}
+		entry := bibEntry{
+			Key:       key,
+			Title:     fields["title"],
+			Container: fields["journal"],
+			Publisher: fields["publisher"],
+			Year:      fields["year"],
+			Volume:    fields["volume"],
+			Issue:     fields["number"],
+			Pages:     strings.ReplaceAll(fields["pages"], "--", "–"),
+			URL:       fields["url"],
+			DOI:       fields["doi"],
+		}
+		if entry.Container == "" {
+			entry.Container = fields["booktitle"]
+		}
+		if entry.Publisher == "" {
+			entry.Publisher = fields["institution"]
+		}
+		if entry.Year == "" && len(fields["date"]) >= 4 {
+			entry.Year = fields["date"][:4]
+		}
+		names := fields["author"]
+		if names == "" {
+			names = fields["editor"]
+		}
+		for _, name := range bibtexNamesRe.Split(names, -1) {
+			if name = strings.TrimSpace(name); name == "" {
+				continue
+			}
+			if family, given, ok := strings.Cut(name, ","); ok {
+				entry.Authors = append(entry.Authors, bibName{Family: strings.TrimSpace(family), Given: strings.TrimSpace(given)})
+			} else if idx := strings.LastIndex(name, " "); idx > 0 {
+				entry.Authors = append(entry.Authors, bibName{Family: name[idx+1:], Given: name[:idx]})
+			} else {
+				entry.Authors = append(entry.Authors, bibName{Family: name})
+			}
+		}
+		bib[key] = entry
+	}
+	return bib, nil
+}
+
+// bibTeXCommandRe matches the TeX commands and escaped characters of BibTeX
+// values.
+var bibTeXCommandRe = regexp.MustCompile(`\\([a-zA-Z]+|[&%$#_])\s*`)
+
+// unescapeBibTeX returns the text of a BibTeX value without its TeX markup.
+// Escaped characters and the names of the TeX logos are kept, other commands,
+// such as \emph, are dropped, keeping their arguments.
+func unescapeBibTeX(value string) string {
+	value = bibTeXCommandRe.ReplaceAllStringFunc(value, func(cmd string) string {
+		name := strings.TrimSpace(cmd[1:])
+		switch name {
+		case "&", "%", "$", "#", "_", "TeX", "LaTeX", "BibTeX":
+			return name
+		}
+		return ""
+	})
+	return strings.ReplaceAll(value, "~", " ")
+}
+
+// parseBibTeXFields reads the fields of an entry from after its key up to
+// the end of the entry.  Field names are lowercase.
+func parseBibTeXFields(src string) (map[string]string, error) {
+	fields := map[string]string{}
+	pos := 0
+	skipSpace := func() {
+		for pos < len(src) && (unicode.IsSpace(rune(src[pos])) || src[pos] == ',') {
+			pos++
+		}
+	}
+	for {
+		skipSpace()
+		if pos >= len(src) {
+			return nil, fmt.Errorf("unterminated entry")
+		}
+		if src[pos] == '}' || src[pos] == ')' {
+			return fields, nil
+		}
+		eq := strings.IndexByte(src[pos:], '=')
+		if eq < 0 {
+			return nil, fmt.Errorf("field without a value")
+		}
+		name := strings.ToLower(strings.TrimSpace(src[pos : pos+eq]))
+		pos += eq + 1
+		skipSpace()
+		if pos >= len(src) {
+			return nil, fmt.Errorf("field %q without a value", name)
+		}
+		var value strings.Builder
+		switch src[pos] {
+		case '{', '"':
+			closing := byte('}')
+			if src[pos] == '"' {
+				closing = '"'
+			}
+			depth := 0
+			pos++
+			for ; pos < len(src); pos++ {
+				c := src[pos]
+				if c == closing && depth == 0 {
+					break
+				}
+				switch c {
+				case '{':
+					depth++
+				case '}':
+					depth--
+				default:
+					value.WriteByte(c)
+				}
+			}
+			if pos >= len(src) {
+				return nil, fmt.Errorf("unterminated value of field %q", name)
+			}
+			pos++
+		default:
+			end := strings.IndexAny(src[pos:], ",})")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated value of field %q", name)
+			}
+			value.WriteString(strings.TrimSpace(src[pos : pos+end]))
+			pos += end
+		}
+		fields[name] = strings.Join(strings.Fields(unescapeBibTeX(value.String())), " ")
+	}
+}
+
+// citeAuthors returns the authors of an entry as cited in the text.
+func (e bibEntry) citeAuthors() string {
+	switch len(e.Authors) {
+	case 0:
+		return e.Title
+	case 1:
+		return e.Authors[0].Family
+	case 2:
+		return e.Authors[0].Family + " and " + e.Authors[1].Family
+	}
+	return e.Authors[0].Family + " et al."
+}
+
+// sortKey orders the entries of a reference list by author, year, and title.
+func (e bibEntry) sortKey() string {
+	return strings.ToLower(e.citeAuthors() + "\x00" + e.Year + "\x00" + e.Title)
+}
+
+// referenceHTML formats the entry for the reference list in an author-date
+// style: authors, year, title, the container with its volume, issue, and
+// pages, publisher, and DOI or URL.
+func (e bibEntry) referenceHTML() string {
+	esc := gohtml.EscapeString
+	var names []string
+	for idx, name := range e.Authors {
+		switch {
+		case name.Given == "":
+			names = append(names, name.Family)
+		case idx == 0:
+			names = append(names, name.Family+", "+name.Given)
+		default:
+			names = append(names, name.Given+" "+name.Family)
+		}
+	}
+	var parts []string
+	if len(names) > 0 {
+		authors := strings.Join(names, ", ")
+		if len(names) > 1 {
+			authors = strings.Join(names[:len(names)-1], ", ") + ", and " + names[len(names)-1]
+		}
+		parts = append(parts, esc(strings.TrimSuffix(authors, ".")+"."))
+	}
+	if e.Year != "" {
+		parts = append(parts, esc(e.Year)+".")
+	}
+	if e.Container != "" {
+		parts = append(parts, "“"+esc(e.Title)+".”")
+		container := "<em>" + esc(e.Container) + "</em>"
+		if e.Volume != "" {
+			container += " " + esc(e.Volume)
+		}
+		if e.Issue != "" {
+			container += " (" + esc(e.Issue) + ")"
+		}
+		if e.Pages != "" {
+			container += ": " + esc(e.Pages)
+		}
+		parts = append(parts, container+".")
+	} else if e.Title != "" {
+		parts = append(parts, "<em>"+esc(e.Title)+"</em>.")
+	}
+	if e.Publisher != "" {
+		parts = append(parts, esc(e.Publisher)+".")
+	}
+	link := e.URL
+	if e.DOI != "" {
+		link = "https://doi.org/" + e.DOI
+	}
+	if link != "" {
+		parts = append(parts, fmt.Sprintf(`<a href="%s">%s</a>`, esc(link), esc(link)))
+	}
+	return strings.Join(parts, " ")
+}
+
+// citationRe matches a citation, [@key], or several separated by
+// semicolons, each with optional text before the key and a locator after
+// it: [see @knuth84, p. 3; @lamport94].
+var citationRe = regexp.MustCompile(`\[([^\[\]]*@[^\[\]]+)\]`)
+
+// citeItemRe matches an item of a citation.
+var citeItemRe = regexp.MustCompile(`^\s*(.*?)@([\w:.#$%&+?<>~/-]+)(.*)$`)
+
+// referenceID returns the id of the entry of the reference list for a key.
+func referenceID(key string) string {
+	return "ref-" + slugify(key)
+}
+
+// formatCitation returns the HTML of a citation, linking each item to its
+// entry in the reference list, and the keys it cites.  A citation with an
+// unknown key is not formatted.
+func formatCitation(citation string, bib bibliography) (string, []string, error) {
+	var items, keys []string
+	for _, item := range strings.Split(citation, ";") {
+		match := citeItemRe.FindStringSubmatch(item)
+		if match == nil {
+			return "", nil, fmt.Errorf("citation [%s]: item %q without a key", citation, strings.TrimSpace(item))
+		}
+		prefix, key, locator := match[1], match[2], strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(match[3]), ","))
+		entry, ok := bib[key]
+		if !ok {
+			return "", nil, fmt.Errorf("citation [%s]: unknown key %q", citation, key)
+		}
+		keys = append(keys, key)
+		cite := fmt.Sprintf(`<a href="#%s">%s</a>`, referenceID(key), gohtml.EscapeString(strings.TrimSpace(entry.citeAuthors()+" "+entry.Year)))
+		if prefix != "" {
+			cite = gohtml.EscapeString(prefix) + cite
+		}
+		if locator != "" {
+			cite += ", " + gohtml.EscapeString(locator)
+		}
+		items = append(items, cite)
+	}
+	return `<span class="citation">(` + strings.Join(items, "; ") + `)</span>`, keys, nil
+}
+
+// addCitations formats the citations of a page and adds a reference list of
+// the cited works at the end of it.  Citations with unknown keys are left as
+// they are, with a warning.
+func addCitations(doc ast.Node, bib bibliography, fname string) {
+	type found struct {
+		text *ast.Text
+		locs [][]int
+	}
+	var texts []found
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		text, ok := node.(*ast.Text)
+		if !ok || !entering || inUnlinkableNode(text) {
+			return ast.GoToNext
+		}
+		if locs := citationRe.FindAllSubmatchIndex(text.Literal, -1); locs != nil {
+			texts = append(texts, found{text, locs})
+		}
+		return ast.GoToNext
+	})
+
+	// modify the tree after walking it
+	cited := map[string]bool{}
+	for _, f := range texts {
+		lit := f.text.Literal
+		var nodes []ast.Node
+		last := 0
+		for _, loc := range f.locs {
+			citation, keys, err := formatCitation(string(lit[loc[2]:loc[3]]), bib)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "warning: %s: %v\n", fname, err)
+				continue
+			}
+			for _, key := range keys {
+				cited[key] = true
+			}
+			nodes = append(nodes,
+				&ast.Text{Leaf: ast.Leaf{Literal: lit[last:loc[0]]}},
+				&ast.HTMLSpan{Leaf: ast.Leaf{Literal: []byte(citation)}})
+			last = loc[1]
+		}
+		if len(nodes) > 0 {
+			nodes = append(nodes, &ast.Text{Leaf: ast.Leaf{Literal: lit[last:]}})
+			replaceNode(f.text, nodes...)
+		}
+	}
+	if len(cited) == 0 {
+		return
+	}
+
+	entries := make([]bibEntry, 0, len(cited))
+	for key := range cited {
+		entries = append(entries, bib[key])
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].sortKey() < entries[j].sortKey() })
+	heading := &ast.Heading{Level: 2, HeadingID: "references"}
+	ast.AppendChild(heading, &ast.Text{Leaf: ast.Leaf{Literal: []byte("References")}})
+	list := "<ul class=\"references\">\n"
+	for _, entry := range entries {
+		list += fmt.Sprintf("<li id=\"%s\">%s</li>\n", referenceID(entry.Key), entry.referenceHTML())
+	}
+	list += "</ul>"
+	ast.AppendChild(doc, heading)
+	ast.AppendChild(doc, &ast.HTMLBlock{Leaf: ast.Leaf{Literal: []byte(list)}})
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/spf13/viper"
+)
+
+// orphanFiles returns the files of the destination, relative to it, that a
+// fresh build of the site does not produce.  The site is built into the
+// workspace to find the files it produces.
+func orphanFiles(conf siteConfig) ([]string, error) {
+	ws, err := openWorkspace(conf)
+	if err != nil {
+		return nil, err
+	}
+	defer ws.close()
+	tmpdir, err := ws.mkdirTemp("clean-")
+	if err != nil {
+		return nil, fmt.Errorf("creating build directory: %w", err)
+	}
+	dest := conf.DestinationPath
+	conf.DestinationPath = filepath.Join(tmpdir, "html")
+	// outputs outside the destination are not affected
+	conf.FragmentPath = ""
+	conf.DebugTemplates = false
+	conf.Dashboard.Enabled = false
+	// the build cache describes the real destination
+	conf.Incremental = false
+	if err := buildSite(&conf); err != nil {
+		return nil, err
+	}
+
+	built, err := outputFiles(conf.DestinationPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := outputFiles(dest, nil)
+	if err != nil {
+		return nil, err
+	}
+	var orphans []string
+	for rel := range existing {
+		if !built[rel] {
+			orphans = append(orphans, rel)
+		}
+	}
+	sort.Strings(orphans)
+	return orphans, nil
+}
+
+// removeEmptyDirs removes the empty directories under root, deepest first.
+// root itself is kept.
+func removeEmptyDirs(root string) error {
+	var dirs []string
+	walker := func(loc string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && loc != root {
+			dirs = append(dirs, loc)
+		}
+		return nil
+	}
+	if err := filepath.Walk(root, walker); err != nil {
+		return err
+	}
+	for idx := len(dirs) - 1; idx >= 0; idx-- {
+		entries, err := os.ReadDir(dirs[idx])
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			if err := os.Remove(dirs[idx]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// runClean removes the destination directory, or with -orphans only the
+// files in it that the site no longer produces, such as the pages of renamed
+// posts.
+func runClean(args []string) error {
+	flags := flag.NewFlagSet("clean", flag.ExitOnError)
+	orphans := flags.Bool("orphans", false, "remove only the output files that no source page or resource produces")
+	dryRun := flags.Bool("dry-run", false, "list the files that would be removed without removing them")
+	drafts := flags.Bool("drafts", false, "keep the output of drafts (with -orphans)")
+	wait := flags.Bool("wait", false, "wait for a running build to finish instead of failing")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *drafts {
+		viper.Set("Drafts", true)
+	}
+	conf, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	lock, err := lockDestination(conf, *wait)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+
+	dest := conf.DestinationPath
+	if !*orphans {
+		fmt.Printf(":: Removing %s\n", dest)
+		if *dryRun {
+			return nil
+		}
+		if err := os.RemoveAll(dest); err != nil {
+			return fmt.Errorf("clean: %w", err)
+		}
+		return nil
+	}
+
+	files, err := orphanFiles(conf)
+	if err != nil {
+		return fmt.Errorf("clean: %w", err)
+	}
+	fmt.Printf(":: Removing %d orphaned file%s from %s\n", len(files), plural(len(files)), dest)
+	for _, rel := range files {
+		loc := filepath.Join(dest, filepath.FromSlash(rel))
+		fmt.Printf("   %s\n", loc)
+		if *dryRun {
+			continue
+		}
+		if err := os.Remove(loc); err != nil {
+			return fmt.Errorf("clean: %w", err)
+		}
+	}
+	if *dryRun {
+		return nil
+	}
+	if err := removeEmptyDirs(dest); err != nil {
+		return fmt.Errorf("clean: removing empty directories: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"sort"
+)
+
+// fenceRe matches the opening line of a fenced code block: three or more
+// backticks or tildes, indented by at most three spaces.
+var fenceRe = regexp.MustCompile("(?m)^ {0,3}(`{3,}|~{3,})")
+
+// codeRanges returns the byte ranges of the fenced code blocks and code spans
+// of markdown source, in order.  Shortcodes, refs, and wikilinks in them are
+// left as they are, so that pages can show their syntax.
+func codeRanges(md []byte) [][2]int {
+	var ranges [][2]int
+	start := 0
+	for start < len(md) {
+		loc := fenceRe.FindSubmatchIndex(md[start:])
+		if loc == nil {
+			ranges = append(ranges, codeSpans(md, start, len(md))...)
+			break
+		}
+		open, fence := start+loc[0], md[start+loc[2]:start+loc[3]]
+		ranges = append(ranges, codeSpans(md, start, open)...)
+		end := len(md)
+		if nl := bytes.IndexByte(md[open:], '\n'); nl >= 0 {
+			end = closingFence(md, open+nl+1, fence)
+		}
+		ranges = append(ranges, [2]int{open, end})
+		start = end
+	}
+	return ranges
+}
+
+// closingFence returns the end of the line closing a code block opened by
+// fence, searching from offset, or the end of md if the block is not closed.
+func closingFence(md []byte, offset int, fence []byte) int {
+	for offset < len(md) {
+		line := md[offset:]
+		end := len(md)
+		if nl := bytes.IndexByte(line, '\n'); nl >= 0 {
+			line = line[:nl]
+			end = offset + nl + 1
+		}
+		trimmed := bytes.TrimLeft(line, " ")
+		if len(line)-len(trimmed) <= 3 && bytes.HasPrefix(trimmed, fence) &&
+			len(bytes.TrimSpace(bytes.TrimLeft(trimmed, string(fence[:1])))) == 0 {
+			return end
+		}
+		offset = end
+	}
+	return len(md)
+}
+
+// codeSpans returns the byte ranges of the code spans in md[start:end]: runs
+// of backticks closed by a run of the same length.
+func codeSpans(md []byte, start, end int) [][2]int {
+	var spans [][2]int
+	for idx := start; idx < end; idx++ {
+		switch md[idx] {
+		case '\\':
+			idx++
+			continue
+		case '`':
+		default:
+			continue
+		}
+		n := backtickRun(md, idx, end)
+		closing := -1
+		for search := idx + n; search < end; search++ {
+			if md[search] != '`' {
+				continue
+			}
+			m := backtickRun(md, search, end)
+			if m == n {
+				closing = search
+				break
+			}
+			search += m - 1
+		}
+		if closing < 0 {
+			// an unmatched run is literal backticks
+			idx += n - 1
+			continue
+		}
+		spans = append(spans, [2]int{idx, closing + n})
+		idx = closing + n - 1
+	}
+	return spans
+}
+
+// backtickRun returns the length of the run of backticks at md[idx:end].
+func backtickRun(md []byte, idx, end int) int {
+	n := 0
+	for idx+n < end && md[idx+n] == '`' {
+		n++
+	}
+	return n
+}
+
+// inCode reports whether md[start:end] overlaps one of the code ranges.
+func inCode(ranges [][2]int, start, end int) bool {
+	idx := sort.Search(len(ranges), func(i int) bool { return ranges[i][1] > start })
+	return idx < len(ranges) && ranges[idx][0] < end
+}
+
+// replaceOutsideCode is like re.ReplaceAllFunc, but leaves the matches in
+// fenced code blocks and code spans unchanged.
+func replaceOutsideCode(re *regexp.Regexp, md []byte, repl func([]byte) []byte) []byte {
+	ranges := codeRanges(md)
+	var out bytes.Buffer
+	cursor := 0
+	for _, loc := range re.FindAllIndex(md, -1) {
+		if inCode(ranges, loc[0], loc[1]) {
+			continue
+		}
+		out.Write(md[cursor:loc[0]])
+		out.Write(repl(md[loc[0]:loc[1]]))
+		cursor = loc[1]
+	}
+	out.Write(md[cursor:])
+	return out.Bytes()
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	gohtml "html"
+	"path"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+	"github.com/gomarkdown/markdown/html"
+)
+
+// colorSchemeVariants finds the light and dark variants of an image following
+// the name.light.ext / name.dark.ext convention.  The image can be referenced
+// by either variant or by the plain name.  The light variant falls back to the
+// plain name if it does not exist.  ok is false if there is no dark variant.
+func colorSchemeVariants(src, pageURL string, conf siteConfig) (light, dark string, ok bool) {
+	ext := path.Ext(src)
+	stem := strings.TrimSuffix(src, ext)
+	stem = strings.TrimSuffix(strings.TrimSuffix(stem, ".light"), ".dark")
+
+	dark = stem + ".dark" + ext
+	if localImagePath(dark, pageURL, conf) == "" {
+		return "", "", false
+	}
+	light = stem + ".light" + ext
+	if localImagePath(light, pageURL, conf) == "" {
+		light = stem + ext
+		if localImagePath(light, pageURL, conf) == "" {
+			return "", "", false
+		}
+	}
+	return light, dark, true
+}
+
+// pictureHTML renders an image as a picture element that switches to the
+// dark variant when the reader prefers a dark colour scheme.
+func pictureHTML(img *ast.Image, light, dark string) string {
+	attrs := html.BlockAttrs(img)
+	attrs = append(attrs,
+		fmt.Sprintf(`src="%s"`, gohtml.EscapeString(light)),
+		fmt.Sprintf(`alt="%s"`, gohtml.EscapeString(childLiterals(img))))
+	if len(img.Title) > 0 {
+		attrs = append(attrs, fmt.Sprintf(`title="%s"`, gohtml.EscapeString(string(img.Title))))
+	}
+	return fmt.Sprintf(`<picture><source srcset="%s" media="(prefers-color-scheme: dark)">%s</picture>`,
+		gohtml.EscapeString(dark), html.TagWithAttributes("<img", attrs))
+}
+
+// addColorSchemeVariants replaces images that have light and dark variants
+// with picture elements selecting the variant for the reader's preferred
+// colour scheme.
+func addColorSchemeVariants(doc ast.Node, pageURL string, conf siteConfig) {
+	type variant struct {
+		img         *ast.Image
+		light, dark string
+	}
+	var variants []variant
+	visitor := func(node ast.Node, entering bool) ast.WalkStatus {
+		if img, ok := node.(*ast.Image); ok && entering {
+			if light, dark, ok := colorSchemeVariants(string(img.Destination), pageURL, conf); ok {
+				variants = append(variants, variant{img, light, dark})
+			}
+		}
+		return ast.GoToNext
+	}
+	ast.WalkFunc(doc, visitor)
+
+	// modify the tree after walking it
+	for _, v := range variants {
+		picture := &ast.HTMLSpan{
+			Leaf: ast.Leaf{
+				Literal: []byte(pictureHTML(v.img, v.light, v.dark)),
+			},
+		}
+		replaceNode(v.img, picture)
+	}
+}
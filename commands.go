@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// command is a subcommand of statiko.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+// commands returns the subcommands.  Build options given before the build
+// command apply to it too, so `statiko -drafts build` works as it did before
+// build was a command.
+func commands(opts buildOptions) []command {
+	return []command{
+		{"build", "build the site (the default without a command)", func(args []string) error {
+			flags := flag.NewFlagSet("build", flag.ExitOnError)
+			opts.register(flags)
+			if err := flags.Parse(args); err != nil {
+				return err
+			}
+			return buildAndExit(opts)
+		}},
+		{"serve", "build the site and serve it over HTTP", runServe},
+		{"new", "create a new post", runNew},
+		{"clean", "remove the destination or its orphaned files", runClean},
+		{"init", "create the files of a new site", runInit},
+		{"test", "compare the build with the expected output", runSiteTest},
+		{"logstats", "render a private stats page from server access logs", runLogStats},
+		{"snapshot", "save a browsable copy of the current build", runSnapshot},
+		{"freeze-verify", "verify a freeze manifest and list the sources changed since", runFreezeVerify},
+		{"link-report", "report the click depth of the pages of the built site", runLinkReport},
+		{"theme", "report what the templates and assets of a theme touch (theme vet)", runTheme},
+		{"import-email", "convert emails from .eml or mbox files into posts", runImportEmail},
+		{"import-obsidian", "convert Obsidian notes into pages", runImportObsidian},
+		{"self-update", "update statiko to the latest release", runSelfUpdate},
+		{"version", "print the version", func([]string) error {
+			printversion()
+			return nil
+		}},
+	}
+}
+
+// buildAndExit builds the site and, with -changed-exit-code, exits with
+// exitOutputChanged if the build changed the output.
+func buildAndExit(opts buildOptions) error {
+	changed, err := runBuild(opts)
+	if err != nil {
+		return err
+	}
+	if opts.changedExitCode && changed {
+		os.Exit(exitOutputChanged)
+	}
+	return nil
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "usage: statiko [build options] [command [options]]\n\n")
+	fmt.Fprintf(out, "commands:\n")
+	for _, cmd := range commands(buildOptions{}) {
+		fmt.Fprintf(out, "  %-16s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(out, "\nRun statiko <command> -h for the options of a command.\n\nbuild options:\n")
+	flag.PrintDefaults()
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+var (
+	// configFile is the config file given with -config.  Without it, the
+	// config is searched in the working directory and the XDG config
+	// directories.
+	configFile string
+	// invocationDir is the working directory statiko was started in, before
+	// changing to the directory of the config file.
+	invocationDir string
+	// configEnv is the environment selected with -env, whose overlay of the
+	// config file is merged over it.
+	configEnv string
+)
+
+// configSearchPaths returns the directories searched for config.yaml (or
+// another supported format) when no config file is given: the working
+// directory, then statiko/ in $XDG_CONFIG_HOME (default ~/.config) and in
+// each of $XDG_CONFIG_DIRS (default /etc/xdg).
+func configSearchPaths() []string {
+	paths := []string{"."}
+	if home, err := os.UserConfigDir(); err == nil {
+		paths = append(paths, filepath.Join(home, "statiko"))
+	}
+	dirs := os.Getenv("XDG_CONFIG_DIRS")
+	if dirs == "" {
+		dirs = "/etc/xdg"
+	}
+	for _, dir := range strings.Split(dirs, string(os.PathListSeparator)) {
+		if dir != "" {
+			paths = append(paths, filepath.Join(dir, "statiko"))
+		}
+	}
+	return paths
+}
+
+// useConfigFile selects the config file given with -config and changes to
+// its directory, so the paths in the config are relative to it as they are
+// when statiko runs in the site root.
+func useConfigFile(fname string) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("getting working directory: %w", err)
+	}
+	invocationDir = wd
+	configFile = absPath(fname)
+	if err := os.Chdir(filepath.Dir(configFile)); err != nil {
+		return fmt.Errorf("changing to the directory of the config file: %w", err)
+	}
+	return nil
+}
+
+// argPath resolves a path given on the command line against the directory
+// statiko was started in, which differs from the working directory when a
+// config file is given with -config.
+func argPath(p string) string {
+	if p == "" || invocationDir == "" || filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(invocationDir, p)
+}
+
+// configOverlayPath returns the path of the overlay of a config file for the
+// selected environment: config.production.yaml for config.yaml.
+func configOverlayPath(fname string) string {
+	ext := filepath.Ext(fname)
+	return strings.TrimSuffix(fname, ext) + "." + configEnv + ext
+}
+
+// mergeConfigOverlay merges the overlay of the config file for the selected
+// environment, if any, over the config.  The overlay must exist, so that a
+// mistyped environment is not silently ignored.
+func mergeConfigOverlay() error {
+	if configEnv == "" {
+		return nil
+	}
+	overlay := configOverlayPath(viper.ConfigFileUsed())
+	fp, err := os.Open(overlay)
+	if err != nil {
+		return fmt.Errorf("reading config for environment %q: %w", configEnv, err)
+	}
+	defer fp.Close()
+	viper.SetConfigType(strings.TrimPrefix(filepath.Ext(overlay), "."))
+	if err := viper.MergeConfig(fp); err != nil {
+		return fmt.Errorf("reading config for environment %q: %w", configEnv, err)
+	}
+	return nil
+}
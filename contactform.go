@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+
+	"github.com/gomarkdown/markdown"
+	"github.com/gomarkdown/markdown/html"
+)
+
+type contactFormConfig struct {
+	// Endpoint is the URL of a static form backend (e.g. Formspree) that
+	// receives the form submissions.
+	Endpoint string `mapstructure:"Endpoint"`
+	// Email is used for a mailto: form when no Endpoint is set.
+	Email string `mapstructure:"Email"`
+	// Output is the path of the generated page, relative to the destination
+	// path.
+	Output string `mapstructure:"Output"`
+	// Intro is markdown text rendered above the form.
+	Intro string `mapstructure:"Intro"`
+	// Honeypot is the name of the hidden field that bots tend to fill in and
+	// the form backend uses to discard spam.
+	Honeypot string `mapstructure:"Honeypot"`
+}
+
+func (c contactFormConfig) enabled() bool {
+	return c.Endpoint != "" || c.Email != ""
+}
+
+const contactFormHTML = `<form class="contact-form" action="{{.Action}}" method="POST"{{if .Mailto}} enctype="text/plain"{{end}}>
+<p><label for="contact-name">Name</label><br>
+<input type="text" id="contact-name" name="name" required></p>
+<p><label for="contact-email">Email</label><br>
+<input type="email" id="contact-email" name="email" required></p>
+<p><label for="contact-message">Message</label><br>
+<textarea id="contact-message" name="message" rows="8" required></textarea></p>
+{{- if not .Mailto}}
+<p style="display:none" aria-hidden="true"><label>Leave this field empty<input type="text" name="{{.Honeypot}}" tabindex="-1" autocomplete="off"></label></p>
+{{- end}}
+<p><button type="submit">Send</button></p>
+</form>
+`
+
+// makeContactForm renders the HTML form element for the contact page.
+func makeContactForm(conf contactFormConfig) (template.HTML, error) {
+	formData := struct {
+		Action   template.URL
+		Mailto   bool
+		Honeypot string
+	}{
+		Action:   template.URL(conf.Endpoint),
+		Honeypot: conf.Honeypot,
+	}
+	if conf.Endpoint == "" {
+		formData.Action = template.URL("mailto:" + conf.Email)
+		formData.Mailto = true
+	}
+
+	t, err := template.New("contactform").Parse(contactFormHTML)
+	if err != nil {
+		return "", err
+	}
+	rendered := new(bytes.Buffer)
+	if err := t.Execute(rendered, formData); err != nil {
+		return "", err
+	}
+	return template.HTML(rendered.String()), nil
+}
+
+// renderContactPage generates the contact page with a form wired to the
+// configured form backend, or a mailto: fallback when no backend is set.
+func renderContactPage(conf siteConfig) error {
+	formConf := conf.ContactForm
+	if !formConf.enabled() {
+		return nil
+	}
+	fmt.Println(":: Generating contact page")
+
+	form, err := makeContactForm(formConf)
+	if err != nil {
+		return fmt.Errorf("generating contact page: %w", err)
+	}
+
+	renderer := html.NewRenderer(html.RendererOptions{})
+	intro := markdown.Render(parseMD([]byte(formConf.Intro)), renderer)
+
+	outpath := filepath.Join(conf.DestinationPath, formConf.Output)
+	outpathpar, _ := filepath.Split(outpath)
+	if err := os.MkdirAll(outpathpar, 0777); err != nil {
+		return fmt.Errorf("generating contact page: creating path %q: %w", outpathpar, err)
+	}
+
+	data := newTemplateData(conf)
+	data.Body = template.HTML(intro) + form
+	data.RelRoot, _ = filepath.Rel(outpathpar, conf.DestinationPath)
+
+	htmlData, err := makeHTML(data, conf.PageTemplateFile, conf)
+	if err != nil {
+		return fmt.Errorf("generating contact page: %w", err)
+	}
+	fmt.Printf("   Saving contact page: %s\n", outpath)
+	if err := os.WriteFile(outpath, htmlData, 0666); err != nil {
+		return fmt.Errorf("generating contact page: writing %q: %w", outpath, err)
+	}
+	return nil
+}
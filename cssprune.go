@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+type cssPruningConfig struct {
+	// Enabled removes the rules of the stylesheets in the destination whose
+	// selectors match no element of the rendered pages.
+	Enabled bool `mapstructure:"Enabled"`
+	// Safelist holds regular expressions of class names, IDs, and element
+	// names to keep even if no page uses them, such as classes added by
+	// scripts.
+	Safelist []string `mapstructure:"Safelist"`
+}
+
+// usedSelectors holds the element names, classes, and IDs that appear in the
+// rendered pages.
+type usedSelectors struct {
+	elements, classes, ids map[string]bool
+	safelist               []*regexp.Regexp
+}
+
+func (u *usedSelectors) addPage(page []byte) {
+	tokenizer := html.NewTokenizer(bytes.NewReader(page))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			u.elements[token.Data] = true
+			for _, attr := range token.Attr {
+				switch attr.Key {
+				case "class":
+					for _, class := range strings.Fields(attr.Val) {
+						u.classes[class] = true
+					}
+				case "id":
+					u.ids[attr.Val] = true
+				}
+			}
+		}
+	}
+}
+
+func (u *usedSelectors) safelisted(name string) bool {
+	for _, re := range u.safelist {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	// selectorNoiseRe matches the parts of a selector that are not
+	// checked: attribute selectors and pseudo-classes and elements with
+	// their arguments.
+	selectorNoiseRe = regexp.MustCompile(`\[[^\]]*\]|::?[a-zA-Z-]+(\([^)]*\))?`)
+	selectorPartRe  = regexp.MustCompile(`([.#]?)((?:[\w-]|\\.)+)`)
+	cssEscapeRe     = regexp.MustCompile(`\\(.)`)
+)
+
+// matches reports whether all the element names, classes, and IDs of a
+// selector appear on the pages.  Since they are not checked against single
+// elements, the result errs on the side of keeping selectors.
+func (u *usedSelectors) matches(selector string) bool {
+	selector = selectorNoiseRe.ReplaceAllString(selector, " ")
+	for _, part := range selectorPartRe.FindAllStringSubmatch(selector, -1) {
+		name := cssEscapeRe.ReplaceAllString(part[2], "$1")
+		if u.safelisted(name) {
+			continue
+		}
+		switch part[1] {
+		case ".":
+			if !u.classes[name] {
+				return false
+			}
+		case "#":
+			if !u.ids[name] {
+				return false
+			}
+		default:
+			if name[0] >= '0' && name[0] <= '9' {
+				// percentages of keyframes and numbers in arguments
+				continue
+			}
+			if !u.elements[strings.ToLower(name)] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// cssSkip returns the index of the last byte of the comment or string
+// starting at css[idx], or idx if none starts there.
+func cssSkip(css string, idx int) int {
+	switch c := css[idx]; {
+	case c == '/' && strings.HasPrefix(css[idx:], "/*"):
+		end := strings.Index(css[idx+2:], "*/")
+		if end < 0 {
+			return len(css) - 1
+		}
+		return idx + end + 3
+	case c == '"' || c == '\'':
+		for idx++; idx < len(css) && css[idx] != c; idx++ {
+			if css[idx] == '\\' {
+				idx++
+			}
+		}
+		return min(idx, len(css)-1)
+	}
+	return idx
+}
+
+// cssStatementEnd returns the index of the first brace or semicolon at or
+// after css[start], skipping comments and strings, or -1 if there is none.
+func cssStatementEnd(css string, start int) int {
+	for idx := start; idx < len(css); idx++ {
+		idx = cssSkip(css, idx)
+		switch css[idx] {
+		case '{', ';', '}':
+			return idx
+		}
+	}
+	return -1
+}
+
+// cssBlockEnd returns the index of the brace closing the block that starts
+// after the opening brace at css[start-1], skipping comments and strings.
+func cssBlockEnd(css string, start int) int {
+	depth := 1
+	for idx := start; idx < len(css); idx++ {
+		idx = cssSkip(css, idx)
+		switch css[idx] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return idx
+			}
+		}
+	}
+	return len(css)
+}
+
+// splitSelectors splits a selector list at the commas outside parentheses,
+// attribute selectors, and strings.
+func splitSelectors(prelude string) []string {
+	var selectors []string
+	depth, start := 0, 0
+	for idx := 0; idx < len(prelude); idx++ {
+		idx = cssSkip(prelude, idx)
+		switch prelude[idx] {
+		case '(', '[':
+			depth++
+		case ')', ']':
+			depth--
+		case ',':
+			if depth == 0 {
+				selectors = append(selectors, prelude[start:idx])
+				start = idx + 1
+			}
+		}
+	}
+	return append(selectors, prelude[start:])
+}
+
+// conditionalAtRules are the at-rules whose blocks hold style rules, which
+// are pruned like the rules at the top level.
+var conditionalAtRules = []string{"@media", "@supports", "@layer", "@container", "@document"}
+
+// pruneCSS removes the style rules whose selectors are all unused and the
+// unused selectors of the other rules.  Other at-rules, such as @font-face
+// and @keyframes, are kept.
+func pruneCSS(css string, used *usedSelectors) string {
+	var out strings.Builder
+	for idx := 0; idx < len(css); {
+		open := cssStatementEnd(css, idx)
+		if open < 0 {
+			out.WriteString(css[idx:])
+			break
+		}
+		prelude := css[idx:open]
+		trimmed := strings.TrimSpace(stripCSSComments(prelude))
+		if css[open] != '{' {
+			// statements like @import, and stray closing braces
+			out.WriteString(css[idx : open+1])
+			idx = open + 1
+			continue
+		}
+		end := cssBlockEnd(css, open+1)
+		block := css[open+1 : min(end, len(css))]
+		idx = end + 1
+
+		if strings.HasPrefix(trimmed, "@") {
+			conditional := false
+			for _, rule := range conditionalAtRules {
+				conditional = conditional || strings.HasPrefix(trimmed, rule)
+			}
+			if !conditional {
+				out.WriteString(prelude + "{" + block + "}")
+				continue
+			}
+			if pruned := pruneCSS(block, used); strings.TrimSpace(stripCSSComments(pruned)) != "" {
+				out.WriteString(prelude + "{" + pruned + "}")
+			}
+			continue
+		}
+
+		var kept []string
+		for _, selector := range splitSelectors(trimmed) {
+			if used.matches(selector) {
+				kept = append(kept, strings.TrimSpace(selector))
+			}
+		}
+		if len(kept) > 0 {
+			out.WriteString(strings.Join(kept, ",") + "{" + block + "}")
+		}
+	}
+	return out.String()
+}
+
+var cssCommentRe = regexp.MustCompile(`(?s)/\*.*?\*/`)
+
+func stripCSSComments(css string) string {
+	return cssCommentRe.ReplaceAllString(css, "")
+}
+
+// pruneStylesheets removes the unused rules of the stylesheets in the
+// destination, judged by the elements, classes, and IDs of its pages.
+func pruneStylesheets(conf siteConfig) error {
+	if !conf.CSSPruning.Enabled {
+		return nil
+	}
+	used := &usedSelectors{elements: map[string]bool{}, classes: map[string]bool{}, ids: map[string]bool{}}
+	for idx, pattern := range conf.CSSPruning.Safelist {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("compiling CSSPruning.Safelist[%d]: %w", idx, err)
+		}
+		used.safelist = append(used.safelist, re)
+	}
+
+	var stylesheets []string
+	walker := func(loc string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		switch filepath.Ext(loc) {
+		case ".html":
+			page, err := os.ReadFile(loc)
+			if err != nil {
+				return err
+			}
+			used.addPage(page)
+		case ".css":
+			stylesheets = append(stylesheets, loc)
+		}
+		return nil
+	}
+	if err := filepath.Walk(conf.DestinationPath, walker); err != nil {
+		return fmt.Errorf("pruning stylesheets: %w", err)
+	}
+
+	fmt.Println(":: Pruning stylesheets")
+	for _, loc := range stylesheets {
+		css, err := os.ReadFile(loc)
+		if err != nil {
+			return fmt.Errorf("pruning stylesheets: %w", err)
+		}
+		pruned := pruneCSS(string(css), used)
+		fmt.Printf("   %s: %d -> %d bytes\n", loc, len(css), len(pruned))
+		if err := os.WriteFile(loc, []byte(pruned), 0666); err != nil {
+			return fmt.Errorf("pruning stylesheets: writing %q: %w", loc, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// dashboardConfig configures the publishing dashboard: a private page
+// summarizing the state of the content to help plan writing.  It is written
+// outside the destination, so it is never published or indexed.
+type dashboardConfig struct {
+	Enabled bool `mapstructure:"Enabled"`
+	// Output is the file the dashboard is written to.  It defaults to
+	// <DestinationPath>.dashboard.html.
+	Output string `mapstructure:"Output"`
+	// StaleYears is the age, in years since the last edit, of stale posts.
+	StaleYears int `mapstructure:"StaleYears"`
+}
+
+// dashboardEntry is a page listed on the dashboard.
+type dashboardEntry struct {
+	Title  string
+	Source string
+	// URL is the URL of the page relative to the site root.
+	URL  string
+	Date string
+}
+
+type dashboardMonth struct {
+	Month     string
+	Published int
+	Scheduled int
+}
+
+type dashboardData struct {
+	RelRoot        string
+	StaleYears     int
+	Drafts         []dashboardEntry
+	Scheduled      []dashboardEntry
+	Stale          []dashboardEntry
+	MissingTags    []dashboardEntry
+	MissingSummary []dashboardEntry
+	Calendar       []dashboardMonth
+}
+
+const dashboardHTML = `<h1>Dashboard</h1>
+{{- define "entries"}}
+{{- if .}}
+<ul>
+{{- range .}}
+<li>{{if .URL}}<a href="{{.URL}}">{{.Title}}</a>{{else}}{{.Title}}{{end}} <code>{{.Source}}</code>{{if .Date}} ({{.Date}}){{end}}</li>
+{{- end}}
+</ul>
+{{- else}}
+<p>None.</p>
+{{- end}}
+{{- end}}
+<h2>Calendar</h2>
+<table class="dashboard-calendar">
+<tr><th>Month</th><th>Published</th><th>Scheduled</th></tr>
+{{- range .Calendar}}
+<tr><td>{{.Month}}</td><td>{{.Published}}</td><td>{{.Scheduled}}</td></tr>
+{{- end}}
+</table>
+<h2>Drafts</h2>
+{{- template "entries" .Drafts}}
+<h2>Scheduled posts</h2>
+{{- template "entries" .Scheduled}}
+<h2>Stale posts (not edited in {{.StaleYears}} years)</h2>
+{{- template "entries" .Stale}}
+<h2>Posts without tags</h2>
+{{- template "entries" .MissingTags}}
+<h2>Posts without a summary</h2>
+{{- template "entries" .MissingSummary}}
+`
+
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(dashboardHTML))
+
+// dashboardOutput returns the path of the dashboard.
+func dashboardOutput(conf siteConfig) string {
+	if conf.Dashboard.Output != "" {
+		return conf.Dashboard.Output
+	}
+	return strings.TrimSuffix(conf.DestinationPath, "/") + ".dashboard.html"
+}
+
+// collectDashboard classifies the sources of the site, including drafts, as
+// of now.  Entries link to their pages relative to the dashboard.
+func collectDashboard(conf siteConfig, now time.Time) (dashboardData, error) {
+	outfile := dashboardOutput(conf)
+	relRoot, _ := filepath.Rel(filepath.Dir(absPath(outfile)), absPath(conf.DestinationPath))
+	data := dashboardData{RelRoot: filepath.ToSlash(relRoot), StaleYears: conf.Dashboard.StaleYears}
+
+	pagesmd, err := collectMarkdownFiles(conf.SourcePath)
+	if err != nil {
+		return data, err
+	}
+	patterns, err := compileContentPatterns(conf)
+	if err != nil {
+		return data, err
+	}
+	staleBefore := now.AddDate(-conf.Dashboard.StaleYears, 0, 0)
+	published := map[string]int{}
+	scheduled := map[string]int{}
+	for _, fname := range pagesmd {
+		pagemd, _, err := readSource(fname)
+		if err != nil {
+			return data, err
+		}
+		front, _, err := pageFrontMatter(fname, pagemd, conf)
+		if err != nil {
+			return data, fmt.Errorf("reading file %q: %w", fname, err)
+		}
+		info := parsePost(pagemd)
+		if info.title == "" {
+			info.title = titleFromFilename(fname)
+		}
+		entry := dashboardEntry{Title: info.title, Source: fname}
+		draft, err := isDraft(fname, conf)
+		if err != nil {
+			return data, err
+		}
+		if draft {
+			data.Drafts = append(data.Drafts, entry)
+			continue
+		}
+		entry.URL = conf.pageLink(data.RelRoot, siteURL(outputPath(fname, conf), conf))
+		if patterns.kind(fname) != kindPost {
+			continue
+		}
+
+		metadata, err := readPostMetadata(fname)
+		if err != nil {
+			return data, err
+		}
+		posted, lastEdit := front.Date.Time, front.Date.Time
+		tags := front.Tags
+		if metadata != nil {
+			if !metadata.DatePosted.IsZero() {
+				posted, lastEdit = metadata.DatePosted, metadata.DatePosted
+			}
+			for _, edited := range metadata.DatesEdited {
+				if edited.After(lastEdit) {
+					lastEdit = edited
+				}
+			}
+			tags = mergeTags(tags, metadata.Tags)
+		}
+		if !posted.IsZero() {
+			entry.Date = posted.Format(time.DateOnly)
+		}
+		switch {
+		case posted.After(now):
+			data.Scheduled = append(data.Scheduled, entry)
+			scheduled[posted.Format("2006-01")]++
+		case !posted.IsZero():
+			published[posted.Format("2006-01")]++
+			if lastEdit.Before(staleBefore) {
+				stale := entry
+				stale.Date = "last edited " + lastEdit.Format(time.DateOnly)
+				data.Stale = append(data.Stale, stale)
+			}
+		}
+		if len(tags) == 0 {
+			data.MissingTags = append(data.MissingTags, entry)
+		}
+		if strings.TrimSpace(info.summary) == "" {
+			data.MissingSummary = append(data.MissingSummary, entry)
+		}
+	}
+	sort.SliceStable(data.Scheduled, func(i, j int) bool { return data.Scheduled[i].Date < data.Scheduled[j].Date })
+	sort.SliceStable(data.Stale, func(i, j int) bool { return data.Stale[i].Date < data.Stale[j].Date })
+
+	// the calendar covers the past year and the months of scheduled posts
+	first := time.Date(now.Year(), now.Month()-11, 1, 0, 0, 0, 0, now.Location())
+	last := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	for month := range scheduled {
+		if m, err := time.Parse("2006-01", month); err == nil && m.After(last) {
+			last = m
+		}
+	}
+	for month := first; !month.After(last); month = month.AddDate(0, 1, 0) {
+		key := month.Format("2006-01")
+		data.Calendar = append(data.Calendar, dashboardMonth{Month: key, Published: published[key], Scheduled: scheduled[key]})
+	}
+	return data, nil
+}
+
+// renderDashboard writes the publishing dashboard with the page template of
+// the site.
+func renderDashboard(conf siteConfig) error {
+	if !conf.Dashboard.Enabled {
+		return nil
+	}
+	outfile := dashboardOutput(conf)
+	fmt.Printf(":: Generating dashboard %s\n", outfile)
+	dash, err := collectDashboard(conf, time.Now())
+	if err != nil {
+		return fmt.Errorf("generating dashboard: %w", err)
+	}
+	fmt.Printf("   %d draft%s, %d scheduled, %d stale, %d without tags, %d without a summary\n", len(dash.Drafts), plural(len(dash.Drafts)), len(dash.Scheduled), len(dash.Stale), len(dash.MissingTags), len(dash.MissingSummary))
+
+	body := new(bytes.Buffer)
+	if err := dashboardTemplate.Execute(body, dash); err != nil {
+		return fmt.Errorf("generating dashboard: %w", err)
+	}
+	data := newTemplateData(conf)
+	data.Body = template.HTML(body.String())
+	data.Page = frontMatter{Title: "Dashboard"}
+	data.RelRoot = dash.RelRoot
+	page, err := makeHTML(data, conf.PageTemplateFile, conf)
+	if err != nil {
+		return fmt.Errorf("generating dashboard: %w", err)
+	}
+	if err := os.WriteFile(outfile, page, 0666); err != nil {
+		return fmt.Errorf("generating dashboard: writing %q: %w", outfile, err)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template/parse"
+)
+
+// templateMarkFunc is the template function that prints the comments marking
+// the output of each template in template debug mode.
+const templateMarkFunc = "statikoTemplateMark"
+
+// templateMark returns the comment marking the beginning or end of the output
+// of a template defined in file.
+func templateMark(edge, name, file string) template.HTML {
+	desc := file
+	if name != file {
+		desc = fmt.Sprintf("%q from %s", name, file)
+	}
+	// "--" would end the comment early
+	desc = strings.ReplaceAll(desc, "--", "- -")
+	return template.HTML(fmt.Sprintf("<!-- %s %s -->", edge, desc))
+}
+
+// doctypeRe matches the document type declaration at the start of a
+// template, which must stay in front of the marks to keep browsers out of
+// quirks mode.
+var doctypeRe = regexp.MustCompile(`(?i)^\s*<!doctype[^>]*>`)
+
+// parseNodes parses template text into nodes that can be inserted into the
+// parse tree of another template.
+func parseNodes(text string) ([]parse.Node, error) {
+	trees, err := parse.Parse("mark", text, "", "", map[string]any{templateMarkFunc: templateMark})
+	if err != nil {
+		return nil, err
+	}
+	return trees["mark"].Root.Nodes, nil
+}
+
+// templateMarkNode returns a parsed call of the template mark function, to be
+// inserted into the parse tree of a template.
+func templateMarkNode(edge, name, file string) (parse.Node, error) {
+	call := fmt.Sprintf("{{%s %s %s %s}}", templateMarkFunc, strconv.Quote(edge), strconv.Quote(name), strconv.Quote(file))
+	nodes, err := parseNodes(call)
+	if err != nil {
+		return nil, err
+	}
+	return nodes[0], nil
+}
+
+// annotateTemplates surrounds the output of each template, including the
+// templates defined with define and block, with HTML comments naming the
+// template and the file that defines it.  It must be called before the
+// template is executed.
+func annotateTemplates(t *template.Template) (*template.Template, error) {
+	for _, tmpl := range t.Templates() {
+		if tmpl.Tree == nil || tmpl.Tree.Root == nil {
+			continue
+		}
+		begin, err := templateMarkNode("begin", tmpl.Name(), tmpl.Tree.ParseName)
+		if err != nil {
+			return nil, err
+		}
+		end, err := templateMarkNode("end", tmpl.Name(), tmpl.Tree.ParseName)
+		if err != nil {
+			return nil, err
+		}
+		root := tmpl.Tree.Root
+		var doctype []parse.Node
+		if text, ok := firstText(root); ok {
+			if loc := doctypeRe.FindIndex(text.Text); loc != nil {
+				if doctype, err = parseNodes(string(text.Text[:loc[1]])); err != nil {
+					return nil, err
+				}
+				text.Text = text.Text[loc[1]:]
+			}
+		}
+		nodes := append(doctype, begin)
+		root.Nodes = append(append(nodes, root.Nodes...), end)
+	}
+	return t.Funcs(template.FuncMap{templateMarkFunc: templateMark}), nil
+}
+
+// firstText returns the text node a template starts with, if any.
+func firstText(root *parse.ListNode) (*parse.TextNode, bool) {
+	if len(root.Nodes) == 0 {
+		return nil, false
+	}
+	text, ok := root.Nodes[0].(*parse.TextNode)
+	return text, ok
+}
+
+// templateDataPath returns the location of the template data dump of a page:
+// a tree parallel to DestinationPath, so that the dumps are not published.
+func templateDataPath(outpath string, conf siteConfig) string {
+	return filepath.Join(filepath.Clean(conf.DestinationPath)+".debug", filepath.FromSlash(siteURL(outpath, conf))+".json")
+}
+
+// writeTemplateData saves the data a page template was executed with as JSON.
+func writeTemplateData(outpath string, data templateData, conf siteConfig) error {
+	dump := new(bytes.Buffer)
+	encoder := json.NewEncoder(dump)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(data); err != nil {
+		return fmt.Errorf("encoding template data of %q: %w", outpath, err)
+	}
+	dumppath := templateDataPath(outpath, conf)
+	if err := os.MkdirAll(filepath.Dir(dumppath), 0777); err != nil {
+		return fmt.Errorf("creating path %q: %w", filepath.Dir(dumppath), err)
+	}
+	if err := os.WriteFile(dumppath, dump.Bytes(), 0666); err != nil {
+		return fmt.Errorf("writing template data %q: %w", dumppath, err)
+	}
+	return nil
+}
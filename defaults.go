@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// defaultsFile is the name of the file in a source directory holding front
+// matter defaults for the pages beneath it.
+const defaultsFile = "_defaults.yaml"
+
+// inherit fills the fields of the front matter that are not set with the
+// values of defaults.  Tags are merged.  A draft default cannot be reset by a
+// page.
+func (fm frontMatter) inherit(defaults frontMatter) frontMatter {
+	fm.Tags = mergeTags(fm.Tags, defaults.Tags)
+	fm.Draft = fm.Draft || defaults.Draft
+	fm.Evergreen = fm.Evergreen || defaults.Evergreen
+	if fm.Title == "" {
+		fm.Title = defaults.Title
+	}
+	if fm.Date.IsZero() {
+		fm.Date = defaults.Date
+	}
+	if fm.Category == "" {
+		fm.Category = defaults.Category
+	}
+	if fm.Template == "" {
+		fm.Template = defaults.Template
+	}
+	if fm.Author == "" {
+		fm.Author = defaults.Author
+	}
+	if fm.Section == "" {
+		fm.Section = defaults.Section
+	}
+	if fm.Image == "" {
+		fm.Image = defaults.Image
+	}
+	if fm.Outputs == nil {
+		fm.Outputs = defaults.Outputs
+	}
+	if fm.Styles == nil {
+		fm.Styles = defaults.Styles
+	}
+	if fm.Scripts == nil {
+		fm.Scripts = defaults.Scripts
+	}
+	if fm.Series == "" {
+		fm.Series = defaults.Series
+	}
+	if fm.Footnotes == "" {
+		fm.Footnotes = defaults.Footnotes
+	}
+	if fm.Audiences == nil {
+		fm.Audiences = defaults.Audiences
+	}
+	return fm
+}
+
+// directoryDefaults returns the front matter defaults for a source file,
+// from the defaults files of its directory and of each parent directory up to
+// the SourcePath.  Values from deeper directories take precedence.
+func directoryDefaults(fname string, conf siteConfig) (frontMatter, error) {
+	var defaults frontMatter
+	rel, err := filepath.Rel(conf.SourcePath, filepath.Dir(fname))
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return defaults, nil
+	}
+	dir := conf.SourcePath
+	dirs := []string{dir}
+	if rel != "." {
+		for _, part := range strings.Split(rel, string(filepath.Separator)) {
+			dir = filepath.Join(dir, part)
+			dirs = append(dirs, dir)
+		}
+	}
+	for _, dir := range dirs {
+		dfname := filepath.Join(dir, defaultsFile)
+		content, err := os.ReadFile(dfname)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return defaults, fmt.Errorf("reading defaults %q: %w", dfname, err)
+		}
+		var dirDefaults frontMatter
+		if err := yaml.Unmarshal(content, &dirDefaults); err != nil {
+			return defaults, fmt.Errorf("parsing defaults %q: %w", dfname, err)
+		}
+		defaults = dirDefaults.inherit(defaults)
+	}
+	return defaults, nil
+}
+
+// pageFrontMatter parses the front matter of a page source and merges it with
+// the defaults of its directories.  It also returns the markdown body.
+func pageFrontMatter(fname string, md []byte, conf siteConfig) (frontMatter, []byte, error) {
+	front, body, err := parseFrontMatter(md)
+	if err != nil {
+		return front, body, err
+	}
+	defaults, err := directoryDefaults(fname, conf)
+	if err != nil {
+		return front, body, err
+	}
+	return front.inherit(defaults), body, nil
+}
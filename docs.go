@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// docsMetadata is read from the metadata file of each documentation page.
+type docsMetadata struct {
+	// Weight orders pages and sections in the sidebar; lower weights come
+	// first.  The weight of a section is the weight of its index page.
+	Weight int `json:"weight"`
+}
+
+// docNode is a page or section in the documentation tree.  Sections without
+// an index page have no URL.
+type docNode struct {
+	title    string
+	url      string
+	weight   int
+	text     string
+	children []*docNode
+}
+
+// docsTree is the navigation structure of the documentation subtree.
+type docsTree struct {
+	root *docNode
+	// order lists the pages in reading order, for previous/next links.
+	order []*docNode
+	// index maps page URLs to their position in order.
+	index map[string]int
+}
+
+// plainText concatenates the literals under a node, separating the text of
+// each leaf with a space.
+func plainText(node ast.Node) string {
+	var words []string
+	visitor := func(node ast.Node, entering bool) ast.WalkStatus {
+		if leaf := node.AsLeaf(); leaf != nil && entering {
+			if text := strings.TrimSpace(string(leaf.Literal)); text != "" {
+				words = append(words, text)
+			}
+		}
+		return ast.GoToNext
+	}
+	ast.WalkFunc(node, visitor)
+	return strings.Join(words, " ")
+}
+
+// collectDocs builds the documentation tree from the source files under the
+// configured DocsPath.
+func collectDocs(pagesmd []string, conf siteConfig) (*docsTree, error) {
+	if conf.DocsPath == "" {
+		return nil, nil
+	}
+	docsroot := filepath.Join(conf.SourcePath, conf.DocsPath)
+	root := &docNode{title: filepath.Base(conf.DocsPath)}
+	sections := map[string]*docNode{".": root}
+
+	// section returns the node for a directory relative to the docs root,
+	// creating it and its parents as needed
+	var section func(dir string) *docNode
+	section = func(dir string) *docNode {
+		if node, ok := sections[dir]; ok {
+			return node
+		}
+		node := &docNode{title: path.Base(dir)}
+		parent := section(path.Dir(dir))
+		parent.children = append(parent.children, node)
+		sections[dir] = node
+		return node
+	}
+
+	for _, fname := range pagesmd {
+		rel, err := filepath.Rel(docsroot, fname)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		pagemd, _, err := readSource(fname)
+		if err != nil {
+			return nil, err
+		}
+		var dm docsMetadata
+		if _, err := readMetadata(fname, &dm); err != nil {
+			return nil, fmt.Errorf("reading docs metadata: %w", err)
+		}
+		p := parsePost(pagemd)
+		node := &docNode{
+			title:  p.title,
+			url:    siteURL(outputPath(fname, conf), conf),
+			weight: dm.Weight,
+			text:   plainText(parseMD(stripFrontMatter(pagemd))),
+		}
+		if node.title == "" {
+			node.title = titleFromFilename(rel)
+		}
+
+		dir := path.Dir(rel)
+		if strings.TrimSuffix(path.Base(rel), path.Ext(rel)) == "index" {
+			// the index page stands for its section
+			sec := section(dir)
+			sec.title, sec.url, sec.weight, sec.text = node.title, node.url, node.weight, node.text
+			continue
+		}
+		parent := section(dir)
+		parent.children = append(parent.children, node)
+	}
+
+	tree := &docsTree{root: root, index: map[string]int{}}
+	var order func(node *docNode)
+	order = func(node *docNode) {
+		sort.SliceStable(node.children, func(i, j int) bool {
+			a, b := node.children[i], node.children[j]
+			if a.weight != b.weight {
+				return a.weight < b.weight
+			}
+			return a.title < b.title
+		})
+		if node.url != "" {
+			tree.index[node.url] = len(tree.order)
+			tree.order = append(tree.order, node)
+		}
+		for _, child := range node.children {
+			order(child)
+		}
+	}
+	order(root)
+	return tree, nil
+}
+
+// contains reports whether the page is part of the documentation tree.
+func (dt *docsTree) contains(pageURL string) bool {
+	if dt == nil {
+		return false
+	}
+	_, ok := dt.index[pageURL]
+	return ok
+}
+
+// sidebar renders the navigation tree as nested lists with links relative to
+// the page with the given URL.  The current page is marked with
+// aria-current.
+func (dt *docsTree) sidebar(pageURL string, conf siteConfig) template.HTML {
+	relroot := relRootOf(pageURL)
+	var b strings.Builder
+	var list func(node *docNode)
+	list = func(node *docNode) {
+		b.WriteString("<ul>\n")
+		for _, child := range node.children {
+			b.WriteString("<li>")
+			title := template.HTMLEscapeString(child.title)
+			switch {
+			case child.url == pageURL:
+				fmt.Fprintf(&b, `<a href="%s" aria-current="page">%s</a>`, conf.pageLink(relroot, child.url), title)
+			case child.url != "":
+				fmt.Fprintf(&b, `<a href="%s">%s</a>`, conf.pageLink(relroot, child.url), title)
+			default:
+				fmt.Fprintf(&b, `<span>%s</span>`, title)
+			}
+			if len(child.children) > 0 {
+				b.WriteString("\n")
+				list(child)
+			}
+			b.WriteString("</li>\n")
+		}
+		b.WriteString("</ul>\n")
+	}
+
+	b.WriteString(`<nav class="docs-sidebar">` + "\n")
+	if dt.root.url != "" {
+		fmt.Fprintf(&b, `<p><a href="%s">%s</a></p>`+"\n", conf.pageLink(relroot, dt.root.url), template.HTMLEscapeString(dt.root.title))
+	}
+	list(dt.root)
+	b.WriteString("</nav>\n")
+	return template.HTML(b.String())
+}
+
+// addPrevNext appends links to the previous and next documentation pages to
+// the end of the page.
+func (dt *docsTree) addPrevNext(doc ast.Node, pageURL string, conf siteConfig) {
+	idx, ok := dt.index[pageURL]
+	if !ok {
+		return
+	}
+	relroot := relRootOf(pageURL)
+	navParagraph := &ast.Paragraph{}
+	addLink := func(node *docNode, label string) {
+		link := &ast.Link{Destination: []byte(conf.pageLink(relroot, node.url))}
+		ast.AppendChild(link, &ast.Text{
+			Leaf: ast.Leaf{
+				Literal: []byte(label),
+			},
+		})
+		ast.AppendChild(navParagraph, link)
+	}
+	if idx > 0 {
+		addLink(dt.order[idx-1], "← "+dt.order[idx-1].title)
+	}
+	if idx+1 < len(dt.order) {
+		if idx > 0 {
+			ast.AppendChild(navParagraph, &ast.Text{Leaf: ast.Leaf{Literal: []byte(" | ")}})
+		}
+		addLink(dt.order[idx+1], dt.order[idx+1].title+" →")
+	}
+	if len(navParagraph.GetChildren()) == 0 {
+		return
+	}
+	ast.AppendChild(doc, &ast.HorizontalRule{})
+	ast.AppendChild(doc, navParagraph)
+}
+
+// writeSearchIndex writes a JSON index of the titles, URLs, and text of all
+// documentation pages to search.json in the documentation output directory,
+// for client-side search in themes.
+func (dt *docsTree) writeSearchIndex(conf siteConfig) error {
+	type searchEntry struct {
+		Title string `json:"title"`
+		URL   string `json:"url"`
+		Text  string `json:"text"`
+	}
+	entries := make([]searchEntry, len(dt.order))
+	for idx, node := range dt.order {
+		entries[idx] = searchEntry{Title: node.title, URL: node.url, Text: node.text}
+	}
+	out, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("encoding docs search index: %w", err)
+	}
+	outdir := filepath.Join(conf.DestinationPath, conf.DocsPath)
+	if err := os.MkdirAll(outdir, 0777); err != nil {
+		return fmt.Errorf("creating path %q: %w", outdir, err)
+	}
+	outpath := filepath.Join(outdir, "search.json")
+	fmt.Printf("   Saving docs search index: %s\n", outpath)
+	if err := os.WriteFile(outpath, out, 0666); err != nil {
+		return fmt.Errorf("writing docs search index %q: %w", outpath, err)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+)
+
+// draftMetadata is read from the metadata file of each page.
+type draftMetadata struct {
+	Draft bool `json:"draft"`
+}
+
+// isDraft reports whether a page is marked as a draft in its front matter,
+// the defaults of its directory, or its metadata file.
+func isDraft(fname string, conf siteConfig) (bool, error) {
+	pagemd, _, err := readSource(fname)
+	if err != nil {
+		return false, err
+	}
+	front, _, err := pageFrontMatter(fname, pagemd, conf)
+	if err != nil {
+		return false, fmt.Errorf("reading file %q: %w", fname, err)
+	}
+	if front.Draft {
+		return true, nil
+	}
+	dm := draftMetadata{}
+	if _, err := readMetadata(fname, &dm); err != nil {
+		return false, fmt.Errorf("reading draft metadata: %w", err)
+	}
+	return dm.Draft, nil
+}
+
+// excludeDrafts separates the draft pages from the list of sources, unless
+// the config includes drafts.
+func excludeDrafts(pagesmd []string, conf siteConfig) (published, drafts []string, err error) {
+	if conf.Drafts {
+		return pagesmd, nil, nil
+	}
+	published = make([]string, 0, len(pagesmd))
+	for _, fname := range pagesmd {
+		draft, err := isDraft(fname, conf)
+		if err != nil {
+			return nil, nil, err
+		}
+		if draft {
+			drafts = append(drafts, fname)
+			continue
+		}
+		published = append(published, fname)
+	}
+	return published, drafts, nil
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// emailAttachment is a file attached to an email.  Inline images of HTML
+// emails have a content ID, which the HTML refers to with cid: URLs.
+type emailAttachment struct {
+	name      string
+	contentID string
+	content   []byte
+}
+
+// email is a message read for import.
+type email struct {
+	subject     string
+	from        string
+	date        time.Time
+	text        []byte
+	html        []byte
+	attachments []emailAttachment
+}
+
+// mimeHeader is the header of a message or of a part of a multipart message.
+type mimeHeader interface {
+	Get(key string) string
+}
+
+// emailWordDecoder decodes the encoded words of headers.  Charsets other than
+// UTF-8 are read like sources that are not valid UTF-8.
+var emailWordDecoder = &mime.WordDecoder{
+	CharsetReader: func(charset string, input io.Reader) (io.Reader, error) {
+		content, err := io.ReadAll(input)
+		if err != nil {
+			return nil, err
+		}
+		text, _ := toUTF8(content)
+		return bytes.NewReader(text), nil
+	},
+}
+
+// splitMbox splits an mbox file into its messages.  Lines of the body
+// starting with From are quoted with > in mbox files, which is undone.
+func splitMbox(content []byte) [][]byte {
+	var messages [][]byte
+	var current []byte
+	started := false
+	for _, line := range bytes.SplitAfter(content, []byte("\n")) {
+		if bytes.HasPrefix(line, []byte("From ")) {
+			if started {
+				messages = append(messages, current)
+			}
+			current, started = nil, true
+			continue
+		}
+		if !started {
+			continue
+		}
+		if unquoted := bytes.TrimLeft(line, ">"); len(unquoted) < len(line) && bytes.HasPrefix(unquoted, []byte("From ")) {
+			line = line[1:]
+		}
+		current = append(current, line...)
+	}
+	if started {
+		messages = append(messages, current)
+	}
+	return messages
+}
+
+// decodeTransfer returns the reader of a part body without its content
+// transfer encoding.
+func decodeTransfer(header mimeHeader, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(header.Get("Content-Transfer-Encoding"))) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	}
+	return body
+}
+
+// readPart adds the text, HTML, and attachments of a part of a message, and
+// of the parts nested in it, to the email.  The first text and HTML parts
+// that are not attachments are the body of the email.
+func (em *email) readPart(header mimeHeader, body io.Reader) error {
+	mediatype, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediatype, params = "text/plain", nil
+	}
+	if strings.HasPrefix(mediatype, "multipart/") {
+		parts := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := parts.NextRawPart()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := em.readPart(part.Header, part); err != nil {
+				return err
+			}
+		}
+	}
+	content, err := io.ReadAll(decodeTransfer(header, body))
+	if err != nil {
+		return err
+	}
+
+	disposition, dparams, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	name := dparams["filename"]
+	if name == "" {
+		name = params["name"]
+	}
+	if name, err = emailWordDecoder.DecodeHeader(name); err != nil {
+		return err
+	}
+	contentID := strings.Trim(header.Get("Content-ID"), "<> ")
+	switch {
+	case disposition != "attachment" && name == "" && mediatype == "text/plain" && em.text == nil:
+		em.text, _ = toUTF8(content)
+	case disposition != "attachment" && name == "" && mediatype == "text/html" && em.html == nil:
+		em.html, _ = toUTF8(content)
+	case name != "" || contentID != "":
+		if name == "" {
+			// unnamed inline images are named after their content ID
+			exts, _ := mime.ExtensionsByType(mediatype)
+			name = slugify(contentID)
+			if len(exts) > 0 {
+				name += exts[0]
+			}
+		}
+		em.attachments = append(em.attachments, emailAttachment{name: path.Base(filepath.ToSlash(name)), contentID: contentID, content: content})
+	}
+	return nil
+}
+
+// parseEmail reads a message.
+func parseEmail(raw []byte) (email, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return email{}, err
+	}
+	var em email
+	if em.subject, err = emailWordDecoder.DecodeHeader(msg.Header.Get("Subject")); err != nil {
+		return email{}, fmt.Errorf("decoding subject: %w", err)
+	}
+	if em.from, err = emailWordDecoder.DecodeHeader(msg.Header.Get("From")); err != nil {
+		return email{}, fmt.Errorf("decoding sender: %w", err)
+	}
+	if em.date, err = msg.Header.Date(); err != nil {
+		return email{}, fmt.Errorf("reading date: %w", err)
+	}
+	if err := em.readPart(msg.Header, msg.Body); err != nil {
+		return email{}, fmt.Errorf("reading body: %w", err)
+	}
+	return em, nil
+}
+
+// readEmails reads the messages of an .eml file, or of an mbox file.
+func readEmails(fname string) ([]email, error) {
+	content, err := os.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	raws := [][]byte{content}
+	if !strings.EqualFold(filepath.Ext(fname), ".eml") && bytes.HasPrefix(content, []byte("From ")) {
+		raws = splitMbox(content)
+	}
+	emails := make([]email, 0, len(raws))
+	for idx, raw := range raws {
+		em, err := parseEmail(raw)
+		if err != nil {
+			return nil, fmt.Errorf("reading message %d of %q: %w", idx+1, fname, err)
+		}
+		emails = append(emails, em)
+	}
+	return emails, nil
+}
+
+var (
+	// htmlBodyRe matches the body of an HTML document.
+	htmlBodyRe = regexp.MustCompile(`(?is)<body[^>]*>(.*)</body>`)
+	// cidRe matches the cid: URLs of inline images.
+	cidRe = regexp.MustCompile(`cid:([^"'\s)>]+)`)
+)
+
+// emailImport converts emails into posts.
+type emailImport struct {
+	// dir is the directory the posts are written to, prefix the date layout
+	// of their file names, and attachmentsdir the directory the attachments
+	// are saved to, in a directory per post.
+	dir            string
+	prefix         string
+	attachmentsdir string
+	frontMatter    bool
+	conf           siteConfig
+}
+
+// postBody returns the markdown body of the post of an email and saves its
+// attachments.  Plain text bodies are taken as markdown; HTML bodies, used
+// when there is no plain text, are kept as raw HTML.
+func (imp emailImport) postBody(em email, fname string) ([]byte, error) {
+	relroot := relRootOf(siteURL(outputPath(fname, imp.conf), imp.conf))
+	stem := strings.TrimSuffix(filepath.Base(fname), filepath.Ext(fname))
+	outdir := filepath.Join(imp.attachmentsdir, stem)
+	// urls maps the content IDs of inline images to their URLs
+	urls := map[string]string{}
+	var saved []pageLink
+	for _, att := range em.attachments {
+		if err := os.MkdirAll(outdir, 0777); err != nil {
+			return nil, fmt.Errorf("creating path %q: %w", outdir, err)
+		}
+		loc := filepath.Join(outdir, att.name)
+		fmt.Printf("   %s\n", loc)
+		if err := os.WriteFile(loc, att.content, 0666); err != nil {
+			return nil, fmt.Errorf("writing attachment %q: %w", loc, err)
+		}
+		url := path.Join(relroot, filepath.ToSlash(loc))
+		if att.contentID != "" {
+			urls[att.contentID] = url
+		}
+		saved = append(saved, pageLink{Title: att.name, URL: url})
+	}
+
+	// inline lists the URLs of the images shown in the HTML body, which are
+	// not listed with the other attachments
+	inline := map[string]bool{}
+	var body []byte
+	switch {
+	case em.text != nil:
+		body = bytes.ReplaceAll(em.text, []byte("\r\n"), []byte("\n"))
+	case em.html != nil:
+		html := em.html
+		if match := htmlBodyRe.FindSubmatch(html); match != nil {
+			html = match[1]
+		}
+		html = cidRe.ReplaceAllFunc(html, func(cid []byte) []byte {
+			if url, ok := urls[string(cidRe.FindSubmatch(cid)[1])]; ok {
+				inline[url] = true
+				return []byte(url)
+			}
+			return cid
+		})
+		body = []byte(fmt.Sprintf("<div class=\"email\">\n%s\n</div>\n", bytes.TrimSpace(html)))
+	}
+	var links []string
+	for _, att := range saved {
+		if !inline[att.URL] {
+			links = append(links, fmt.Sprintf("- [%s](%s)", att.Title, att.URL))
+		}
+	}
+	if len(links) > 0 {
+		body = append(bytes.TrimRight(body, "\n"), []byte("\n\n## Attachments\n\n"+strings.Join(links, "\n")+"\n")...)
+	}
+	return body, nil
+}
+
+// importEmail writes the post of an email.  Emails whose post exists are
+// skipped, so an mbox can be imported again after new messages arrive.
+func (imp emailImport) importEmail(em email) (bool, error) {
+	title := strings.TrimSpace(em.subject)
+	fname, err := postPath(title, imp.dir, imp.prefix, em.date)
+	if err != nil {
+		return false, err
+	}
+	if _, err := os.Stat(fname); err == nil {
+		fmt.Printf("   Skipping %q: %s %v\n", title, fname, errPostExists)
+		return false, nil
+	}
+	fmt.Printf("   %q -> %s\n", title, fname)
+	body, err := imp.postBody(em, fname)
+	if err != nil {
+		return false, err
+	}
+	if _, err := createPost(title, body, imp.dir, imp.prefix, em.date, imp.frontMatter, imp.conf); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// runImportEmail converts emails from .eml and mbox files into posts, with
+// the dates of the emails as posted dates and their attachments saved to the
+// resources.
+func runImportEmail(args []string) error {
+	flags := flag.NewFlagSet("import-email", flag.ExitOnError)
+	dir := flags.String("dir", "", "directory, relative to the source path, to create the posts in")
+	prefix := flags.String("prefix", "20060102-", "Go time layout of the date prefix of the file names")
+	frontMatterDate := flags.Bool("front-matter", false, "set the dates in YAML front matter instead of the metadata files")
+	attachments := flags.String("attachments", "attachments", "directory, relative to the resource path, to save attachments to")
+	from := flags.String("from", "", "import only emails whose sender contains this text")
+	subject := flags.String("subject", "", "import only emails whose subject matches this regular expression")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: statiko import-email [options] <file.eml|mbox>...\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return fmt.Errorf("import-email: expected at least one .eml or mbox file")
+	}
+	subjectRe, err := regexp.Compile(*subject)
+	if err != nil {
+		return fmt.Errorf("import-email: compiling -subject: %w", err)
+	}
+
+	conf, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	imp := emailImport{
+		dir:            filepath.Join(conf.SourcePath, *dir),
+		prefix:         *prefix,
+		attachmentsdir: filepath.Join(conf.ResourcePath, *attachments),
+		frontMatter:    *frontMatterDate,
+		conf:           conf,
+	}
+	var imported int
+	for _, fname := range flags.Args() {
+		fmt.Printf(":: Importing emails from %s\n", fname)
+		emails, err := readEmails(argPath(fname))
+		if err != nil {
+			return fmt.Errorf("import-email: %w", err)
+		}
+		for _, em := range emails {
+			if !strings.Contains(strings.ToLower(em.from), strings.ToLower(*from)) || !subjectRe.MatchString(em.subject) {
+				continue
+			}
+			created, err := imp.importEmail(em)
+			if err != nil {
+				return fmt.Errorf("import-email: %q: %w", em.subject, err)
+			}
+			if created {
+				imported++
+			}
+		}
+	}
+	fmt.Printf("   Imported %d email%s\n", imported, plural(imported))
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Byte order marks of the encodings detected in sources.
+var (
+	bomUTF8    = []byte{0xef, 0xbb, 0xbf}
+	bomUTF16LE = []byte{0xff, 0xfe}
+	bomUTF16BE = []byte{0xfe, 0xff}
+)
+
+// cp1252 maps the bytes 0x80 to 0x9f of Windows-1252, the superset of
+// Latin-1 that most "Latin-1" files actually use, to runes.  The other bytes
+// map to the rune of the same value.
+var cp1252 = [32]rune{
+	'€', 0x81, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0x8d, 'Ž', 0x8f,
+	0x90, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0x9d, 'ž', 'Ÿ',
+}
+
+// decodeUTF16 decodes UTF-16 text without its byte order mark.
+func decodeUTF16(src []byte, bigEndian bool) []byte {
+	units := make([]uint16, len(src)/2)
+	for idx := range units {
+		lo, hi := src[2*idx], src[2*idx+1]
+		if bigEndian {
+			lo, hi = hi, lo
+		}
+		units[idx] = uint16(hi)<<8 | uint16(lo)
+	}
+	return []byte(string(utf16.Decode(units)))
+}
+
+// decodeCP1252 decodes Windows-1252 text.
+func decodeCP1252(src []byte) []byte {
+	out := make([]byte, 0, len(src)+len(src)/8)
+	for _, b := range src {
+		r := rune(b)
+		if b >= 0x80 && b < 0xa0 {
+			r = cp1252[b-0x80]
+		}
+		out = utf8.AppendRune(out, r)
+	}
+	return out
+}
+
+// toUTF8 converts source text to UTF-8 without a byte order mark.  It detects
+// UTF-8 and UTF-16 by their byte order marks and treats other text that is
+// not valid UTF-8 as Windows-1252.  The returned encoding names the detected
+// encoding of converted text and is empty for plain UTF-8.
+func toUTF8(src []byte) (text []byte, encoding string) {
+	switch {
+	case bytes.HasPrefix(src, bomUTF8):
+		return src[len(bomUTF8):], "UTF-8 with BOM"
+	case bytes.HasPrefix(src, bomUTF16LE):
+		return decodeUTF16(src[len(bomUTF16LE):], false), "UTF-16LE"
+	case bytes.HasPrefix(src, bomUTF16BE):
+		return decodeUTF16(src[len(bomUTF16BE):], true), "UTF-16BE"
+	case !utf8.Valid(src):
+		return decodeCP1252(src), "Latin-1"
+	}
+	return src, ""
+}
+
+// readSource reads a markdown source and converts it to UTF-8.  The returned
+// encoding is empty if the file needed no conversion.
+func readSource(fname string) ([]byte, string, error) {
+	src, err := os.ReadFile(fname)
+	if err != nil {
+		return nil, "", fmt.Errorf("reading file %q: %w", fname, err)
+	}
+	text, encoding := toUTF8(src)
+	return text, encoding, nil
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gomarkdown/markdown/ast"
+	"github.com/gomarkdown/markdown/html"
+)
+
+// eventMetadata is read from the metadata file of each event.
+type eventMetadata struct {
+	Start    time.Time `json:"start"`
+	Duration string    `json:"duration"`
+	Location string    `json:"location"`
+}
+
+type event struct {
+	title    string
+	summary  string
+	url      string
+	start    time.Time
+	duration time.Duration
+	location string
+	// modified is the modification time of the source, used as the
+	// timestamp of the event in the calendar so that unchanged events export
+	// identically on every build.
+	modified time.Time
+}
+
+func (ev event) end() time.Time {
+	return ev.start.Add(ev.duration)
+}
+
+// when formats the date and time span of the event for display.
+func (ev event) when() string {
+	const dateFmt = "Mon 02 Jan 2006 15:04"
+	if ev.duration == 0 {
+		return ev.start.Format(dateFmt)
+	}
+	end := ev.end()
+	if end.YearDay() == ev.start.YearDay() && end.Year() == ev.start.Year() {
+		return fmt.Sprintf("%s–%s", ev.start.Format(dateFmt), end.Format("15:04"))
+	}
+	return fmt.Sprintf("%s – %s", ev.start.Format(dateFmt), end.Format(dateFmt))
+}
+
+// newEvent reads the details of an event from its source and metadata file.
+// Events require a metadata file with at least the start time.
+func newEvent(fname, url string, mdsource []byte) (event, error) {
+	p := parsePost(mdsource)
+	if p.title == "" {
+		p.title = titleFromFilename(fname)
+	}
+	ev := event{title: p.title, summary: p.summary, url: url}
+
+	var em eventMetadata
+	found, err := readMetadata(fname, &em)
+	if err != nil {
+		return ev, fmt.Errorf("reading event metadata: %w", err)
+	}
+	if !found || em.Start.IsZero() {
+		return ev, fmt.Errorf("event %q has no start time in %q", fname, metadataPath(fname))
+	}
+	ev.start = em.Start
+	ev.location = em.Location
+	if info, err := os.Stat(fname); err == nil {
+		ev.modified = info.ModTime()
+	}
+	if em.Duration != "" {
+		ev.duration, err = time.ParseDuration(em.Duration)
+		if err != nil {
+			return ev, fmt.Errorf("event %q: invalid duration: %w", fname, err)
+		}
+	}
+	return ev, nil
+}
+
+// addEventDetails appends the date and location of an event to the end of its
+// page.
+func addEventDetails(doc ast.Node, ev event) {
+	hr := ast.HorizontalRule{}
+	detailsParagraph := ast.Paragraph{}
+	ast.AppendChild(&detailsParagraph, &ast.Text{
+		Leaf: ast.Leaf{
+			Literal: []byte(fmt.Sprintf("When: %s", ev.when())),
+		},
+	})
+	if ev.location != "" {
+		ast.AppendChild(&detailsParagraph, &ast.Hardbreak{})
+		ast.AppendChild(&detailsParagraph, &ast.Text{
+			Leaf: ast.Leaf{
+				Literal: []byte(fmt.Sprintf("Where: %s", ev.location)),
+			},
+		})
+	}
+	ast.AppendChild(doc, &hr)
+	ast.AppendChild(doc, &detailsParagraph)
+}
+
+// eventListMD formats a list of events as a markdown list, with links
+// relative to the site root.
+func eventListMD(events []event, conf siteConfig) string {
+	var list string
+	for _, ev := range events {
+		list += fmt.Sprintf("- [%s](%s) — %s", ev.title, conf.pageLink(".", ev.url), ev.when())
+		if ev.location != "" {
+			list += fmt.Sprintf(", %s", ev.location)
+		}
+		list += "\n"
+		if ev.summary != "" {
+			list += fmt.Sprintf("    - %s\n", ev.summary)
+		}
+	}
+	return list
+}
+
+// renderEventsPage renders the listing of upcoming and past events and
+// exports all events as an iCalendar file.
+func renderEventsPage(events []event, data templateData, renderer *html.Renderer, conf siteConfig) error {
+	if len(events) == 0 {
+		return nil
+	}
+	fmt.Printf(":: Found %d event%s\n", len(events), plural(len(events)))
+
+	now := time.Now()
+	var upcoming, past []event
+	for _, ev := range events {
+		if ev.end().Before(now) {
+			past = append(past, ev)
+		} else {
+			upcoming = append(upcoming, ev)
+		}
+	}
+	sort.SliceStable(upcoming, func(i, j int) bool { return upcoming[i].start.Before(upcoming[j].start) })
+	sort.SliceStable(past, func(i, j int) bool { return past[i].start.After(past[j].start) })
+
+	bodystr := "# Events\n\n[Subscribe to the calendar](events.ics)\n\n## Upcoming\n\n"
+	if len(upcoming) > 0 {
+		bodystr += eventListMD(upcoming, conf)
+	} else {
+		bodystr += "No upcoming events.\n"
+	}
+	if len(past) > 0 {
+		bodystr += "\n## Past\n\n" + eventListMD(past, conf)
+	}
+
+	destpath := conf.DestinationPath
+	doc := parseMD([]byte(bodystr))
+	data.Body = template.HTML(renderBody(doc, renderer, conf))
+	data.RelRoot = "."
+	data.Permalink = conf.absoluteURL("events.html")
+	outpath := filepath.Join(destpath, "events.html")
+	fmt.Printf("   Saving events: %s\n", outpath)
+	htmlData, err := makeHTML(data, conf.listTemplate(), conf)
+	if err != nil {
+		return fmt.Errorf("making html for events page: %w", err)
+	}
+	if err := os.WriteFile(outpath, htmlData, 0666); err != nil {
+		return fmt.Errorf("writing events page %q: %w", outpath, err)
+	}
+
+	icspath := filepath.Join(destpath, "events.ics")
+	fmt.Printf("   Saving calendar: %s\n", icspath)
+	if err := os.WriteFile(icspath, []byte(makeICalendar(events, conf.SiteName)), 0666); err != nil {
+		return fmt.Errorf("writing calendar %q: %w", icspath, err)
+	}
+	return nil
+}
+
+// icalEscape escapes text values as required by RFC 5545.
+func icalEscape(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+	return replacer.Replace(s)
+}
+
+// icalFold folds a content line so that no line is longer than 75 octets,
+// without splitting UTF-8 sequences.
+func icalFold(line string) string {
+	const maxLen = 75
+	var folded strings.Builder
+	lineLen := 0
+	for _, r := range line {
+		rlen := len(string(r))
+		if lineLen+rlen > maxLen {
+			folded.WriteString("\r\n ")
+			lineLen = 1
+		}
+		folded.WriteRune(r)
+		lineLen += rlen
+	}
+	folded.WriteString("\r\n")
+	return folded.String()
+}
+
+func icalTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// makeICalendar exports events as an iCalendar (RFC 5545) document.
+func makeICalendar(events []event, calname string) string {
+	var cal strings.Builder
+	prop := func(name, value string) {
+		cal.WriteString(icalFold(name + ":" + value))
+	}
+	prop("BEGIN", "VCALENDAR")
+	prop("VERSION", "2.0")
+	prop("PRODID", "-//statiko//statiko//EN")
+	if calname != "" {
+		prop("X-WR-CALNAME", icalEscape(calname))
+	}
+	for _, ev := range events {
+		uidHash := sha256.Sum256([]byte(calname + "\x00" + ev.url))
+		prop("BEGIN", "VEVENT")
+		prop("UID", hex.EncodeToString(uidHash[:16])+"@statiko")
+		prop("DTSTAMP", icalTime(ev.modified))
+		prop("DTSTART", icalTime(ev.start))
+		if ev.duration > 0 {
+			prop("DTEND", icalTime(ev.end()))
+		}
+		prop("SUMMARY", icalEscape(ev.title))
+		if ev.location != "" {
+			prop("LOCATION", icalEscape(ev.location))
+		}
+		if ev.summary != "" {
+			prop("DESCRIPTION", icalEscape(ev.summary))
+		}
+		prop("END", "VEVENT")
+	}
+	prop("END", "VCALENDAR")
+	return cal.String()
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Atom feed document types.  Only the elements statiko fills in are
+// represented.
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	Title     string       `xml:"title"`
+	ID        string       `xml:"id"`
+	Link      atomLink     `xml:"link"`
+	Published string       `xml:"published,omitempty"`
+	Updated   string       `xml:"updated"`
+	Summary   string       `xml:"summary,omitempty"`
+	Content   *atomContent `xml:"content,omitempty"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+// atomTime formats a time in the RFC 3339 format required by Atom.
+func atomTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// writeAtomFeed writes the feed to outpath.  The feed's updated time is set to
+// the most recent update of its entries.
+func writeAtomFeed(feed atomFeed, outpath string) error {
+	var latest string
+	for _, entry := range feed.Entries {
+		if entry.Updated > latest {
+			latest = entry.Updated
+		}
+	}
+	if latest == "" {
+		latest = atomTime(time.Now())
+	}
+	feed.Updated = latest
+
+	out, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding feed %q: %w", outpath, err)
+	}
+	out = append([]byte(xml.Header), out...)
+	if err := os.WriteFile(outpath, out, 0666); err != nil {
+		return fmt.Errorf("writing feed %q: %w", outpath, err)
+	}
+	return nil
+}
+
+// RSS 2.0 document types.
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link,omitempty"`
+	Description string  `xml:"description,omitempty"`
+	PubDate     string  `xml:"pubDate,omitempty"`
+	GUID        rssGUID `xml:"guid"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+// rssTime formats a time in the RFC 822 format used by RSS.
+func rssTime(t time.Time) string {
+	return t.Format(time.RFC1123Z)
+}
+
+// writeRSSFeed writes the channel as an RSS 2.0 document to outpath.
+func writeRSSFeed(channel rssChannel, outpath string) error {
+	feed := rssFeed{Version: "2.0", Channel: channel}
+	out, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding feed %q: %w", outpath, err)
+	}
+	out = append([]byte(xml.Header), out...)
+	if err := os.WriteFile(outpath, out, 0666); err != nil {
+		return fmt.Errorf("writing feed %q: %w", outpath, err)
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// fontsConfig configures the web fonts that are subsetted to the characters
+// of the site and served from the destination.
+type fontsConfig struct {
+	Files []webFont `mapstructure:"Files"`
+	// Path is the directory, relative to the destination, of the subsetted
+	// fonts and of fonts.css, their @font-face rules.
+	Path string `mapstructure:"Path"`
+	// Extra holds characters to keep in addition to the ones on the pages,
+	// such as the characters of text inserted by scripts.
+	Extra string `mapstructure:"Extra"`
+}
+
+// webFont is a font file and the @font-face properties it is used for.
+type webFont struct {
+	Family string `mapstructure:"Family"`
+	// Source is the TrueType, OpenType, WOFF, or WOFF2 font file.
+	Source string `mapstructure:"Source"`
+	// Weight and Style are the font-weight and font-style of the face.  They
+	// default to normal.
+	Weight string `mapstructure:"Weight"`
+	Style  string `mapstructure:"Style"`
+}
+
+func (c fontsConfig) validate() error {
+	for idx, font := range c.Files {
+		if font.Family == "" || font.Source == "" {
+			return fmt.Errorf("Fonts.Files[%d]: Family and Source are required", idx)
+		}
+	}
+	return nil
+}
+
+// textAttributes are the attributes whose values are shown to readers.
+var textAttributes = map[string]bool{"alt": true, "title": true, "placeholder": true, "value": true, "aria-label": true}
+
+// pageCharacters adds the characters of the text of a page to chars.  The
+// contents of scripts and styles are skipped.
+func pageCharacters(page []byte, chars map[rune]bool) {
+	tokenizer := html.NewTokenizer(bytes.NewReader(page))
+	skip := ""
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return
+		case html.TextToken:
+			if skip == "" {
+				for _, r := range string(tokenizer.Text()) {
+					chars[r] = true
+				}
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			if token.Data == "script" || token.Data == "style" {
+				skip = token.Data
+			}
+			for _, attr := range token.Attr {
+				if textAttributes[attr.Key] {
+					for _, r := range attr.Val {
+						chars[r] = true
+					}
+				}
+			}
+		case html.EndTagToken:
+			if tokenizer.Token().Data == skip {
+				skip = ""
+			}
+		}
+	}
+}
+
+// siteCharacters returns the characters used on the pages of the
+// destination, sorted.
+func siteCharacters(conf siteConfig) (string, error) {
+	chars := map[rune]bool{}
+	for _, r := range conf.Fonts.Extra {
+		chars[r] = true
+	}
+	walker := func(loc string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() || filepath.Ext(loc) != ".html" {
+			return nil
+		}
+		page, err := os.ReadFile(loc)
+		if err != nil {
+			return err
+		}
+		pageCharacters(page, chars)
+		return nil
+	}
+	if err := filepath.Walk(conf.DestinationPath, walker); err != nil {
+		return "", fmt.Errorf("collecting page characters: %w", err)
+	}
+	runes := make([]rune, 0, len(chars))
+	for r := range chars {
+		if r >= ' ' {
+			runes = append(runes, r)
+		}
+	}
+	sort.Slice(runes, func(i, j int) bool { return runes[i] < runes[j] })
+	return string(runes), nil
+}
+
+// fontFace returns the @font-face rule of a subsetted font.
+func fontFace(font webFont, url string) string {
+	weight, style := font.Weight, font.Style
+	if weight == "" {
+		weight = "normal"
+	}
+	if style == "" {
+		style = "normal"
+	}
+	return fmt.Sprintf("@font-face {\n  font-family: %q;\n  src: url(%q) format(\"woff2\");\n  font-weight: %s;\n  font-style: %s;\n  font-display: swap;\n}\n", font.Family, url, weight, style)
+}
+
+// subsetFonts writes the configured fonts, reduced to the characters used on
+// the pages, as WOFF2 files to the fonts directory of the destination, with
+// a stylesheet of their @font-face rules.  Subsetting runs pyftsubset from
+// fontTools, which needs the brotli module for WOFF2.
+func subsetFonts(conf siteConfig) error {
+	if len(conf.Fonts.Files) == 0 {
+		return nil
+	}
+	fmt.Println(":: Subsetting fonts")
+	chars, err := siteCharacters(conf)
+	if err != nil {
+		return err
+	}
+	ws, err := openWorkspace(conf)
+	if err != nil {
+		return fmt.Errorf("subsetting fonts: %w", err)
+	}
+	defer ws.close()
+	textFile, err := ws.createTemp("fonts-")
+	if err != nil {
+		return fmt.Errorf("subsetting fonts: %w", err)
+	}
+	if _, err := textFile.WriteString(chars); err != nil {
+		textFile.Close()
+		return fmt.Errorf("subsetting fonts: %w", err)
+	}
+	if err := textFile.Close(); err != nil {
+		return fmt.Errorf("subsetting fonts: %w", err)
+	}
+	fmt.Printf("   %d characters\n", len([]rune(chars)))
+
+	fontdir := filepath.Join(conf.DestinationPath, conf.Fonts.Path)
+	if err := os.MkdirAll(fontdir, 0777); err != nil {
+		return fmt.Errorf("creating path %q: %w", fontdir, err)
+	}
+	var css strings.Builder
+	for _, font := range conf.Fonts.Files {
+		name := strings.TrimSuffix(filepath.Base(font.Source), filepath.Ext(font.Source)) + ".woff2"
+		dstloc := filepath.Join(fontdir, name)
+		args := []string{font.Source, "--text-file=" + textFile.Name(), "--flavor=woff2", "--layout-features=*", "--output-file=" + dstloc}
+		if _, err := runCommand(nil, "pyftsubset", args...); err != nil {
+			return fmt.Errorf("subsetting font %q: %w", font.Source, err)
+		}
+		before, after := fileSize(font.Source), fileSize(dstloc)
+		fmt.Printf("   %s -> %s (%d -> %d bytes)\n", font.Source, dstloc, before, after)
+		// fonts.css is next to the fonts
+		css.WriteString(fontFace(font, name))
+	}
+	cssloc := filepath.Join(fontdir, "fonts.css")
+	if err := os.WriteFile(cssloc, []byte(css.String()), 0666); err != nil {
+		return fmt.Errorf("writing font stylesheet %q: %w", cssloc, err)
+	}
+	return nil
+}
+
+// fileSize returns the size of a file, or 0 if it cannot be read.
+func fileSize(fname string) int64 {
+	info, err := os.Stat(fname)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	gohtml "html"
+	"io"
+
+	"github.com/gomarkdown/markdown/ast"
+	"github.com/gomarkdown/markdown/html"
+)
+
+const (
+	footnoteStyleEndnotes  = "endnotes"
+	footnoteStyleSidenotes = "sidenotes"
+)
+
+type footnotesConfig struct {
+	// Enabled turns on Pandoc-style footnotes ([^1]) in pages.
+	Enabled bool `mapstructure:"Enabled"`
+	// Style is either "endnotes", which collects the notes in a section at
+	// the end of the page, or "sidenotes", which places each note next to its
+	// reference using markup compatible with Tufte-style sidenote CSS.
+	Style string `mapstructure:"Style"`
+	// ReturnLinks adds a link from each endnote back to its reference, with
+	// ReturnLabel as its contents.
+	ReturnLinks bool   `mapstructure:"ReturnLinks"`
+	ReturnLabel string `mapstructure:"ReturnLabel"`
+	// Heading is an optional heading for the endnotes section.
+	Heading string `mapstructure:"Heading"`
+	// AnchorPrefix is prepended to the IDs of references and notes.
+	AnchorPrefix string `mapstructure:"AnchorPrefix"`
+}
+
+func (c footnotesConfig) validate() error {
+	switch c.Style {
+	case footnoteStyleEndnotes, footnoteStyleSidenotes:
+		return nil
+	}
+	return fmt.Errorf("invalid footnote style %q (must be %q or %q)", c.Style, footnoteStyleEndnotes, footnoteStyleSidenotes)
+}
+
+// forPage returns the footnote config of a page whose front matter selects
+// style, overriding the configured style.  Pages without a style use the
+// configured one.
+func (c footnotesConfig) forPage(style string) (footnotesConfig, error) {
+	if style == "" {
+		return c, nil
+	}
+	c.Style = style
+	if err := c.validate(); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+// applyRendererOptions sets the renderer options for the configured footnote
+// rendering.
+func (c footnotesConfig) applyRendererOptions(opts *html.RendererOptions) {
+	if !c.Enabled {
+		return
+	}
+	opts.FootnoteAnchorPrefix = c.AnchorPrefix
+	if c.ReturnLinks {
+		opts.Flags |= html.FootnoteReturnLinks
+		opts.FootnoteReturnLinkContents = gohtml.EscapeString(c.ReturnLabel)
+	}
+	if c.Heading != "" {
+		opts.Flags |= html.FootnoteNoHRTag
+	}
+}
+
+// renderHook renders the endnotes section with the configured heading.  The
+// list items themselves are rendered by the default renderer.
+func (c footnotesConfig) renderHook(w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
+	list, ok := node.(*ast.List)
+	if !ok || !list.IsFootnotesList || c.Heading == "" {
+		return ast.GoToNext, false
+	}
+	if entering {
+		fmt.Fprintf(w, "\n<section class=\"footnotes\" role=\"doc-endnotes\">\n<h2>%s</h2>\n<ol>\n", gohtml.EscapeString(c.Heading))
+	} else {
+		io.WriteString(w, "</ol>\n</section>\n")
+	}
+	return ast.GoToNext, true
+}
+
+// inlineContents returns the inline nodes of a footnote.  Single line notes
+// hold inline nodes directly, while longer notes hold paragraphs, whose
+// contents are joined with line breaks.
+func inlineContents(item ast.Node) []ast.Node {
+	children := item.GetChildren()
+	hasBlocks := false
+	for _, child := range children {
+		if _, ok := child.(*ast.Paragraph); ok {
+			hasBlocks = true
+		}
+	}
+	if !hasBlocks {
+		return children
+	}
+
+	var inline []ast.Node
+	for _, block := range children {
+		if len(inline) > 0 {
+			inline = append(inline, &ast.Hardbreak{})
+		}
+		if _, ok := block.(*ast.Paragraph); ok {
+			inline = append(inline, block.GetChildren()...)
+		} else {
+			inline = append(inline, &ast.Text{Leaf: ast.Leaf{Literal: []byte(childLiterals(block))}})
+		}
+	}
+	return inline
+}
+
+// convertToSidenotes moves the contents of each footnote next to its
+// reference, as a checkbox-toggled sidenote, and removes the endnotes
+// section and its list.
+func convertToSidenotes(doc ast.Node, prefix string) {
+	notes := map[string]ast.Node{}
+	var refs []*ast.Link
+	var footnotes []ast.Node
+	visitor := func(node ast.Node, entering bool) ast.WalkStatus {
+		if !entering {
+			return ast.GoToNext
+		}
+		switch nd := node.(type) {
+		case *ast.Footnotes:
+			footnotes = append(footnotes, nd)
+		case *ast.List:
+			if nd.IsFootnotesList {
+				footnotes = append(footnotes, nd)
+			}
+		case *ast.ListItem:
+			if nd.RefLink != nil {
+				notes[string(nd.RefLink)] = nd
+			}
+		case *ast.Link:
+			if nd.NoteID != 0 {
+				refs = append(refs, nd)
+			}
+		}
+		return ast.GoToNext
+	}
+	ast.WalkFunc(doc, visitor)
+
+	// modify the tree after walking it
+	uses := map[string]int{}
+	for _, ref := range refs {
+		item, ok := notes[string(ref.Destination)]
+		if !ok {
+			continue
+		}
+		id := fmt.Sprintf("sn-%s%s", prefix, html.Slugify(ref.Destination))
+		uses[id]++
+		contents := inlineContents(item)
+		if uses[id] > 1 {
+			// notes referenced more than once get a copy of their
+			// contents and an id of their own for each reference
+			id = fmt.Sprintf("%s-%d", id, uses[id])
+			cloned := make([]ast.Node, len(contents))
+			for idx, node := range contents {
+				cloned[idx] = cloneNode(node)
+			}
+			contents = cloned
+		}
+		open := fmt.Sprintf(`<label for="%s" class="margin-toggle sidenote-number"></label><input type="checkbox" id="%s" class="margin-toggle"><span class="sidenote">`, id, id)
+		nodes := []ast.Node{&ast.HTMLSpan{Leaf: ast.Leaf{Literal: []byte(open)}}}
+		nodes = append(nodes, contents...)
+		nodes = append(nodes, &ast.HTMLSpan{Leaf: ast.Leaf{Literal: []byte("</span>")}})
+		replaceNode(ref, nodes...)
+	}
+	for _, fn := range footnotes {
+		ast.RemoveFromTree(fn)
+	}
+}
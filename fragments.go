@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// fragmentPath returns the location of the fragment of a page: its path
+// under FragmentPath mirrors the path of the page under DestinationPath.
+func fragmentPath(outpath string, conf siteConfig) string {
+	return filepath.Join(conf.FragmentPath, filepath.FromSlash(siteURL(outpath, conf)))
+}
+
+// writeFragment saves the rendered body of a page, without the template, for
+// embedding in other documents.  Relative links in the body resolve the same
+// way as on the page as long as the fragment is served from the same URL
+// path.
+func writeFragment(outpath string, body []byte, conf siteConfig) error {
+	fragpath := fragmentPath(outpath, conf)
+	if err := os.MkdirAll(filepath.Dir(fragpath), 0777); err != nil {
+		return fmt.Errorf("creating path %q: %w", filepath.Dir(fragpath), err)
+	}
+	if err := os.WriteFile(fragpath, body, 0666); err != nil {
+		return fmt.Errorf("writing fragment %q: %w", fragpath, err)
+	}
+	return nil
+}
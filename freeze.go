@@ -0,0 +1,263 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// freezeConfig configures the freeze manifests: records of the hashes of the
+// sources and the output of each published build, kept as proof of what was
+// published when.
+type freezeConfig struct {
+	// Path is the directory the manifest of each published build is
+	// written to, named after the time of the build.  Empty disables the
+	// manifests.
+	Path string `mapstructure:"Path"`
+	// KeyFile is a PEM encoded PKCS #8 Ed25519 private key that signs each
+	// manifest.  The signature is written next to the manifest with the
+	// .sig extension.  Without a key, manifests are not signed.
+	KeyFile string `mapstructure:"KeyFile"`
+}
+
+func (c freezeConfig) validate() error {
+	if c.KeyFile != "" && c.Path == "" {
+		return fmt.Errorf("freeze key file requires a freeze path")
+	}
+	return nil
+}
+
+// freezeManifest is the record of a build.  Files are keyed by their paths
+// relative to the source and destination directories and map to the hex
+// encoded SHA-256 hashes of their contents.
+type freezeManifest struct {
+	Built   time.Time         `json:"built"`
+	Version string            `json:"version"`
+	Sources map[string]string `json:"sources"`
+	Output  map[string]string `json:"output"`
+}
+
+// freezeManifestName returns the name of the manifest of a build at the
+// given time.
+func freezeManifestName(built time.Time) string {
+	return built.UTC().Format("20060102T150405Z") + ".json"
+}
+
+// signaturePath returns the path of the signature of a manifest.
+func signaturePath(fname string) string {
+	return strings.TrimSuffix(fname, filepath.Ext(fname)) + ".sig"
+}
+
+// readPEMKey returns the DER bytes of the PEM encoded key in fname.
+func readPEMKey(fname string) ([]byte, error) {
+	content, err := os.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, fmt.Errorf("%q is not a PEM encoded key", fname)
+	}
+	return block.Bytes, nil
+}
+
+// loadSigningKey reads the Ed25519 private key of KeyFile.
+func loadSigningKey(fname string) (ed25519.PrivateKey, error) {
+	der, err := readPEMKey(fname)
+	if err != nil {
+		return nil, fmt.Errorf("reading freeze key: %w", err)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("reading freeze key %q: %w", fname, err)
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("reading freeze key %q: not an Ed25519 key", fname)
+	}
+	return priv, nil
+}
+
+// loadVerifyingKey reads an Ed25519 public key: a PKIX public key, or the
+// public half of a PKCS #8 private key.
+func loadVerifyingKey(fname string) (ed25519.PublicKey, error) {
+	der, err := readPEMKey(fname)
+	if err != nil {
+		return nil, fmt.Errorf("reading public key: %w", err)
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		priv, privErr := x509.ParsePKCS8PrivateKey(der)
+		if privErr != nil {
+			return nil, fmt.Errorf("reading public key %q: %w", fname, err)
+		}
+		if signer, ok := priv.(ed25519.PrivateKey); ok {
+			key = signer.Public()
+		}
+	}
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("reading public key %q: not an Ed25519 key", fname)
+	}
+	return pub, nil
+}
+
+// hashTree returns the hex encoded hashes of the files under root by path
+// relative to root.
+func hashTree(root string) (map[string]string, error) {
+	snapshot, err := snapshotTree(root)
+	if err != nil {
+		return nil, err
+	}
+	return snapshot.hashes(root)
+}
+
+// writeFreezeManifest writes the manifest of the sources and the output of a
+// build, and its signature if a key is configured.
+func writeFreezeManifest(conf siteConfig, built time.Time) error {
+	if conf.Freeze.Path == "" {
+		return nil
+	}
+	manifest := freezeManifest{Built: built.UTC().Truncate(time.Second), Version: verstr}
+	var err error
+	if manifest.Sources, err = hashTree(conf.SourcePath); err != nil {
+		return fmt.Errorf("writing freeze manifest: %w", err)
+	}
+	if manifest.Output, err = hashTree(conf.DestinationPath); err != nil {
+		return fmt.Errorf("writing freeze manifest: %w", err)
+	}
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding freeze manifest: %w", err)
+	}
+	if err := os.MkdirAll(conf.Freeze.Path, 0777); err != nil {
+		return fmt.Errorf("creating path %q: %w", conf.Freeze.Path, err)
+	}
+	fname := filepath.Join(conf.Freeze.Path, freezeManifestName(built))
+	fmt.Printf(":: Writing freeze manifest %s (%d source%s, %d output file%s)\n", fname, len(manifest.Sources), plural(len(manifest.Sources)), len(manifest.Output), plural(len(manifest.Output)))
+	if err := os.WriteFile(fname, content, 0666); err != nil {
+		return fmt.Errorf("writing freeze manifest %q: %w", fname, err)
+	}
+	if conf.Freeze.KeyFile == "" {
+		return nil
+	}
+	key, err := loadSigningKey(conf.Freeze.KeyFile)
+	if err != nil {
+		return err
+	}
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(key, content)) + "\n"
+	sigpath := signaturePath(fname)
+	fmt.Printf("   Saving signature: %s\n", sigpath)
+	if err := os.WriteFile(sigpath, []byte(sig), 0666); err != nil {
+		return fmt.Errorf("writing freeze manifest signature %q: %w", sigpath, err)
+	}
+	return nil
+}
+
+// verifyFreezeSignature checks the signature of the manifest in fname.
+func verifyFreezeSignature(fname string, content []byte, pub ed25519.PublicKey) error {
+	encoded, err := os.ReadFile(signaturePath(fname))
+	if err != nil {
+		return fmt.Errorf("reading signature: %w", err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return fmt.Errorf("reading signature %q: %w", signaturePath(fname), err)
+	}
+	if !ed25519.Verify(pub, content, sig) {
+		return errors.New("signature does not match")
+	}
+	return nil
+}
+
+// runFreezeVerify checks the signature of a freeze manifest and reports the
+// sources that changed since the build it records.
+func runFreezeVerify(args []string) error {
+	flags := flag.NewFlagSet("freeze-verify", flag.ExitOnError)
+	keyFile := flags.String("key", "", "public key, or private key, to verify the signature with (default: Freeze.KeyFile)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: statiko freeze-verify [-key file] <manifest>\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	fname := argPath(flags.Arg(0))
+	conf, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	content, err := os.ReadFile(fname)
+	if err != nil {
+		return fmt.Errorf("reading freeze manifest: %w", err)
+	}
+	var manifest freezeManifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return fmt.Errorf("reading freeze manifest %q: %w", fname, err)
+	}
+	fmt.Printf(":: Build of %s by %s\n", manifest.Built.Format(time.RFC3339), manifest.Version)
+
+	if *keyFile == "" {
+		*keyFile = conf.Freeze.KeyFile
+	} else {
+		*keyFile = argPath(*keyFile)
+	}
+	if *keyFile != "" {
+		pub, err := loadVerifyingKey(*keyFile)
+		if err != nil {
+			return err
+		}
+		if err := verifyFreezeSignature(fname, content, pub); err != nil {
+			return fmt.Errorf("verifying freeze manifest %q: %w", fname, err)
+		}
+		fmt.Println("   Signature verified")
+	} else {
+		fmt.Println("   No key to verify the signature with")
+	}
+
+	current, err := hashTree(conf.SourcePath)
+	if err != nil {
+		return err
+	}
+	changes := map[string]string{}
+	for rel, sum := range current {
+		if prev, ok := manifest.Sources[rel]; !ok {
+			changes[rel] = "added"
+		} else if prev != sum {
+			changes[rel] = "modified"
+		}
+	}
+	for rel := range manifest.Sources {
+		if _, ok := current[rel]; !ok {
+			changes[rel] = "removed"
+		}
+	}
+	if len(changes) == 0 {
+		fmt.Printf(":: Sources in %s match the manifest\n", conf.SourcePath)
+		return nil
+	}
+	changed := make([]string, 0, len(changes))
+	for rel := range changes {
+		changed = append(changed, rel)
+	}
+	sort.Strings(changed)
+	fmt.Printf(":: %d source%s in %s changed since the build:\n", len(changed), plural(len(changed)), conf.SourcePath)
+	for _, rel := range changed {
+		fmt.Printf("   %s: %s\n", changes[rel], rel)
+	}
+	return nil
+}
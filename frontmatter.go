@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"go.yaml.in/yaml/v3"
+)
+
+// frontMatter holds the fields of the YAML or TOML front matter of a page
+// source, merged with the defaults of its directories.  The fields are
+// exposed to templates as .Page.
+type frontMatter struct {
+	// Title overrides the first level 1 heading as the title of the page.
+	Title string `yaml:"title" toml:"title"`
+	// Date is the publication date of a post.  The posted date of the
+	// metadata file takes precedence.
+	Date  pageDate `yaml:"date" toml:"date"`
+	Tags  []string `yaml:"tags" toml:"tags"`
+	Draft bool     `yaml:"draft" toml:"draft"`
+	// Slug replaces the file name of the source in the output path of the
+	// page.  It is not inherited from directory defaults.
+	Slug string `yaml:"slug" toml:"slug"`
+	// Category is the single category of a post.  It is ignored on other
+	// pages.
+	Category string `yaml:"category" toml:"category"`
+	// Template overrides the template file of the page.
+	Template string `yaml:"template" toml:"template"`
+	Author   string `yaml:"author" toml:"author"`
+	Section  string `yaml:"section" toml:"section"`
+	// Image is the cover image of the page for link previews.
+	Image string `yaml:"image" toml:"image"`
+	// Outputs lists the formats the page is rendered to in addition to
+	// HTML: "gemtext", "text", and "json".
+	Outputs []string `yaml:"outputs" toml:"outputs"`
+	// Styles and Scripts list stylesheets and scripts, relative to
+	// BundlePath, that only this page loads.
+	Styles  []string `yaml:"styles" toml:"styles"`
+	Scripts []string `yaml:"scripts" toml:"scripts"`
+	// Evergreen posts never get the stale notice of old posts.
+	Evergreen bool `yaml:"evergreen" toml:"evergreen"`
+	// Series is the name of the series of a post, whose parts are also
+	// combined into a single page.  Part orders the post in its series;
+	// parts without one are ordered by date.
+	Series string `yaml:"series" toml:"series"`
+	Part   int    `yaml:"part" toml:"part"`
+	// Footnotes overrides the footnote style of the config for the page:
+	// "endnotes" or "sidenotes".
+	Footnotes string `yaml:"footnotes" toml:"footnotes"`
+	// Audiences limits the partial sites of the Audiences of the config that
+	// include the page to those named.  Pages without audiences are in all
+	// of them.
+	Audiences []string `yaml:"audiences" toml:"audiences"`
+}
+
+// pageDate is a front matter date.  It is decoded from YAML timestamps and
+// TOML datetimes as well as from strings, such as the quoted dates of Hugo
+// archetypes, in RFC 3339 or as a date only.  Dates without a time zone are
+// in UTC.
+type pageDate struct {
+	time.Time
+}
+
+// pageDateLayouts are the accepted layouts of dates, with the time
+// separated from the date by T or a space and optional leading zeros.
+var pageDateLayouts = []string{
+	"2006-1-2T15:4:5.999999999Z07:00",
+	"2006-1-2 15:4:5.999999999Z07:00",
+	"2006-1-2T15:4:5.999999999",
+	"2006-1-2 15:4:5.999999999",
+	"2006-1-2",
+}
+
+func (d *pageDate) UnmarshalText(text []byte) error {
+	value := strings.TrimSpace(string(text))
+	if value == "" {
+		d.Time = time.Time{}
+		return nil
+	}
+	// RFC 3339 allows a lower case t and z
+	value = strings.Replace(value, "t", "T", 1)
+	value = strings.Replace(value, "z", "Z", 1)
+	for _, layout := range pageDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			d.Time = t
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid date %q (must be RFC 3339 or YYYY-MM-DD)", string(text))
+}
+
+// Front matter delimiters.  The delimiter on the first line of a source
+// selects the format of its front matter.
+const (
+	yamlDelimiter = "---"
+	tomlDelimiter = "+++"
+)
+
+// splitFrontMatter separates a front matter block, delimited by lines
+// consisting of delim, from the rest of a markdown source.  ok is false if
+// the source has no front matter.
+func splitFrontMatter(md []byte, delim string) (front, body []byte, ok bool) {
+	md = bytes.TrimPrefix(md, []byte("\ufeff"))
+	rest, found := bytes.CutPrefix(md, []byte(delim+"\n"))
+	if !found {
+		if rest, found = bytes.CutPrefix(md, []byte(delim+"\r\n")); !found {
+			return nil, md, false
+		}
+	}
+	if bytes.HasPrefix(rest, []byte(delim)) {
+		// empty front matter
+		_, body, _ = bytes.Cut(rest, []byte("\n"))
+		return nil, body, true
+	}
+	end := bytes.Index(rest, []byte("\n"+delim))
+	if end < 0 {
+		return nil, md, false
+	}
+	front = rest[:end+1]
+	_, body, _ = bytes.Cut(rest[end+1:], []byte("\n"))
+	return front, body, true
+}
+
+// parseFrontMatter separates the front matter of a page source from its
+// markdown body and decodes it.  YAML front matter is delimited by --- lines
+// and TOML front matter by +++ lines.  Sources without front matter have an
+// empty front matter.
+func parseFrontMatter(md []byte) (frontMatter, []byte, error) {
+	var fm frontMatter
+	if front, body, ok := splitFrontMatter(md, yamlDelimiter); ok {
+		if err := yaml.Unmarshal(front, &fm); err != nil {
+			return fm, body, fmt.Errorf("parsing YAML front matter: %w", err)
+		}
+		return fm, body, nil
+	}
+	if front, body, ok := splitFrontMatter(md, tomlDelimiter); ok {
+		if err := toml.Unmarshal(front, &fm); err != nil {
+			return fm, body, fmt.Errorf("parsing TOML front matter: %w", err)
+		}
+		return fm, body, nil
+	}
+	return fm, md, nil
+}
+
+// stripFrontMatter returns the markdown body of a page source.
+func stripFrontMatter(md []byte) []byte {
+	_, body, _ := parseFrontMatter(md)
+	return body
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	gohtml "html"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+	"github.com/gomarkdown/markdown/html"
+)
+
+// glossaryMetadata is read from the metadata file of each page.
+type glossaryMetadata struct {
+	// Glossary marks a page whose definition lists are exported to the
+	// glossary data file.
+	Glossary bool `json:"glossary"`
+	// ExpandTerms controls the linking of glossary terms on the page.  It
+	// defaults to true, except on glossary pages.
+	ExpandTerms *bool `json:"expandTerms"`
+}
+
+// expandTerms reports whether glossary terms should be linked on the page.
+func (gm glossaryMetadata) expandTerms() bool {
+	if gm.ExpandTerms != nil {
+		return *gm.ExpandTerms
+	}
+	return !gm.Glossary
+}
+
+// definition is a term of a definition list with its descriptions.
+type definition struct {
+	Term         string   `json:"term"`
+	Descriptions []string `json:"descriptions"`
+	// URL links to the term's anchor on the page that defines it.
+	URL string `json:"url"`
+}
+
+// termAnchor returns the ID of the anchor of a term on the page defining it.
+func termAnchor(term string) string {
+	return "term-" + string(html.Slugify([]byte(strings.ToLower(term))))
+}
+
+func readGlossaryMetadata(fname string) (glossaryMetadata, error) {
+	gm := glossaryMetadata{}
+	if _, err := readMetadata(fname, &gm); err != nil {
+		return glossaryMetadata{}, fmt.Errorf("reading glossary metadata: %w", err)
+	}
+	return gm, nil
+}
+
+// loadGlossary reads the terms to link on pages from the configured glossary
+// data file, which has the same format as the generated glossary.  Longer
+// terms come first so that they take precedence over the terms they contain.
+func loadGlossary(conf siteConfig) ([]definition, error) {
+	if conf.GlossaryFile == "" {
+		return nil, nil
+	}
+	content, err := os.ReadFile(conf.GlossaryFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading glossary %q: %w", conf.GlossaryFile, err)
+	}
+	var defs []definition
+	if err := json.Unmarshal(content, &defs); err != nil {
+		return nil, fmt.Errorf("reading glossary %q: %w", conf.GlossaryFile, err)
+	}
+	sort.SliceStable(defs, func(i, j int) bool {
+		return len(defs[i].Term) > len(defs[j].Term)
+	})
+	return defs, nil
+}
+
+// collectDefinitions returns the terms of the definition lists of a page in
+// document order.  Descriptions are converted to plain text.
+func collectDefinitions(doc ast.Node, pageURL string) []definition {
+	var defs []definition
+	visitor := func(node ast.Node, entering bool) ast.WalkStatus {
+		item, ok := node.(*ast.ListItem)
+		if !ok || !entering {
+			return ast.GoToNext
+		}
+		switch {
+		case item.ListFlags&ast.ListTypeTerm != 0:
+			term := plainText(item)
+			defs = append(defs, definition{Term: term, URL: pageURL + "#" + termAnchor(term)})
+		case item.ListFlags&ast.ListTypeDefinition != 0 && len(defs) > 0:
+			last := &defs[len(defs)-1]
+			last.Descriptions = append(last.Descriptions, plainText(item))
+		}
+		return ast.SkipChildren
+	}
+	ast.WalkFunc(doc, visitor)
+	return defs
+}
+
+// termAnchorHook renders the terms of definition lists with an ID, so that
+// other pages can link to them.
+func termAnchorHook(w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
+	item, ok := node.(*ast.ListItem)
+	if !ok || !entering || item.ListFlags&ast.ListTypeTerm == 0 {
+		return ast.GoToNext, false
+	}
+	if html.ListItemOpenCR(item) {
+		io.WriteString(w, "\n")
+	}
+	fmt.Fprintf(w, `<dt id="%s">`, termAnchor(plainText(item)))
+	return ast.GoToNext, true
+}
+
+// chainRenderHooks combines render hooks.  Each node is passed to the hooks in
+// order until one of them renders it.
+func chainRenderHooks(hooks ...html.RenderNodeFunc) html.RenderNodeFunc {
+	return func(w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
+		for _, hook := range hooks {
+			if status, handled := hook(w, node, entering); handled {
+				return status, true
+			}
+		}
+		return ast.GoToNext, false
+	}
+}
+
+// writeGlossary saves the terms defined on glossary pages, sorted by term, to
+// the configured glossary data file.
+func writeGlossary(defs []definition, conf siteConfig) error {
+	if len(defs) == 0 {
+		return nil
+	}
+	sort.SliceStable(defs, func(i, j int) bool {
+		return strings.ToLower(defs[i].Term) < strings.ToLower(defs[j].Term)
+	})
+	out, err := json.Marshal(defs)
+	if err != nil {
+		return fmt.Errorf("encoding glossary: %w", err)
+	}
+	outpath := filepath.Join(conf.DestinationPath, conf.GlossaryOutput)
+	if err := os.MkdirAll(filepath.Dir(outpath), 0777); err != nil {
+		return fmt.Errorf("creating path %q: %w", filepath.Dir(outpath), err)
+	}
+	fmt.Printf("   Saving glossary: %s\n", outpath)
+	if err := os.WriteFile(outpath, out, 0666); err != nil {
+		return fmt.Errorf("writing glossary %q: %w", outpath, err)
+	}
+	return nil
+}
+
+// inUnlinkableNode reports whether a node is inside a link, heading, or
+// image, where glossary terms are not linked.
+func inUnlinkableNode(node ast.Node) bool {
+	for parent := node.GetParent(); parent != nil; parent = parent.GetParent() {
+		switch parent.(type) {
+		case *ast.Link, *ast.Heading, *ast.Image:
+			return true
+		}
+	}
+	return false
+}
+
+// expandGlossaryTerms wraps the first occurrence of each glossary term on a
+// page in an abbr element with the term's description, linked to its
+// definition.
+func expandGlossaryTerms(doc ast.Node, defs []definition, pageURL string) {
+	relroot := relRootOf(pageURL)
+	// inserted terms are not searched again for shorter terms
+	expanded := map[ast.Node]bool{}
+	for _, def := range defs {
+		if def.Term == "" {
+			continue
+		}
+		termRe := regexp.MustCompile(`\b` + regexp.QuoteMeta(def.Term) + `\b`)
+		var found *ast.Text
+		var loc []int
+		visitor := func(node ast.Node, entering bool) ast.WalkStatus {
+			text, ok := node.(*ast.Text)
+			if !ok || !entering || expanded[text] || inUnlinkableNode(text) {
+				return ast.GoToNext
+			}
+			if loc = termRe.FindIndex(text.Literal); loc != nil {
+				found = text
+				return ast.Terminate
+			}
+			return ast.GoToNext
+		}
+		ast.WalkFunc(doc, visitor)
+		if found == nil {
+			continue
+		}
+
+		// modify the tree after walking it
+		href := def.URL
+		if !isRemoteURL(href) && !path.IsAbs(href) {
+			href = path.Join(relroot, href)
+		}
+		open := fmt.Sprintf(`<a href="%s" class="glossary-term"><abbr title="%s">`,
+			gohtml.EscapeString(href), gohtml.EscapeString(strings.Join(def.Descriptions, " ")))
+		lit := found.Literal
+		term := &ast.Text{Leaf: ast.Leaf{Literal: lit[loc[0]:loc[1]]}}
+		expanded[term] = true
+		replaceNode(found,
+			&ast.Text{Leaf: ast.Leaf{Literal: lit[:loc[0]]}},
+			&ast.HTMLSpan{Leaf: ast.Leaf{Literal: []byte(open)}},
+			term,
+			&ast.HTMLSpan{Leaf: ast.Leaf{Literal: []byte("</abbr></a>")}},
+			&ast.Text{Leaf: ast.Leaf{Literal: lit[loc[1]:]}})
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// mostConnectedCount is the number of pages listed in the most-connected
+// pages report.
+const mostConnectedCount = 10
+
+// degrees returns the number of links from and to each page.
+func (g *linkGraph) degrees() (outgoing, incoming map[string]int) {
+	outgoing, incoming = map[string]int{}, map[string]int{}
+	for _, source := range g.urls {
+		outgoing[source] = len(g.links[source])
+		for _, target := range g.links[source] {
+			incoming[target]++
+		}
+	}
+	return outgoing, incoming
+}
+
+// writeGraph saves the pages and the links between them as a JSON graph, for
+// themes that render an interactive note graph.
+func (g *linkGraph) writeGraph(conf siteConfig) error {
+	type graphNode struct {
+		ID       string `json:"id"`
+		Title    string `json:"title"`
+		URL      string `json:"url"`
+		Incoming int    `json:"incoming"`
+		Outgoing int    `json:"outgoing"`
+	}
+	type graphEdge struct {
+		Source string `json:"source"`
+		Target string `json:"target"`
+	}
+	graph := struct {
+		Nodes []graphNode `json:"nodes"`
+		Edges []graphEdge `json:"edges"`
+	}{Nodes: []graphNode{}, Edges: []graphEdge{}}
+
+	outgoing, incoming := g.degrees()
+	for _, url := range g.urls {
+		graph.Nodes = append(graph.Nodes, graphNode{
+			ID:       url,
+			Title:    g.titles[url],
+			URL:      url,
+			Incoming: incoming[url],
+			Outgoing: outgoing[url],
+		})
+		for _, target := range g.links[url] {
+			graph.Edges = append(graph.Edges, graphEdge{Source: url, Target: target})
+		}
+	}
+
+	out, err := json.Marshal(graph)
+	if err != nil {
+		return fmt.Errorf("encoding link graph: %w", err)
+	}
+	outpath := filepath.Join(conf.DestinationPath, conf.GraphOutput)
+	if err := os.MkdirAll(filepath.Dir(outpath), 0777); err != nil {
+		return fmt.Errorf("creating path %q: %w", filepath.Dir(outpath), err)
+	}
+	fmt.Printf("   Saving link graph: %s\n", outpath)
+	if err := os.WriteFile(outpath, out, 0666); err != nil {
+		return fmt.Errorf("writing link graph %q: %w", outpath, err)
+	}
+	return nil
+}
+
+// printMostConnected lists the pages with the most links to and from other
+// pages.
+func (g *linkGraph) printMostConnected() {
+	outgoing, incoming := g.degrees()
+	urls := make([]string, 0, len(g.urls))
+	for _, url := range g.urls {
+		if outgoing[url]+incoming[url] > 0 {
+			urls = append(urls, url)
+		}
+	}
+	sort.SliceStable(urls, func(i, j int) bool {
+		return outgoing[urls[i]]+incoming[urls[i]] > outgoing[urls[j]]+incoming[urls[j]]
+	})
+	if len(urls) > mostConnectedCount {
+		urls = urls[:mostConnectedCount]
+	}
+	if len(urls) == 0 {
+		return
+	}
+	fmt.Println(":: Most connected pages")
+	for idx, url := range urls {
+		fmt.Printf("   %d: %s (%d in, %d out)\n", idx+1, url, incoming[url], outgoing[url])
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	gohtml "html"
+	"io"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// headingAnchorsConfig configures the permalink anchors of headings.
+type headingAnchorsConfig struct {
+	// Enabled adds a link to each heading with an ID, after its text, so
+	// readers can copy links to sections.
+	Enabled bool `mapstructure:"Enabled"`
+	// Symbol is the text of the anchors.
+	Symbol string `mapstructure:"Symbol"`
+	// MinLevel and MaxLevel limit the anchors to the headings of these
+	// levels, e.g. 2 and 3 for the sections and subsections of pages.
+	MinLevel int `mapstructure:"MinLevel"`
+	MaxLevel int `mapstructure:"MaxLevel"`
+}
+
+func (c headingAnchorsConfig) validate() error {
+	if c.MinLevel < 1 || c.MaxLevel > 6 || c.MinLevel > c.MaxLevel {
+		return fmt.Errorf("invalid heading anchor levels %d to %d (must be between 1 and 6)", c.MinLevel, c.MaxLevel)
+	}
+	return nil
+}
+
+// renderHook writes the anchor of each heading before its closing tag.  It
+// leaves the rendering of the heading itself to the renderer, which has made
+// the heading ID unique by the time the heading is closed.
+func (c headingAnchorsConfig) renderHook(w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
+	heading, ok := node.(*ast.Heading)
+	if !ok || entering || heading.HeadingID == "" || heading.IsTitleblock {
+		return ast.GoToNext, false
+	}
+	if heading.Level < c.MinLevel || heading.Level > c.MaxLevel {
+		return ast.GoToNext, false
+	}
+	fmt.Fprintf(w, ` <a class="heading-anchor" href="#%s" aria-label="Link to this section">%s</a>`, gohtml.EscapeString(heading.HeadingID), gohtml.EscapeString(c.Symbol))
+	return ast.GoToNext, false
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// hotspotsRe matches the hotspots shortcode, {{< hotspots "name" >}}, on a
+// line of its own.  A name ending in .json is a data file relative to the
+// page source; any other name is an entry of the hotspots of the page's
+// metadata file.
+var hotspotsRe = regexp.MustCompile(`(?m)^{{<\s*hotspots\s+"([^"]*)"\s*>}}[ \t]*$`)
+
+// hotspot is a labeled region of an annotated image.  The position and size
+// are percentages of the width and height of the image, so the regions scale
+// with it.
+type hotspot struct {
+	Label  string  `json:"label"`
+	Href   string  `json:"href"`
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// annotatedImage is an image with hotspots.  Image and the links of the
+// regions are relative to the page source.
+type annotatedImage struct {
+	Image   string    `json:"image"`
+	Alt     string    `json:"alt"`
+	Caption string    `json:"caption"`
+	Regions []hotspot `json:"regions"`
+}
+
+func (img annotatedImage) validate() error {
+	if img.Image == "" {
+		return fmt.Errorf("missing image")
+	}
+	for _, region := range img.Regions {
+		if region.Label == "" {
+			return fmt.Errorf("region without a label")
+		}
+		for _, v := range []float64{region.X, region.Y, region.Width, region.Height} {
+			if v < 0 || v > 100 {
+				return fmt.Errorf("region %q: position and size must be percentages between 0 and 100", region.Label)
+			}
+		}
+	}
+	return nil
+}
+
+// hotspotsMetadata holds the annotated images of the metadata file of a page
+// by name.
+type hotspotsMetadata struct {
+	Hotspots map[string]annotatedImage `json:"hotspots"`
+}
+
+// The regions are drawn over the image for pointer users, and repeated as a
+// list in the caption, which is what keyboard and screen reader users get.
+const annotatedImageHTML = `<figure class="hotspots">
+<div class="hotspots-image" style="position: relative; display: inline-block">
+<img src="{{.Image}}" alt="{{.Alt}}" style="display: block; max-width: 100%">
+{{- range .Regions}}
+{{- $style := printf "position: absolute; left: %g%%; top: %g%%; width: %g%%; height: %g%%" .X .Y .Width .Height}}
+{{- if .Href}}
+<a class="hotspot" href="{{.Href}}" title="{{.Label}}" style="{{$style | safeCSS}}" tabindex="-1" aria-hidden="true"></a>
+{{- else}}
+<span class="hotspot" title="{{.Label}}" style="{{$style | safeCSS}}" aria-hidden="true"></span>
+{{- end}}
+{{- end}}
+</div>
+<figcaption>
+{{- if .Caption}}
+<p>{{.Caption}}</p>
+{{- end}}
+<ol class="hotspots-list">
+{{- range .Regions}}
+<li>{{if .Href}}<a href="{{.Href}}">{{.Label}}</a>{{else}}{{.Label}}{{end}}</li>
+{{- end}}
+</ol>
+</figcaption>
+</figure>`
+
+var annotatedImageTemplate = template.Must(template.New("hotspots").Funcs(template.FuncMap{
+	"safeCSS": func(s string) template.CSS { return template.CSS(s) },
+}).Parse(annotatedImageHTML))
+
+// loadAnnotatedImage reads the annotated image a hotspots shortcode of the
+// page source fname refers to.
+func loadAnnotatedImage(fname, name string) (annotatedImage, error) {
+	var img annotatedImage
+	if strings.HasSuffix(name, ".json") {
+		dataPath := filepath.Join(filepath.Dir(fname), filepath.FromSlash(name))
+		content, err := os.ReadFile(dataPath)
+		if err != nil {
+			return img, err
+		}
+		if err := json.Unmarshal(content, &img); err != nil {
+			return img, fmt.Errorf("reading %q: %w", dataPath, err)
+		}
+	} else {
+		var hm hotspotsMetadata
+		if _, err := readMetadata(fname, &hm); err != nil {
+			return img, err
+		}
+		var found bool
+		if img, found = hm.Hotspots[name]; !found {
+			return img, fmt.Errorf("no hotspots named %q in %q", name, metadataPath(fname))
+		}
+	}
+	return img, img.validate()
+}
+
+// expandHotspots replaces the hotspots shortcodes in the markdown source of a
+// page at pageURL with annotated images: figures with links over the regions
+// of the image.  Shortcodes in fenced code blocks are left unchanged.
+func expandHotspots(md []byte, fname, pageURL string, idx pageIndex, conf siteConfig) ([]byte, error) {
+	var errs []string
+	expanded := replaceOutsideCode(hotspotsRe, md, func(match []byte) []byte {
+		name := string(hotspotsRe.FindSubmatch(match)[1])
+		img, err := loadAnnotatedImage(fname, name)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+			return match
+		}
+		img.Image = idx.rebaseLink(img.Image, pageURL, conf)
+		for r := range img.Regions {
+			img.Regions[r].Href = idx.rebaseLink(img.Regions[r].Href, pageURL, conf)
+		}
+		out := new(bytes.Buffer)
+		if err := annotatedImageTemplate.Execute(out, img); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+			return match
+		}
+		// blank lines keep the figure a block of raw HTML
+		return []byte("\n" + out.String() + "\n")
+	})
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("expanding hotspots in %q: %s", fname, strings.Join(errs, "; "))
+	}
+	return expanded, nil
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// humansConfig configures humans.txt and the colophon page, which credit the
+// people behind the site and the software it is made with.
+type humansConfig struct {
+	// Enabled generates humans.txt in the destination root.
+	Enabled bool `mapstructure:"Enabled"`
+	// Team lists the people behind the site.  It defaults to the authors.
+	Team []human `mapstructure:"Team"`
+	// Thanks lists the people and projects to thank.
+	Thanks []string `mapstructure:"Thanks"`
+	// Tools lists the software used to make the site besides statiko.
+	Tools []string `mapstructure:"Tools"`
+	// ColophonOutput is the path, relative to DestinationPath, of the
+	// colophon page.  Empty disables the page.
+	ColophonOutput string `mapstructure:"ColophonOutput"`
+	// ColophonIntro is markdown text rendered above the details of the
+	// colophon.
+	ColophonIntro string `mapstructure:"ColophonIntro"`
+}
+
+// human is a member of the team of the site.
+type human struct {
+	Name     string `mapstructure:"Name"`
+	Role     string `mapstructure:"Role"`
+	Site     string `mapstructure:"Site"`
+	Location string `mapstructure:"Location"`
+}
+
+func (c humansConfig) validate() error {
+	for _, h := range c.Team {
+		if h.Name == "" {
+			return fmt.Errorf("humans team member without a name")
+		}
+	}
+	return nil
+}
+
+// colophon holds the credits of the site for humans.txt and the colophon
+// page.
+type colophon struct {
+	team     []human
+	thanks   []string
+	software string
+	theme    string
+	fonts    []string
+	tools    []string
+}
+
+// newColophon collects the credits of the site from the config and the build
+// information of statiko.
+func newColophon(conf siteConfig) colophon {
+	c := colophon{
+		team:     conf.Humans.Team,
+		thanks:   conf.Humans.Thanks,
+		software: verstr,
+		tools:    conf.Humans.Tools,
+	}
+	if len(c.team) == 0 {
+		ids := make([]string, 0, len(conf.Authors))
+		for id := range conf.Authors {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			author := conf.author(id)
+			c.team = append(c.team, human{Name: author.Name, Site: author.URL})
+		}
+	}
+	if conf.ThemePath != "" {
+		c.theme = filepath.Base(conf.ThemePath)
+	}
+	seen := map[string]bool{}
+	for _, font := range conf.Fonts.Files {
+		if !seen[font.Family] {
+			seen[font.Family] = true
+			c.fonts = append(c.fonts, font.Family)
+		}
+	}
+	return c
+}
+
+// site returns the details of how the site is made, as label and value pairs.
+func (c colophon) site() [][2]string {
+	details := [][2]string{{"Software", c.software}}
+	if c.theme != "" {
+		details = append(details, [2]string{"Theme", c.theme})
+	}
+	if len(c.fonts) > 0 {
+		details = append(details, [2]string{"Fonts", strings.Join(c.fonts, ", ")})
+	}
+	if len(c.tools) > 0 {
+		details = append(details, [2]string{"Tools", strings.Join(c.tools, ", ")})
+	}
+	return details
+}
+
+// humansTxt returns the contents of humans.txt in the format of
+// humanstxt.org.  The build date is left out, so the file only changes with
+// the config or the version of statiko.
+func humansTxt(c colophon) string {
+	var b strings.Builder
+	if len(c.team) > 0 {
+		b.WriteString("/* TEAM */\n")
+		for idx, h := range c.team {
+			if idx > 0 {
+				b.WriteString("\n")
+			}
+			for _, field := range [][2]string{{"Name", h.Name}, {"Role", h.Role}, {"Site", h.Site}, {"Location", h.Location}} {
+				if field[1] != "" {
+					fmt.Fprintf(&b, "\t%s: %s\n", field[0], field[1])
+				}
+			}
+		}
+		b.WriteString("\n")
+	}
+	if len(c.thanks) > 0 {
+		b.WriteString("/* THANKS */\n")
+		for _, thanks := range c.thanks {
+			fmt.Fprintf(&b, "\t%s\n", thanks)
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("/* SITE */\n")
+	for _, detail := range c.site() {
+		fmt.Fprintf(&b, "\t%s: %s\n", detail[0], detail[1])
+	}
+	return b.String()
+}
+
+// markdown returns the body of the colophon page below the intro.
+func (c colophon) markdown() string {
+	var b strings.Builder
+	if len(c.team) > 0 {
+		b.WriteString("## Team\n\n")
+		for _, h := range c.team {
+			name := h.Name
+			if h.Site != "" {
+				name = fmt.Sprintf("[%s](%s)", h.Name, h.Site)
+			}
+			var details []string
+			for _, detail := range []string{h.Role, h.Location} {
+				if detail != "" {
+					details = append(details, detail)
+				}
+			}
+			if len(details) > 0 {
+				name += " (" + strings.Join(details, ", ") + ")"
+			}
+			fmt.Fprintf(&b, "- %s\n", name)
+		}
+		b.WriteString("\n")
+	}
+	if len(c.thanks) > 0 {
+		b.WriteString("## Thanks\n\n")
+		for _, thanks := range c.thanks {
+			fmt.Fprintf(&b, "- %s\n", thanks)
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("## Made with\n\n")
+	for _, detail := range c.site() {
+		fmt.Fprintf(&b, "- %s: %s\n", detail[0], detail[1])
+	}
+	return b.String()
+}
+
+func writeHumans(conf siteConfig) error {
+	if !conf.Humans.Enabled {
+		return nil
+	}
+	outpath := filepath.Join(conf.DestinationPath, "humans.txt")
+	fmt.Printf("   Saving humans.txt: %s\n", outpath)
+	if err := os.WriteFile(outpath, []byte(humansTxt(newColophon(conf))), 0666); err != nil {
+		return fmt.Errorf("writing humans.txt %q: %w", outpath, err)
+	}
+	return nil
+}
+
+// renderColophon generates the colophon page, which lists the team, thanks,
+// and the software, theme, and fonts the site is made with.
+func renderColophon(conf siteConfig) error {
+	if conf.Humans.ColophonOutput == "" {
+		return nil
+	}
+	fmt.Println(":: Generating colophon page")
+	url := filepath.ToSlash(conf.Humans.ColophonOutput)
+	outpath := filepath.Join(conf.DestinationPath, conf.Humans.ColophonOutput)
+	if err := os.MkdirAll(filepath.Dir(outpath), 0777); err != nil {
+		return fmt.Errorf("generating colophon page: creating path %q: %w", filepath.Dir(outpath), err)
+	}
+
+	bodystr := "# Colophon\n\n" + conf.Humans.ColophonIntro + "\n\n" + newColophon(conf).markdown()
+	data := newTemplateData(conf)
+	data.Page = frontMatter{Title: "Colophon"}
+	data.RelRoot = relRootOf(url)
+	data.Permalink = conf.absoluteURL(url)
+	data.Body = template.HTML(renderBody(parseMD([]byte(bodystr)), newPageRenderer(conf), conf))
+
+	htmlData, err := makeHTML(data, conf.PageTemplateFile, conf)
+	if err != nil {
+		return fmt.Errorf("generating colophon page: %w", err)
+	}
+	fmt.Printf("   Saving colophon page: %s\n", outpath)
+	if err := os.WriteFile(outpath, htmlData, 0666); err != nil {
+		return fmt.Errorf("generating colophon page: writing %q: %w", outpath, err)
+	}
+	return nil
+}
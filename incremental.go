@@ -0,0 +1,239 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// buildCacheName is the name of the cache of incremental builds in the build
+// store.
+const buildCacheName = "build-cache.json"
+
+// buildCache records the inputs and outputs of the pages of the previous
+// build, so that pages whose inputs did not change are not rendered again.
+// Listings and feeds are always regenerated.
+type buildCache struct {
+	// Destination is the destination the cache describes.  A cache of
+	// another destination is ignored.
+	Destination string `json:"destination"`
+	// Site is the hash of the inputs shared by all pages: the config,
+	// templates, theme assets, glossary, and resources.
+	Site string `json:"site"`
+	// Pages maps the source file of each page to its inputs and outputs.
+	Pages map[string]cachedPage `json:"pages"`
+}
+
+type cachedPage struct {
+	// Input is the hash of the inputs of the page.
+	Input string `json:"input"`
+	// Outputs maps the files written for the page to the hashes of their
+	// contents.
+	Outputs map[string]string `json:"outputs"`
+}
+
+// cacheStore returns the store of the build cache: the configured storage,
+// or else the .statiko directory.
+func cacheStore(conf siteConfig) buildStore {
+	store := newBuildStore(conf.Storage)
+	if store == nil {
+		store = fileStore(".statiko")
+	}
+	if conf.audience != "" {
+		return audienceStore{store, conf.audience}
+	}
+	return store
+}
+
+// loadBuildCache reads the cache of the previous build.  A missing, invalid,
+// or foreign cache is treated as empty.
+func loadBuildCache(store buildStore, conf siteConfig) *buildCache {
+	empty := &buildCache{Destination: absPath(conf.DestinationPath), Pages: map[string]cachedPage{}}
+	data, err := store.Load(buildCacheName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: loading build cache: %v\n", err)
+		return empty
+	}
+	if data == nil {
+		return empty
+	}
+	cache := &buildCache{}
+	if err := json.Unmarshal(data, cache); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: ignoring invalid build cache: %v\n", err)
+		return empty
+	}
+	if cache.Destination != empty.Destination || cache.Pages == nil {
+		return empty
+	}
+	return cache
+}
+
+func (bc *buildCache) save(store buildStore) error {
+	data, err := json.MarshalIndent(bc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding build cache: %w", err)
+	}
+	if err := store.Save(buildCacheName, data); err != nil {
+		return fmt.Errorf("saving build cache: %w", err)
+	}
+	return nil
+}
+
+// hashInputs returns the hex encoded hash of a sequence of inputs.  Each
+// input is prefixed with its length, so that inputs cannot run into each
+// other.
+func hashInputs(inputs ...[]byte) string {
+	h := sha256.New()
+	for _, input := range inputs {
+		fmt.Fprintf(h, "%d:", len(input))
+		h.Write(input)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// readOptional reads a file that may not exist.
+func readOptional(fname string) ([]byte, error) {
+	content, err := os.ReadFile(fname)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return content, err
+}
+
+// siteInputHash hashes the inputs shared by all pages.
+func siteInputHash(conf siteConfig, glossary []definition, bib bibliography) (string, error) {
+	var inputs [][]byte
+	add := func(v any) error {
+		data, err := json.Marshal(v)
+		inputs = append(inputs, data)
+		return err
+	}
+	if err := add(conf); err != nil {
+		return "", err
+	}
+	if err := add(conf.assets); err != nil {
+		return "", err
+	}
+	if err := add(glossary); err != nil {
+		return "", err
+	}
+	if err := add(bib); err != nil {
+		return "", err
+	}
+	for _, fname := range conf.templateFiles() {
+		content, err := readOptional(fname)
+		if err != nil {
+			return "", err
+		}
+		inputs = append(inputs, content)
+	}
+	// resources end up in pages as placeholders, preload hints, and color
+	// scheme variants, and bundle fingerprints in the pages that use them;
+	// shortcode templates end up in the pages that use them.  They are
+	// identified by size and modification time rather than hashed, since
+	// ResourcePath can hold gigabytes of media.
+	for _, root := range []string{conf.ResourcePath, conf.BundlePath, conf.ShortcodePath} {
+		tree, err := statTree(root)
+		if err != nil {
+			return "", err
+		}
+		locs := make([]string, 0, len(tree))
+		for loc := range tree {
+			locs = append(locs, loc)
+		}
+		sort.Strings(locs)
+		for _, loc := range locs {
+			inputs = append(inputs, []byte(loc), []byte(tree[loc]))
+		}
+	}
+	return hashInputs(inputs...), nil
+}
+
+// statTree maps the files under a directory to their sizes and modification
+// times, which tell their versions apart without reading them.
+func statTree(root string) (map[string]string, error) {
+	tree := map[string]string{}
+	walker := func(loc string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			tree[loc] = fmt.Sprintf("%d %d", info.Size(), info.ModTime().UnixNano())
+		}
+		return nil
+	}
+	if err := filepath.Walk(root, walker); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("reading %q: %w", root, err)
+	}
+	return tree, nil
+}
+
+// hashOutputs hashes the files written for a page.
+func hashOutputs(fnames []string) (map[string]string, error) {
+	outputs := make(map[string]string, len(fnames))
+	for _, fname := range fnames {
+		sum, err := hashFile(fname)
+		if err != nil {
+			return nil, err
+		}
+		outputs[filepath.ToSlash(fname)] = hex.EncodeToString(sum[:])
+	}
+	return outputs, nil
+}
+
+// upToDate reports whether the page was rendered from the given inputs and
+// its outputs are unchanged since.
+func (cp cachedPage) upToDate(input string) bool {
+	if cp.Input != input || len(cp.Outputs) == 0 {
+		return false
+	}
+	for fname, sum := range cp.Outputs {
+		current, err := hashFile(filepath.FromSlash(fname))
+		if err != nil {
+			return false
+		}
+		if hex.EncodeToString(current[:]) != sum {
+			return false
+		}
+	}
+	return true
+}
+
+// pageInputHash hashes the inputs of a page: its source after resolving
+// links, its metadata file, its template if it overrides the configured one,
+// its stale notice, which depends on the date of the build, and the template
+// data that depends on other pages.
+func pageInputHash(fname string, md []byte, kind pageKind, notice string, data templateData) (string, error) {
+	metadata, err := readOptional(metadataPath(fname))
+	if err != nil {
+		return "", err
+	}
+	var tmpl []byte
+	if data.Page.Template != "" {
+		if tmpl, err = readOptional(data.Page.Template); err != nil {
+			return "", err
+		}
+	}
+	shared, err := json.Marshal(struct {
+		Kind        pageKind
+		Notice      string
+		Page        frontMatter
+		Sidebar     string
+		Backlinks   []pageLink
+		Series      seriesNav
+		Related     []pageLink
+		PrevPost    *pageLink
+		NextPost    *pageLink
+		Reactions   reactionCounts
+		Webmentions pageMentions
+	}{kind, notice, data.Page, string(data.Sidebar), data.Backlinks, data.Series, data.Related, data.PrevPost, data.NextPost, data.Reactions, data.Webmentions})
+	if err != nil {
+		return "", err
+	}
+	return hashInputs(md, metadata, tmpl, shared), nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const initConfigYAML = `SiteName: %q
+SourcePath: pages-md
+DestinationPath: html
+PageTemplateFile: templates/template.html
+ResourcePath: res
+`
+
+const initTemplateHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{if .Meta.Title}}{{.Meta.Title}} - {{end}}{{.SiteName}}</title>
+<link rel="stylesheet" href="{{.RelRoot}}/res/style.css">
+{{.MetaTags}}
+</head>
+<body>
+<header><a href="{{.RelRoot}}/index.html">{{.SiteName}}</a></header>
+<main>
+{{.Sidebar}}
+{{.Body}}
+</main>
+</body>
+</html>
+`
+
+const initStyleCSS = `body {
+  max-width: 40em;
+  margin: 0 auto;
+  padding: 1em;
+  font-family: sans-serif;
+  line-height: 1.5;
+}
+`
+
+const initIndexMD = `# %s
+
+Welcome to the new site.  Edit pages-md/index.md and run statiko to build it
+into html/.
+`
+
+// initFile is a file of a new site, with its path relative to the site root.
+type initFile struct {
+	path    string
+	content string
+}
+
+// initSite creates the default config, directories, template, stylesheet,
+// and index page of a new site in root.  Existing files are left alone.
+func initSite(root, name string) error {
+	files := []initFile{
+		{"config.yaml", fmt.Sprintf(initConfigYAML, name)},
+		{"templates/template.html", initTemplateHTML},
+		{"res/style.css", initStyleCSS},
+		{"pages-md/index.md", fmt.Sprintf(initIndexMD, name)},
+	}
+	for _, file := range files {
+		loc := filepath.Join(root, filepath.FromSlash(file.path))
+		if _, err := os.Stat(loc); err == nil {
+			fmt.Printf("   %s exists, skipping\n", loc)
+			continue
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("init: %w", err)
+		}
+		if err := os.MkdirAll(filepath.Dir(loc), 0777); err != nil {
+			return fmt.Errorf("init: creating path %q: %w", filepath.Dir(loc), err)
+		}
+		fmt.Printf("   Creating %s\n", loc)
+		if err := os.WriteFile(loc, []byte(file.content), 0666); err != nil {
+			return fmt.Errorf("init: writing %q: %w", loc, err)
+		}
+	}
+	return nil
+}
+
+// runInit bootstraps a new site in the given directory, or in the working
+// directory.
+func runInit(args []string) error {
+	flags := flag.NewFlagSet("init", flag.ExitOnError)
+	name := flags.String("name", "", "name of the site (default: the name of the directory)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: statiko init [options] [directory]\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return fmt.Errorf("init: expected at most one directory")
+	}
+	root := "."
+	if flags.NArg() == 1 {
+		root = argPath(flags.Arg(0))
+	}
+	if *name == "" {
+		*name = filepath.Base(absPath(root))
+	}
+
+	fmt.Printf(":: Initializing site %q in %s\n", *name, root)
+	if err := initSite(root, *name); err != nil {
+		return err
+	}
+	cmd := "statiko"
+	if root != "." {
+		cmd = fmt.Sprintf("cd %s && statiko", root)
+	}
+	fmt.Printf(":: Run %s to build the site into %s\n", cmd, filepath.Join(root, "html"))
+	return nil
+}
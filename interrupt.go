@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+)
+
+// errInterrupted is returned by builds stopped by SIGINT or SIGTERM.
+var errInterrupted = errors.New("build interrupted")
+
+// interrupted is set when the build receives SIGINT or SIGTERM.
+var interrupted atomic.Bool
+
+// catchInterrupts makes SIGINT and SIGTERM stop the build at the next page
+// or stage instead of killing it, so that the pages rendered so far are kept
+// in the build cache.  A second signal exits at once.  The returned function
+// restores the default handling of the signals.
+func catchInterrupts() func() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-signals:
+		case <-done:
+			return
+		}
+		fmt.Fprintln(os.Stderr, "\n:: Interrupted, stopping after the current page (interrupt again to exit at once)")
+		interrupted.Store(true)
+		select {
+		case <-signals:
+			os.Exit(130)
+		case <-done:
+		}
+	}()
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
+
+// checkInterrupted returns errInterrupted if the build was interrupted.
+func checkInterrupted() error {
+	if interrupted.Load() {
+		return errInterrupted
+	}
+	return nil
+}
+
+// saveInterrupted saves the build cache of a build interrupted before
+// rendering the remaining pages.  The pages rendered so far are cached with
+// their new inputs and the remaining pages keep their entries of the previous
+// build, so the next build only renders the pages that are still out of date.
+func saveInterrupted(remaining []string, prevCache, cache *buildCache, store buildStore) error {
+	fmt.Printf(":: Stopping with %d page%s left\n", len(remaining), plural(len(remaining)))
+	if cache == nil {
+		fmt.Println("   Enable Incremental to resume interrupted builds")
+		return errInterrupted
+	}
+	for _, fname := range remaining {
+		if prev, ok := prevCache.Pages[fname]; ok {
+			cache.Pages[fname] = prev
+		}
+	}
+	if err := cache.save(store); err != nil {
+		return fmt.Errorf("rendering pages: %w", err)
+	}
+	fmt.Println("   Saved the build cache, the next build resumes from there")
+	return errInterrupted
+}
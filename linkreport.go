@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// homePage is the URL of the page link depths are measured from.
+const homePage = "index.html"
+
+// htmlLinks returns the targets of the links of an HTML page, as URLs
+// relative to the site root.
+func htmlLinks(content []byte, pageURL string) []string {
+	var targets []string
+	tokenizer := html.NewTokenizer(bytes.NewReader(content))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return targets
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := tokenizer.TagName()
+			if string(name) != "a" {
+				continue
+			}
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = tokenizer.TagAttr()
+				if string(key) != "href" {
+					continue
+				}
+				href := string(val)
+				target := linkTarget(href, pageURL)
+				if target != "" && (strings.HasSuffix(href, "/") || path.Ext(target) == "") {
+					target = path.Join(target, "index.html")
+				}
+				if target != "" {
+					targets = append(targets, target)
+				}
+			}
+		}
+	}
+}
+
+// siteLinks reads the rendered pages in the destination and returns the
+// internal links between them, keyed by page URL.
+func siteLinks(conf siteConfig) (map[string][]string, error) {
+	links := map[string][]string{}
+	walker := func(loc string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() || filepath.Ext(loc) != ".html" {
+			return nil
+		}
+		content, err := os.ReadFile(loc)
+		if err != nil {
+			return fmt.Errorf("reading page %q: %w", loc, err)
+		}
+		pageURL := siteURL(loc, conf)
+		links[pageURL] = htmlLinks(content, pageURL)
+		return nil
+	}
+	if err := filepath.Walk(conf.DestinationPath, walker); err != nil {
+		return nil, fmt.Errorf("collecting links: %w", err)
+	}
+	// keep only links to pages
+	for url, targets := range links {
+		var pageTargets []string
+		for _, target := range targets {
+			if _, isPage := links[target]; isPage && target != url {
+				pageTargets = append(pageTargets, target)
+			}
+		}
+		links[url] = pageTargets
+	}
+	return links, nil
+}
+
+// clickDepths returns the minimum number of clicks needed to reach each page
+// from the home page.  Unreachable pages are not included.
+func clickDepths(links map[string][]string) map[string]int {
+	depths := map[string]int{homePage: 0}
+	queue := []string{homePage}
+	for len(queue) > 0 {
+		url := queue[0]
+		queue = queue[1:]
+		for _, target := range links[url] {
+			if _, visited := depths[target]; !visited {
+				depths[target] = depths[url] + 1
+				queue = append(queue, target)
+			}
+		}
+	}
+	return depths
+}
+
+// writeLinkReport prints the click depth of each page, the pages deeper than
+// maxDepth or unreachable from the home page, and the pages that link to no
+// other page.
+func writeLinkReport(w io.Writer, links map[string][]string, maxDepth int) {
+	urls := make([]string, 0, len(links))
+	for url := range links {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+	depths := clickDepths(links)
+
+	var reachable, deep, unreachable, deadEnds []string
+	for _, url := range urls {
+		depth, ok := depths[url]
+		switch {
+		case !ok:
+			unreachable = append(unreachable, url)
+		case depth > maxDepth:
+			deep = append(deep, url)
+			fallthrough
+		default:
+			reachable = append(reachable, url)
+		}
+		if len(links[url]) == 0 {
+			deadEnds = append(deadEnds, url)
+		}
+	}
+	sort.SliceStable(reachable, func(i, j int) bool {
+		return depths[reachable[i]] < depths[reachable[j]]
+	})
+
+	fmt.Fprintf(w, ":: Click depth from %s\n", homePage)
+	for _, url := range reachable {
+		fmt.Fprintf(w, "   %d: %s\n", depths[url], url)
+	}
+	fmt.Fprintf(w, ":: %d page%s more than %d click%s deep\n", len(deep), plural(len(deep)), maxDepth, plural(maxDepth))
+	for _, url := range deep {
+		fmt.Fprintf(w, "   %s (%d)\n", url, depths[url])
+	}
+	fmt.Fprintf(w, ":: %d unreachable page%s\n", len(unreachable), plural(len(unreachable)))
+	for _, url := range unreachable {
+		fmt.Fprintf(w, "   %s\n", url)
+	}
+	fmt.Fprintf(w, ":: %d dead-end page%s\n", len(deadEnds), plural(len(deadEnds)))
+	for _, url := range deadEnds {
+		fmt.Fprintf(w, "   %s\n", url)
+	}
+}
+
+func runLinkReport(args []string) error {
+	flags := flag.NewFlagSet("link-report", flag.ExitOnError)
+	maxDepth := flags.Int("max-depth", 3, "report pages more than this many clicks from the home page")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	conf, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	links, err := siteLinks(conf)
+	if err != nil {
+		return err
+	}
+	if _, ok := links[homePage]; !ok {
+		return errors.New("link report: no home page (index.html) in the destination; build the site first")
+	}
+	writeLinkReport(os.Stdout, links, *maxDepth)
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// reloadPath is the URL path of the event stream that tells browsers to
+// reload after a rebuild.
+const reloadPath = "/_statiko/reload"
+
+// reloadScript reloads the page when the server reports a rebuild.  The
+// browser reconnects the event stream on its own when the server restarts.
+const reloadScript = `<script>new EventSource("` + reloadPath + `").onmessage = function() { location.reload(); };</script>`
+
+// reloadBroadcaster notifies the connected browsers of rebuilds.
+type reloadBroadcaster struct {
+	mu      sync.Mutex
+	clients map[chan struct{}]bool
+}
+
+func newReloadBroadcaster() *reloadBroadcaster {
+	return &reloadBroadcaster{clients: map[chan struct{}]bool{}}
+}
+
+// notify tells all connected browsers to reload.
+func (rb *reloadBroadcaster) notify() {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	for client := range rb.clients {
+		select {
+		case client <- struct{}{}:
+		default:
+			// a reload is already pending
+		}
+	}
+}
+
+// ServeHTTP streams reload events to a browser until it disconnects.
+func (rb *reloadBroadcaster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	client := make(chan struct{}, 1)
+	rb.mu.Lock()
+	rb.clients[client] = true
+	rb.mu.Unlock()
+	defer func() {
+		rb.mu.Lock()
+		delete(rb.clients, client)
+		rb.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher.Flush()
+	for {
+		select {
+		case <-client:
+			fmt.Fprint(w, "data: reload\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// injectReloadScript adds the reload script to an HTML page, before the end
+// of the body if there is one.
+func injectReloadScript(page []byte) []byte {
+	idx := bytes.LastIndex(bytes.ToLower(page), []byte("</body>"))
+	if idx < 0 {
+		return append(page, reloadScript...)
+	}
+	injected := make([]byte, 0, len(page)+len(reloadScript))
+	injected = append(injected, page[:idx]...)
+	injected = append(injected, reloadScript...)
+	return append(injected, page[idx:]...)
+}
+
+// liveReloadHandler serves the files under root, with the reload script
+// injected into HTML pages, and the reload event stream.
+func liveReloadHandler(root string, rb *reloadBroadcaster) http.Handler {
+	files := http.FileServer(http.Dir(root))
+	mux := http.NewServeMux()
+	mux.Handle(reloadPath, rb)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		urlpath := path.Clean("/" + r.URL.Path)
+		fpath := filepath.Join(root, filepath.FromSlash(urlpath))
+		if strings.HasSuffix(r.URL.Path, "/") {
+			fpath = filepath.Join(fpath, "index.html")
+		}
+		if filepath.Ext(fpath) != ".html" {
+			files.ServeHTTP(w, r)
+			return
+		}
+		info, err := os.Stat(fpath)
+		if err != nil || info.IsDir() {
+			files.ServeHTTP(w, r)
+			return
+		}
+		page, err := os.ReadFile(fpath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-cache")
+		http.ServeContent(w, r, fpath, info.ModTime(), bytes.NewReader(injectReloadScript(page)))
+	})
+	return mux
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// errLocked is returned when another build holds the lock of the destination.
+var errLocked = errors.New("locked by another build")
+
+// buildLock is an exclusive lock on the destination, held for the duration of
+// a build so that overlapping builds cannot interleave their writes.
+type buildLock struct {
+	file *os.File
+}
+
+// lockPath returns the path of the lock file of the destination.  It is kept
+// next to the destination rather than inside it, so that it is never
+// published.
+func lockPath(conf siteConfig) string {
+	return filepath.Clean(conf.DestinationPath) + ".lock"
+}
+
+// lockOwner describes the process holding a lock, as recorded in the lock
+// file.
+func lockOwner(fname string) string {
+	owner, err := os.ReadFile(fname)
+	if err != nil || len(strings.TrimSpace(string(owner))) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (pid %s)", strings.TrimSpace(string(owner)))
+}
+
+// lockDestination takes the lock of the destination.  If another build holds
+// it, lockDestination waits for it to be released when wait is true and fails
+// otherwise.
+func lockDestination(conf siteConfig, wait bool) (*buildLock, error) {
+	fname := lockPath(conf)
+	fp, err := os.OpenFile(fname, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("opening lock file %q: %w", fname, err)
+	}
+	err = lockFile(fp, false)
+	if errors.Is(err, errLocked) && wait {
+		fmt.Printf(":: Waiting for the build holding %s%s\n", fname, lockOwner(fname))
+		err = lockFile(fp, true)
+	}
+	if errors.Is(err, errLocked) {
+		fp.Close()
+		return nil, fmt.Errorf("destination %q is %w%s; use -wait to queue", conf.DestinationPath, err, lockOwner(fname))
+	}
+	if err != nil {
+		fp.Close()
+		return nil, fmt.Errorf("locking %q: %w", fname, err)
+	}
+
+	// record the owner for the messages of waiting builds
+	if err := fp.Truncate(0); err == nil {
+		fmt.Fprintf(fp, "%d\n", os.Getpid())
+	}
+	return &buildLock{file: fp}, nil
+}
+
+// unlock releases the lock.  The lock file is left in place, since removing
+// it would race with builds waiting on it.
+func (bl *buildLock) unlock() {
+	if err := bl.file.Truncate(0); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: clearing lock file: %v\n", err)
+	}
+	if err := unlockFile(bl.file); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: releasing build lock: %v\n", err)
+	}
+	if err := bl.file.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: closing lock file: %v\n", err)
+	}
+}
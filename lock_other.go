@@ -0,0 +1,31 @@
+//go:build !unix
+
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// lockFile emulates an exclusive lock with a marker file created next to the
+// lock file.  Unlike the unix lock, a stale marker left by a crashed build has
+// to be removed by hand.
+func lockFile(fp *os.File, wait bool) error {
+	for {
+		marker, err := os.OpenFile(fp.Name()+".held", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0666)
+		if err == nil {
+			return marker.Close()
+		}
+		if !os.IsExist(err) {
+			return err
+		}
+		if !wait {
+			return errLocked
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+func unlockFile(fp *os.File) error {
+	return os.Remove(fp.Name() + ".held")
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// accessLogRe matches lines of the common and combined log formats.  The
+// referrer and user agent are only present in the combined format.
+var accessLogRe = regexp.MustCompile(`^(\S+) \S+ \S+ \[([^\]]+)\] "(\S+) (\S+)[^"]*" (\d{3}) \S+(?: "([^"]*)" "([^"]*)")?`)
+
+const accessLogTime = "02/Jan/2006:15:04:05 -0700"
+
+// botRe matches the user agents of crawlers and monitoring services, whose
+// requests are not counted.
+var botRe = regexp.MustCompile(`(?i)bot|crawl|spider|slurp|fetch|monitor|curl|wget|python-requests`)
+
+// logHit is a successful request of a page in an access log.
+type logHit struct {
+	visitor  string
+	day      string
+	page     string
+	referrer string
+}
+
+// parseLogLine returns the page hit recorded by a log line.  ok is false for
+// malformed lines and for requests that are not successful page views by
+// people: other methods, errors, assets, and bots.
+func parseLogLine(line string) (hit logHit, ok bool) {
+	m := accessLogRe.FindStringSubmatch(line)
+	if m == nil {
+		return hit, false
+	}
+	if m[3] != "GET" || !strings.HasPrefix(m[5], "2") {
+		return hit, false
+	}
+	if botRe.MatchString(m[7]) {
+		return hit, false
+	}
+	when, err := time.Parse(accessLogTime, m[2])
+	if err != nil {
+		return hit, false
+	}
+	page, _, _ := strings.Cut(m[4], "?")
+	if ext := path.Ext(page); ext != "" && ext != ".html" {
+		return hit, false
+	}
+	if strings.HasSuffix(page, "/") {
+		page += "index.html"
+	}
+	hit = logHit{visitor: m[1], day: when.UTC().Format(time.DateOnly), page: page}
+	if ref, err := url.Parse(m[6]); err == nil && ref.Host != "" {
+		hit.referrer = strings.TrimPrefix(ref.Host, "www.")
+	}
+	return hit, true
+}
+
+type statsCount struct {
+	Name  string
+	Count int
+}
+
+// statsDay holds the page views and unique visitors of a day.
+type statsDay struct {
+	Day      string
+	Views    int
+	Visitors int
+	// Width is the length of the bar of the day in percent of the busiest
+	// day.
+	Width int
+}
+
+type siteStats struct {
+	From, To  string
+	Views     int
+	Visitors  int
+	Skipped   int
+	Pages     []statsCount
+	Referrers []statsCount
+	Days      []statsDay
+}
+
+// topCounts returns the n largest counts, sorted by count and name.
+func topCounts(counts map[string]int, n int) []statsCount {
+	sorted := make([]statsCount, 0, len(counts))
+	for name, count := range counts {
+		sorted = append(sorted, statsCount{name, count})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Count != sorted[j].Count {
+			return sorted[i].Count > sorted[j].Count
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
+
+// collectStats counts the page views in access logs.  Referrers from the
+// hosts in self are not counted.
+func collectStats(logs []io.Reader, self map[string]bool, top int) (siteStats, error) {
+	var stats siteStats
+	pages := map[string]int{}
+	referrers := map[string]int{}
+	views := map[string]int{}
+	dayVisitors := map[string]map[string]bool{}
+	visitors := map[string]bool{}
+	for _, log := range logs {
+		scanner := bufio.NewScanner(log)
+		for scanner.Scan() {
+			hit, ok := parseLogLine(scanner.Text())
+			if !ok {
+				stats.Skipped++
+				continue
+			}
+			stats.Views++
+			pages[hit.page]++
+			if hit.referrer != "" && !self[hit.referrer] {
+				referrers[hit.referrer]++
+			}
+			views[hit.day]++
+			if dayVisitors[hit.day] == nil {
+				dayVisitors[hit.day] = map[string]bool{}
+			}
+			dayVisitors[hit.day][hit.visitor] = true
+			visitors[hit.visitor] = true
+		}
+		if err := scanner.Err(); err != nil {
+			return stats, err
+		}
+	}
+	stats.Visitors = len(visitors)
+	stats.Pages = topCounts(pages, top)
+	stats.Referrers = topCounts(referrers, top)
+
+	busiest := 0
+	for day, count := range views {
+		stats.Days = append(stats.Days, statsDay{Day: day, Views: count, Visitors: len(dayVisitors[day])})
+		busiest = max(busiest, count)
+	}
+	sort.Slice(stats.Days, func(i, j int) bool { return stats.Days[i].Day < stats.Days[j].Day })
+	for idx := range stats.Days {
+		stats.Days[idx].Width = stats.Days[idx].Views * 100 / busiest
+	}
+	if len(stats.Days) > 0 {
+		stats.From, stats.To = stats.Days[0].Day, stats.Days[len(stats.Days)-1].Day
+	}
+	return stats, nil
+}
+
+const siteStatsHTML = `<h1>Visitor stats</h1>
+<p class="stats-summary">{{.Views}} page views by {{.Visitors}} visitors{{if .From}} from {{.From}} to {{.To}}{{end}}.</p>
+<h2>Daily views</h2>
+<table class="stats-days">
+<tr><th>Day</th><th>Views</th><th>Visitors</th><th></th></tr>
+{{- range .Days}}
+<tr><td>{{.Day}}</td><td>{{.Views}}</td><td>{{.Visitors}}</td><td><div class="stats-bar" style="width: {{.Width}}%; background: currentColor; height: 0.8em"></div></td></tr>
+{{- end}}
+</table>
+<h2>Top pages</h2>
+<table class="stats-pages">
+<tr><th>Page</th><th>Views</th></tr>
+{{- range .Pages}}
+<tr><td>{{.Name}}</td><td>{{.Count}}</td></tr>
+{{- end}}
+</table>
+<h2>Top referrers</h2>
+<table class="stats-referrers">
+<tr><th>Site</th><th>Views</th></tr>
+{{- range .Referrers}}
+<tr><td>{{.Name}}</td><td>{{.Count}}</td></tr>
+{{- end}}
+</table>
+`
+
+var siteStatsTemplate = template.Must(template.New("stats").Parse(siteStatsHTML))
+
+// runLogStats renders a stats page of the page views in server access logs
+// with the page template of the site.  The page is written outside the
+// destination by default, since the stats are private.
+func runLogStats(args []string) error {
+	flags := flag.NewFlagSet("logstats", flag.ExitOnError)
+	out := flags.String("out", "", "file to write the stats page to (default: <DestinationPath>.stats.html)")
+	top := flags.Int("top", 20, "number of pages and referrers to list")
+	hosts := flags.String("host", "", "comma separated host names of the site, whose referrals are not counted")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: statiko logstats [options] <access.log>...\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return fmt.Errorf("logstats: expected at least one log file")
+	}
+	conf, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		*out = strings.TrimSuffix(conf.DestinationPath, "/") + ".stats.html"
+	} else {
+		*out = argPath(*out)
+	}
+	self := map[string]bool{}
+	for _, host := range strings.Split(*hosts, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			self[strings.TrimPrefix(host, "www.")] = true
+		}
+	}
+
+	var logs []io.Reader
+	for _, fname := range flags.Args() {
+		fp, err := os.Open(argPath(fname))
+		if err != nil {
+			return fmt.Errorf("logstats: %w", err)
+		}
+		defer fp.Close()
+		logs = append(logs, fp)
+	}
+	fmt.Printf(":: Reading %d log%s\n", len(logs), plural(len(logs)))
+	stats, err := collectStats(logs, self, *top)
+	if err != nil {
+		return fmt.Errorf("logstats: reading logs: %w", err)
+	}
+	fmt.Printf("   %d page view%s, %d visitor%s, %d skipped line%s\n", stats.Views, plural(stats.Views), stats.Visitors, plural(stats.Visitors), stats.Skipped, plural(stats.Skipped))
+
+	body := new(bytes.Buffer)
+	if err := siteStatsTemplate.Execute(body, stats); err != nil {
+		return fmt.Errorf("logstats: %w", err)
+	}
+	data := newTemplateData(conf)
+	data.Body = template.HTML(body.String())
+	data.Page = frontMatter{Title: "Visitor stats"}
+	// the page links to the resources of the site like its pages do
+	data.RelRoot, _ = filepath.Rel(filepath.Dir(absPath(*out)), absPath(conf.DestinationPath))
+	data.RelRoot = filepath.ToSlash(data.RelRoot)
+	page, err := makeHTML(data, conf.PageTemplateFile, conf)
+	if err != nil {
+		return fmt.Errorf("logstats: %w", err)
+	}
+	fmt.Printf(":: Writing stats page %s\n", *out)
+	if err := os.WriteFile(*out, page, 0666); err != nil {
+		return fmt.Errorf("logstats: writing %q: %w", *out, err)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"  // register GIF decoder
+	_ "image/jpeg" // register JPEG decoder
+	"image/png"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// placeholderWidth is the width in pixels of generated image placeholders.
+const placeholderWidth = 16
+
+// downscale shrinks an image to the given width, preserving the aspect ratio,
+// by averaging the source pixels covered by each destination pixel.
+func downscale(src image.Image, width int) *image.NRGBA {
+	bounds := src.Bounds()
+	sw, sh := bounds.Dx(), bounds.Dy()
+	width = min(width, sw)
+	height := max(sh*width/sw, 1)
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		y0, y1 := bounds.Min.Y+y*sh/height, bounds.Min.Y+(y+1)*sh/height
+		for x := range width {
+			x0, x1 := bounds.Min.X+x*sw/width, bounds.Min.X+(x+1)*sw/width
+			var r, g, b, a, n uint64
+			for sy := y0; sy < max(y1, y0+1); sy++ {
+				for sx := x0; sx < max(x1, x0+1); sx++ {
+					pr, pg, pb, pa := src.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+			off := dst.PixOffset(x, y)
+			if a == 0 {
+				continue
+			}
+			// un-premultiply the averaged colour
+			dst.Pix[off+0] = uint8(r * 0xff / a)
+			dst.Pix[off+1] = uint8(g * 0xff / a)
+			dst.Pix[off+2] = uint8(b * 0xff / a)
+			dst.Pix[off+3] = uint8(a / n >> 8)
+		}
+	}
+	return dst
+}
+
+// makePlaceholder returns a data URI of a tiny version of the image file,
+// which browsers blur when scaling it up.
+func makePlaceholder(fname string) (string, error) {
+	fp, err := os.Open(fname)
+	if err != nil {
+		return "", err
+	}
+	defer fp.Close()
+	img, _, err := image.Decode(fp)
+	if err != nil {
+		return "", fmt.Errorf("decoding image %q: %w", fname, err)
+	}
+	if img.Bounds().Empty() {
+		return "", fmt.Errorf("decoding image %q: empty image", fname)
+	}
+
+	encoded := new(bytes.Buffer)
+	if err := png.Encode(encoded, downscale(img, placeholderWidth)); err != nil {
+		return "", fmt.Errorf("encoding placeholder for %q: %w", fname, err)
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(encoded.Bytes()), nil
+}
+
+// localImagePath finds the file of an image referenced from a page.  Images
+// are looked up in the destination first and then relative to the working
+// directory, which covers files under the ResourcePath before they are
+// copied.  It returns an empty string for remote or missing images.
+func localImagePath(src, pageURL string, conf siteConfig) string {
+	if src == "" || isRemoteURL(src) || strings.HasPrefix(src, "//") {
+		return ""
+	}
+	src, _, _ = strings.Cut(src, "?")
+	src, _, _ = strings.Cut(src, "#")
+	var sitepath string
+	if path.IsAbs(src) {
+		sitepath = path.Clean(src)[1:]
+	} else {
+		sitepath = path.Join(path.Dir(pageURL), src)
+	}
+	if strings.HasPrefix(sitepath, "../") {
+		return ""
+	}
+	for _, candidate := range []string{filepath.Join(conf.DestinationPath, sitepath), filepath.FromSlash(sitepath)} {
+		if info, err := os.Stat(candidate); err == nil && info.Mode().IsRegular() {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// addImagePlaceholders generates placeholders for the local images of a page.
+// Each image gets the placeholder as its background and in a data-lqip
+// attribute, and the returned map (image source to data URI) is exposed to
+// templates.
+func addImagePlaceholders(doc ast.Node, pageURL string, conf siteConfig) map[string]string {
+	placeholders := map[string]string{}
+	visitor := func(node ast.Node, entering bool) ast.WalkStatus {
+		if interrupted.Load() {
+			// the page is not written, see renderPages
+			return ast.Terminate
+		}
+		img, ok := node.(*ast.Image)
+		if !ok || !entering {
+			return ast.GoToNext
+		}
+		src := string(img.Destination)
+		fname := localImagePath(src, pageURL, conf)
+		if fname == "" {
+			return ast.GoToNext
+		}
+		placeholder, ok := placeholders[src]
+		if !ok {
+			err := checkImageSize(fname, conf)
+			if err == nil {
+				placeholder, err = makePlaceholder(fname)
+			}
+			if errors.Is(err, image.ErrFormat) {
+				// e.g. SVG or WebP
+				return ast.GoToNext
+			} else if err != nil {
+				fmt.Fprintf(os.Stderr, "warning: image placeholder: %v\n", err)
+				return ast.GoToNext
+			}
+			placeholders[src] = placeholder
+		}
+		if img.Attribute == nil {
+			img.Attribute = &ast.Attribute{}
+		}
+		if img.Attrs == nil {
+			img.Attrs = map[string][]byte{}
+		}
+		img.Attrs["data-lqip"] = []byte(placeholder)
+		img.Attrs["style"] = []byte(fmt.Sprintf("background-image:url(%s);background-size:cover", placeholder))
+		return ast.GoToNext
+	}
+	ast.WalkFunc(doc, visitor)
+	return placeholders
+}
@@ -7,12 +7,17 @@ import (
 	"flag"
 	"fmt"
 	"html/template"
+	"io"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/gomarkdown/markdown"
 	"github.com/gomarkdown/markdown/ast"
@@ -28,12 +33,291 @@ var (
 )
 
 type siteConfig struct {
-	SiteName         string `mapstructure:"SiteName"`
-	SourcePath       string `mapstructure:"SourcePath"`
-	DestinationPath  string `mapstructure:"DestinationPath"`
-	PageTemplateFile string `mapstructure:"PageTemplateFile"`
-	ResourcePath     string `mapstructure:"ResourcePath"`
-	PostPattern      string `mapstructure:"PostPattern"`
+	SiteName string `mapstructure:"SiteName"`
+	// BaseURL is the absolute URL of the site root, e.g.
+	// https://example.com/blog/, used for the absolute URLs of feeds,
+	// permalinks, canonical links, and link preview tags.  Without it, these
+	// URLs are relative.
+	BaseURL string `mapstructure:"BaseURL"`
+	// Authors maps the IDs used in the author field of posts to the details
+	// of the authors, shown on their listing pages under authors/.
+	Authors          map[string]authorConfig `mapstructure:"Authors"`
+	SourcePath       string                  `mapstructure:"SourcePath"`
+	DestinationPath  string                  `mapstructure:"DestinationPath"`
+	PageTemplateFile string                  `mapstructure:"PageTemplateFile"`
+	// LayoutTemplateFile is an optional base layout.  When set, page
+	// templates are parsed on top of it and override the blocks it defines
+	// (e.g. {{block "content" .}}).
+	LayoutTemplateFile string `mapstructure:"LayoutTemplateFile"`
+	// PostTemplateFile and ListTemplateFile are the templates for posts and
+	// for generated listing pages.  They default to PageTemplateFile.
+	PostTemplateFile string `mapstructure:"PostTemplateFile"`
+	ListTemplateFile string `mapstructure:"ListTemplateFile"`
+	// PartialsPath is a directory of partial templates that all page
+	// templates can include.  Each .html file in it is a template named
+	// after the file, e.g. {{template "header" .}} for header.html.
+	PartialsPath string `mapstructure:"PartialsPath"`
+	ResourcePath string `mapstructure:"ResourcePath"`
+	PostPattern  string `mapstructure:"PostPattern"`
+	// PostRules select the posts of site sections with different naming
+	// schemes.  Files outside the directories of the rules are matched by
+	// PostPattern.
+	PostRules []postRule `mapstructure:"PostRules"`
+	// NotePattern matches the source files of notes: short, untitled entries
+	// rendered into a combined stream page and feed.  Notes are never treated
+	// as posts.  An empty pattern disables notes.
+	NotePattern string `mapstructure:"NotePattern"`
+	// EventPattern matches the source files of events, which are listed on
+	// the events page and exported to an iCalendar file.  An empty pattern
+	// disables events.
+	EventPattern string `mapstructure:"EventPattern"`
+	// ProjectPattern matches the source files of projects, which are shown as
+	// cards on the projects page.  An empty pattern disables projects.
+	ProjectPattern string `mapstructure:"ProjectPattern"`
+	// AutoIndexDirs lists directories, relative to ResourcePath, for which a
+	// directory listing page is generated.
+	AutoIndexDirs []string `mapstructure:"AutoIndexDirs"`
+	// DocsPath is a directory under SourcePath rendered as documentation,
+	// with a navigation sidebar and previous/next links.  Empty disables
+	// documentation mode.
+	DocsPath string `mapstructure:"DocsPath"`
+	// ThemePath is the directory of a theme.  The files in its assets
+	// directory are minified, fingerprinted, and written next to the site's
+	// resources.
+	ThemePath string `mapstructure:"ThemePath"`
+	// BundlePath is the directory of the stylesheets and scripts that pages
+	// request in their front matter.  Only the requested files are
+	// minified, fingerprinted, and written to the destination.
+	BundlePath string `mapstructure:"BundlePath"`
+	// ContactForm configures the generated contact page.
+	ContactForm contactFormConfig `mapstructure:"ContactForm"`
+	// Changelog configures the generated release notes page and feed.
+	Changelog changelogConfig `mapstructure:"Changelog"`
+	// Drafts includes the pages marked as drafts in their front matter or
+	// metadata file, which are skipped by default.  It is set by the -drafts
+	// flag.
+	Drafts bool `mapstructure:"Drafts"`
+	// DebugTemplates marks the output of each template in the rendered pages
+	// with HTML comments and saves the template data of each page as JSON
+	// under <DestinationPath>.debug.  It is set by the -debug-templates flag.
+	DebugTemplates bool `mapstructure:"DebugTemplates"`
+	// Incremental skips rendering the pages whose sources, metadata,
+	// templates, and links did not change since the previous build.  The
+	// build cache is kept in Storage, or in .statiko if it is not set.
+	Incremental bool `mapstructure:"Incremental"`
+	// PreloadHints adds preload links for the critical assets of each page
+	// (the first stylesheet, its web fonts, and the first image) to the head
+	// of the page.
+	PreloadHints bool `mapstructure:"PreloadHints"`
+	// RelatedPosts is the number of posts sharing the most tags with each
+	// post that are listed in its .Related template data.  Zero disables
+	// related posts.
+	RelatedPosts int `mapstructure:"RelatedPosts"`
+	// PostsAscending lists posts oldest first on the posts page and the
+	// taxonomy pages.  Posts are listed newest first by default.
+	PostsAscending bool `mapstructure:"PostsAscending"`
+	// Archives generates archive pages of the posts of each year and month
+	// under archive/, and a landing page listing them.
+	Archives bool `mapstructure:"Archives"`
+	// Pagination splits the listings of tags, categories, authors, and
+	// archives into pages.
+	Pagination paginationConfig `mapstructure:"Pagination"`
+	// SitemapOutput is the path, relative to DestinationPath, of the
+	// sitemap of the pages of the site, which requires BaseURL.  Empty
+	// disables the sitemap.
+	SitemapOutput string `mapstructure:"SitemapOutput"`
+	// PrettyURLs writes each page to index.html in a directory named after
+	// it, e.g. about/index.html for about.md, so its URL has no .html
+	// extension.
+	PrettyURLs bool `mapstructure:"PrettyURLs"`
+	// SanitizeHTML strips scripts and other dangerous markup from rendered
+	// pages, for sites that publish markdown from untrusted authors.
+	SanitizeHTML bool `mapstructure:"SanitizeHTML"`
+	// ImagePlaceholders generates tiny placeholder images for progressive
+	// loading of the local images in pages.
+	ImagePlaceholders bool `mapstructure:"ImagePlaceholders"`
+	// GlossaryOutput is the path, relative to DestinationPath, of the JSON
+	// file listing the terms defined on glossary pages.
+	GlossaryOutput string `mapstructure:"GlossaryOutput"`
+	// GlossaryFile is a JSON file of glossary terms, in the format of the
+	// generated glossary, whose first occurrence on each page is linked to
+	// its definition.  Empty disables linking.
+	GlossaryFile string `mapstructure:"GlossaryFile"`
+	// MemoryLimit is the soft limit, in megabytes, of the memory statiko
+	// uses.  Near the limit, memory is reclaimed more often, and images too
+	// large to decode within a quarter of it get no placeholder.  Zero
+	// disables the limit.
+	MemoryLimit int `mapstructure:"MemoryLimit"`
+	// Markdown configures the markdown dialect of pages.
+	Markdown markdownConfig `mapstructure:"Markdown"`
+	// Math configures $inline$ and $$ display math on pages.
+	Math mathConfig `mapstructure:"Math"`
+	// Abbreviations are wrapped in abbr elements with their expansions on
+	// pages.
+	Abbreviations abbrConfig `mapstructure:"Abbreviations"`
+	// Bibliography is a BibTeX file, or a CSL-JSON file with the .json
+	// extension, of the works cited on pages with [@key].  Empty disables
+	// citations.
+	Bibliography string `mapstructure:"Bibliography"`
+	// ReactionsFile is a JSON file mapping the URLs of pages to their
+	// comment and reaction counts, which are shown on post listings and in
+	// post footers.  Empty disables reactions.
+	ReactionsFile string `mapstructure:"ReactionsFile"`
+	// WebmentionsFile is a webmention.io JSON dump whose likes, reposts,
+	// and replies are rendered under the posts they target.  Empty disables
+	// webmentions.
+	WebmentionsFile string `mapstructure:"WebmentionsFile"`
+	// VariantsOutput is the path, relative to DestinationPath, of the JSON
+	// file mapping the URL of each page with content variants to the URLs of
+	// its variants.
+	VariantsOutput string `mapstructure:"VariantsOutput"`
+	// GraphOutput is the path, relative to DestinationPath, of a JSON file
+	// with the pages and the links between them, for rendering a note graph.
+	// Empty disables the graph.
+	GraphOutput string `mapstructure:"GraphOutput"`
+	// FragmentPath is a directory to also write the rendered body of each
+	// page to, without the template, in a tree parallel to DestinationPath.
+	// Empty disables fragments.
+	FragmentPath string `mapstructure:"FragmentPath"`
+	// TOCFiles also writes the headings of each page, with their anchors, to
+	// a .toc.json file next to the page, for scroll-spy scripts.
+	TOCFiles bool `mapstructure:"TOCFiles"`
+	// Footnotes configures footnote parsing and rendering.
+	Footnotes footnotesConfig `mapstructure:"Footnotes"`
+	// HeadingAnchors configures permalink anchors next to headings.
+	HeadingAnchors headingAnchorsConfig `mapstructure:"HeadingAnchors"`
+	// Wikilinks resolves [[Page Title]] links to pages.  Sites that use
+	// double brackets for something else can turn them off.
+	Wikilinks bool `mapstructure:"Wikilinks"`
+	// ShortcodePath is the directory of shortcode templates: name.html
+	// expands {{< name args >}} in pages.
+	ShortcodePath string `mapstructure:"ShortcodePath"`
+	// Sandbox restricts templates, for themes from third parties.
+	Sandbox sandboxConfig `mapstructure:"Sandbox"`
+	// Share configures the previews shared with serve -share.
+	Share shareConfig `mapstructure:"Share"`
+	// Audiences are partial sites built after the full site, each with the
+	// pages meant for one audience, such as a public site built from the
+	// sources of an intranet.
+	Audiences []audienceConfig `mapstructure:"Audiences"`
+	// Transforms is the pipeline of built-in AST transforms applied to each
+	// page between parsing and rendering.
+	Transforms []transformConfig `mapstructure:"Transforms"`
+	// OutputTemplates maps output formats requested by pages (gemtext,
+	// text, json) to text templates executed with the rendered content.
+	// Formats without a template are written as rendered.
+	OutputTemplates map[string]string `mapstructure:"OutputTemplates"`
+	// Workspace configures the directory of intermediate files.
+	Workspace workspaceConfig `mapstructure:"Workspace"`
+	// Storage selects where build state, such as the manifest of the output
+	// compared by -changed-exit-code, is kept between builds.
+	Storage storageConfig `mapstructure:"Storage"`
+	// Hosting is the platform the site is deployed to, which selects the
+	// format of the generated redirects: "netlify", "gitlab", or
+	// "cloudflare".
+	Hosting string `mapstructure:"Hosting"`
+	// Redirects are written to the redirects file of the hosting platform.
+	Redirects []redirect `mapstructure:"Redirects"`
+	// URLFreeze checks that the page URLs of previous builds are not
+	// removed without a redirect.
+	URLFreeze urlFreezeConfig `mapstructure:"URLFreeze"`
+	// Robots configures the generated robots.txt.
+	Robots robotsConfig `mapstructure:"Robots"`
+	// Humans configures the generated humans.txt and colophon page.
+	Humans humansConfig `mapstructure:"Humans"`
+	// CSSPruning removes unused rules from the stylesheets of the output.
+	CSSPruning cssPruningConfig `mapstructure:"CSSPruning"`
+	// Fonts are subsetted to the characters of the pages and served from
+	// the destination.
+	Fonts fontsConfig `mapstructure:"Fonts"`
+	// CacheManifest configures the generated cache-manifest.json.
+	CacheManifest cacheManifestConfig `mapstructure:"CacheManifest"`
+	// Dashboard configures the private publishing dashboard.
+	Dashboard dashboardConfig `mapstructure:"Dashboard"`
+	// StaleNotice configures the notice added to old posts.
+	StaleNotice staleNoticeConfig `mapstructure:"StaleNotice"`
+	// SnapshotPath is the directory of the snapshots of the site taken by
+	// the snapshot command, with an index page of them.  It must not be in
+	// the destination, or contain it.
+	SnapshotPath string `mapstructure:"SnapshotPath"`
+	// Freeze configures the manifests of the sources and output of each
+	// published build.
+	Freeze freezeConfig `mapstructure:"Freeze"`
+	// Test configures the comparison of the output with the expected output
+	// by the test command.
+	Test siteTestConfig `mapstructure:"Test"`
+
+	// assets is the manifest of processed theme assets, set during the build.
+	assets map[string]string
+	// audience is the audience of the partial site being built, empty for
+	// the full site.
+	audience string
+	// rendered collects the URLs, relative to the destination, of the pages
+	// rendered from the sources, set during the build.
+	rendered *[]string
+}
+
+// postTemplate returns the template file for posts.
+func (conf siteConfig) postTemplate() string {
+	if conf.PostTemplateFile != "" {
+		return conf.PostTemplateFile
+	}
+	return conf.PageTemplateFile
+}
+
+// listTemplate returns the template file for generated listing pages.
+func (conf siteConfig) listTemplate() string {
+	if conf.ListTemplateFile != "" {
+		return conf.ListTemplateFile
+	}
+	return conf.PageTemplateFile
+}
+
+// templateFiles returns all the configured template files.
+func (conf siteConfig) templateFiles() []string {
+	files := []string{conf.PageTemplateFile}
+	for _, fname := range []string{conf.LayoutTemplateFile, conf.PostTemplateFile, conf.ListTemplateFile} {
+		if fname != "" {
+			files = append(files, fname)
+		}
+	}
+	return append(files, conf.partialFiles()...)
+}
+
+// partialFiles returns the partial templates of the theme and of
+// PartialsPath.  The partials of PartialsPath override the theme partials of
+// the same name.
+func (conf siteConfig) partialFiles() []string {
+	var dirs []string
+	if conf.ThemePath != "" {
+		dirs = append(dirs, filepath.Join(conf.ThemePath, themePartialsDir))
+	}
+	if conf.PartialsPath != "" {
+		dirs = append(dirs, conf.PartialsPath)
+	}
+	var names []string
+	byName := map[string]string{}
+	for _, dir := range dirs {
+		files, _ := filepath.Glob(filepath.Join(dir, "*.html"))
+		for _, fname := range files {
+			name := partialName(fname)
+			if _, exists := byName[name]; !exists {
+				names = append(names, name)
+			}
+			byName[name] = fname
+		}
+	}
+	files := make([]string, len(names))
+	for idx, name := range names {
+		files[idx] = byName[name]
+	}
+	return files
+}
+
+// partialName returns the template name of a partial: its file name without
+// the extension.
+func partialName(fname string) string {
+	return strings.TrimSuffix(filepath.Base(fname), filepath.Ext(fname))
 }
 
 type templateData struct {
@@ -42,6 +326,72 @@ type templateData struct {
 	// RelRoot is a relative path prefix that points to the root of the HTML destination directory.
 	// It can be used to make relative links to pages and resources.
 	RelRoot string
+	// Sidebar is the navigation tree of the documentation section, set only
+	// on documentation pages.
+	Sidebar template.HTML
+	// Placeholders maps the sources of the page's local images to data URIs
+	// of tiny placeholder versions, when ImagePlaceholders is enabled.
+	Placeholders map[string]string
+	// Page holds the front matter of the page.
+	Page frontMatter
+	// BaseURL is the absolute URL of the site root, if configured.
+	BaseURL string
+	// Permalink is the URL of the page: absolute with BaseURL, and relative
+	// to the site root without it.
+	Permalink string
+	// Variant is the name of the content variant of the page and Canonical
+	// the URL, relative to the page or absolute with BaseURL, of the page it
+	// is a variant of.  Both are empty on pages that are not variants.  The
+	// pages of paginated listings are their own canonical pages.
+	Variant   string
+	Canonical string
+	// Meta describes the page for link previews and MetaTags holds the
+	// OpenGraph and Twitter card meta tags for it, for the head of the page.
+	Meta     pageMeta
+	MetaTags template.HTML
+	// Backlinks lists the pages linking to the page.
+	Backlinks []pageLink
+	// Author holds the details of the author of the page, from the author
+	// field of its front matter and the Authors of the config.
+	Author authorInfo
+	// Series holds the position of a post in its series and the parts of
+	// the series.
+	Series seriesNav
+	// Related lists the posts sharing the most tags with the post, for a
+	// "you might also like" section.
+	Related []pageLink
+	// PrevPost and NextPost link to the older and newer posts of the same
+	// section, for sequential navigation.  They are nil on the oldest and
+	// newest posts and on other pages.
+	PrevPost *pageLink
+	NextPost *pageLink
+	// Pagination describes the page of a paginated listing.
+	Pagination pagination
+	// Headings lists the headings of the page with their anchors, for
+	// tables of contents and scroll-spy navigation.
+	Headings []tocHeading
+	// Reactions holds the comment and reaction counts of the page from the
+	// reactions file.
+	Reactions reactionCounts
+	// Webmentions holds the likes, reposts, and replies of the page from the
+	// webmentions file.
+	Webmentions pageMentions
+	// Assets maps theme asset paths (e.g. "css/style.css") to the URLs of
+	// their processed files relative to the site root.
+	Assets map[string]string
+	// Styles and Scripts are the URLs, relative to the site root, of the
+	// stylesheets and scripts of BundlePath requested by the page.
+	Styles  []string
+	Scripts []string
+}
+
+// newTemplateData returns the template data shared by all pages of the site.
+func newTemplateData(conf siteConfig) templateData {
+	return templateData{
+		SiteName: template.HTML(conf.SiteName),
+		BaseURL:  conf.BaseURL,
+		Assets:   conf.assets,
+	}
 }
 
 func die(format string, a ...any) {
@@ -49,12 +399,23 @@ func die(format string, a ...any) {
 	os.Exit(1)
 }
 
+// copyFile copies a file in chunks, so that large media files are not read
+// into memory whole.
 func copyFile(srcName, dstName string) error {
-	data, err := os.ReadFile(srcName)
+	src, err := os.Open(srcName)
 	if err != nil {
 		return fmt.Errorf("reading file %q for copy: %w", srcName, err)
 	}
-	if err := os.WriteFile(dstName, data, 0666); err != nil {
+	defer src.Close()
+	dst, err := os.Create(dstName)
+	if err != nil {
+		return fmt.Errorf("writing file %q for copy: %w", dstName, err)
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return fmt.Errorf("copying file %q to %q: %w", srcName, dstName, err)
+	}
+	if err := dst.Close(); err != nil {
 		return fmt.Errorf("writing file %q for copy: %w", dstName, err)
 	}
 	return nil
@@ -68,39 +429,328 @@ func readTemplate(templateFile string) (string, error) {
 	return string(thtml), nil
 }
 
-func makeHTML(data templateData, templateFile string) ([]byte, error) {
+// templateError describes a failure to parse or execute a page template.  It
+// records the template file and, when known, the line within the template and
+// the source file of the page being rendered.
+type templateError struct {
+	Source   string
+	Template string
+	Line     int
+	Err      error
+}
+
+// templateErrorRe matches the location prefix of errors returned by the
+// template package, e.g. "template: name:12:5: ".
+var templateErrorRe = regexp.MustCompile(`^template: (.*?):([0-9]+):(?:[0-9]+:)? ?`)
+
+// newTemplateError wraps an error from the template package.  The template
+// file and line are taken from the error message when present, since an
+// error may originate in any of the files making up a template set.
+func newTemplateError(templateFile string, err error) *templateError {
+	terr := &templateError{Template: templateFile, Err: err}
+	if m := templateErrorRe.FindStringSubmatch(err.Error()); m != nil {
+		terr.Template = m[1]
+		terr.Line, _ = strconv.Atoi(m[2])
+	}
+	return terr
+}
+
+func (e *templateError) Error() string {
+	loc := e.Template
+	if e.Line > 0 {
+		loc = fmt.Sprintf("%s:%d", loc, e.Line)
+	}
+	msg := templateErrorRe.ReplaceAllString(e.Err.Error(), "")
+	if e.Source != "" {
+		return fmt.Sprintf("%s: template %s: %s", e.Source, loc, msg)
+	}
+	return fmt.Sprintf("template %s: %s", loc, msg)
+}
+
+func (e *templateError) Unwrap() error {
+	return e.Err
+}
+
+// withSource annotates a template error with the source file of the page that
+// was being rendered.  Other errors are returned unchanged.  It must be called
+// before the error is wrapped, since wrapping formats the message.
+func withSource(err error, source string) error {
+	var terr *templateError
+	if errors.As(err, &terr) {
+		terr.Source = source
+	}
+	return err
+}
+
+// parseTemplate parses a page template.  When layoutFile is set, the page
+// template is parsed on top of the layout, so that it can override the
+// blocks the layout defines, and the layout is the template that gets
+// executed.  The partials are added to the template set, named after their
+// files without the extension.
+func parseTemplate(layoutFile, templateFile string, partials []string) (*template.Template, error) {
 	thtml, err := readTemplate(templateFile)
 	if err != nil {
-		return nil, fmt.Errorf("making HTML: %w", err)
+		return nil, err
 	}
-	t, err := template.New("webpage").Parse(thtml)
+	if layoutFile == "" {
+		t, err := template.New(templateFile).Parse(thtml)
+		if err != nil {
+			return nil, newTemplateError(templateFile, err)
+		}
+		return addPartials(t, partials)
+	}
+
+	lhtml, err := readTemplate(layoutFile)
 	if err != nil {
-		return nil, fmt.Errorf("making HTML: %w", err)
+		return nil, err
+	}
+	t, err := template.New(layoutFile).Parse(lhtml)
+	if err != nil {
+		return nil, newTemplateError(layoutFile, err)
+	}
+	if _, err := t.New(templateFile).Parse(thtml); err != nil {
+		return nil, newTemplateError(templateFile, err)
+	}
+	return addPartials(t, partials)
+}
+
+// addPartials parses the partial templates into the template set of t.
+func addPartials(t *template.Template, partials []string) (*template.Template, error) {
+	for _, fname := range partials {
+		phtml, err := readTemplate(fname)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := t.New(partialName(fname)).Parse(phtml); err != nil {
+			return nil, newTemplateError(fname, err)
+		}
+	}
+	return t, nil
+}
+
+// makeHTML executes a page template, on top of the configured layout, with
+// the given data.
+func makeHTML(data templateData, templateFile string, conf siteConfig) ([]byte, error) {
+	t, err := parseTemplate(conf.LayoutTemplateFile, templateFile, conf.partialFiles())
+	if err != nil {
+		return nil, err
+	}
+	if conf.DebugTemplates {
+		if t, err = annotateTemplates(t); err != nil {
+			return nil, fmt.Errorf("annotating templates: %w", err)
+		}
 	}
 	rendered := new(bytes.Buffer)
-	if err := t.Execute(rendered, data); err != nil {
-		return nil, fmt.Errorf("making HTML: %w", err)
+	var out io.Writer = rendered
+	if conf.Sandbox.Enabled {
+		out = &limitedWriter{w: rendered, n: int64(conf.Sandbox.MaxOutput) << 10}
+	}
+	if err := t.Execute(out, data); err != nil {
+		return nil, newTemplateError(t.Name(), err)
+	}
+	if conf.Sandbox.Enabled {
+		if err := conf.Sandbox.checkOutput(t.Name(), rendered.Bytes(), data); err != nil {
+			return nil, err
+		}
 	}
 	return rendered.Bytes(), nil
 }
 
 func loadConfig() (siteConfig, error) {
 	viper := viper.GetViper()
-	viper.SetConfigName("config")
-	viper.AddConfigPath(".")
+	if configFile != "" {
+		viper.SetConfigFile(configFile)
+	} else {
+		viper.SetConfigName("config")
+		for _, dir := range configSearchPaths() {
+			viper.AddConfigPath(dir)
+		}
+	}
 	viper.SetDefault("SiteName", "")
+	viper.SetDefault("BaseURL", "")
+	viper.SetDefault("Authors", map[string]authorConfig{})
 	viper.SetDefault("SourcePath", "pages-md")
 	viper.SetDefault("DestinationPath", "html")
 	viper.SetDefault("PageTemplateFile", "templates/template.html")
+	viper.SetDefault("LayoutTemplateFile", "")
+	viper.SetDefault("PartialsPath", "templates/partials")
+	viper.SetDefault("PostTemplateFile", "")
+	viper.SetDefault("ListTemplateFile", "")
 	viper.SetDefault("ResourcePath", "res")
 	viper.SetDefault("PostPattern", `[0-9]{8}-.*`)
+	viper.SetDefault("PostRules", []postRule{})
+	viper.SetDefault("NotePattern", "")
+	viper.SetDefault("EventPattern", "")
+	viper.SetDefault("ProjectPattern", "")
+	viper.SetDefault("DocsPath", "")
+	viper.SetDefault("ThemePath", "")
+	viper.SetDefault("BundlePath", "bundles")
+	viper.SetDefault("AutoIndexDirs", []string{})
+	viper.SetDefault("ContactForm.Endpoint", "")
+	viper.SetDefault("ContactForm.Email", "")
+	viper.SetDefault("ContactForm.Output", "contact.html")
+	viper.SetDefault("ContactForm.Intro", "")
+	viper.SetDefault("ContactForm.Honeypot", "_gotcha")
+	viper.SetDefault("Changelog.File", "")
+	viper.SetDefault("Changelog.GitTags", false)
+	viper.SetDefault("Changelog.GitDir", ".")
+	viper.SetDefault("Changelog.Output", "releases.html")
+	viper.SetDefault("Changelog.Title", "Release notes")
+	viper.SetDefault("Drafts", false)
+	viper.SetDefault("DebugTemplates", false)
+	viper.SetDefault("Incremental", false)
+	viper.SetDefault("PreloadHints", false)
+	viper.SetDefault("PrettyURLs", false)
+	viper.SetDefault("Pagination.PageSize", 0)
+	viper.SetDefault("Pagination.Sitemap", sitemapFirstPage)
+	viper.SetDefault("SitemapOutput", "")
+	viper.SetDefault("Bibliography", "")
+	viper.SetDefault("RelatedPosts", 0)
+	viper.SetDefault("PostsAscending", false)
+	viper.SetDefault("Archives", false)
+	viper.SetDefault("SanitizeHTML", false)
+	viper.SetDefault("ImagePlaceholders", false)
+	viper.SetDefault("GlossaryOutput", "glossary.json")
+	viper.SetDefault("GlossaryFile", "")
+	viper.SetDefault("MemoryLimit", 0)
+	viper.SetDefault("Markdown.Extensions", []string{"common", "auto-heading-ids"})
+	viper.SetDefault("Markdown.Smartypants", false)
+	viper.SetDefault("Math.Enabled", false)
+	viper.SetDefault("Math.KaTeXURL", "https://cdn.jsdelivr.net/npm/katex@0.16.11/dist")
+	viper.SetDefault("Abbreviations.Terms", []abbreviation{})
+	viper.SetDefault("Abbreviations.All", false)
+	viper.SetDefault("ReactionsFile", "")
+	viper.SetDefault("WebmentionsFile", "")
+	viper.SetDefault("VariantsOutput", "variants.json")
+	viper.SetDefault("GraphOutput", "")
+	viper.SetDefault("FragmentPath", "")
+	viper.SetDefault("TOCFiles", false)
+	viper.SetDefault("Footnotes.Enabled", false)
+	viper.SetDefault("Footnotes.Style", footnoteStyleEndnotes)
+	viper.SetDefault("Footnotes.ReturnLinks", true)
+	viper.SetDefault("Footnotes.ReturnLabel", "↩")
+	viper.SetDefault("Footnotes.Heading", "")
+	viper.SetDefault("Footnotes.AnchorPrefix", "")
+	viper.SetDefault("HeadingAnchors.Enabled", false)
+	viper.SetDefault("HeadingAnchors.Symbol", "¶")
+	viper.SetDefault("HeadingAnchors.MinLevel", 1)
+	viper.SetDefault("HeadingAnchors.MaxLevel", 6)
+	viper.SetDefault("Wikilinks", true)
+	viper.SetDefault("ShortcodePath", "templates/shortcodes")
+	viper.SetDefault("Sandbox.Enabled", false)
+	viper.SetDefault("Sandbox.AllowedHosts", []string{})
+	viper.SetDefault("Sandbox.MaxOutput", 16384)
+	viper.SetDefault("Share.Token", "")
+	viper.SetDefault("Share.Tunnel", []string{})
+	viper.SetDefault("Audiences", []audienceConfig{})
+	viper.SetDefault("Transforms", []transformConfig{})
+	viper.SetDefault("OutputTemplates", map[string]string{})
+	viper.SetDefault("Storage.Backend", "")
+	viper.SetDefault("Storage.Location", "")
+	viper.SetDefault("Hosting", hostingNetlify)
+	viper.SetDefault("Redirects", []redirect{})
+	viper.SetDefault("Workspace.Path", "")
+	viper.SetDefault("Workspace.MaxSize", 0)
+	viper.SetDefault("URLFreeze.Mode", "")
+	viper.SetDefault("URLFreeze.Days", 0)
+	viper.SetDefault("Robots.Enabled", false)
+	viper.SetDefault("Robots.Disallow", []string{})
+	viper.SetDefault("Robots.Sitemap", "")
+	viper.SetDefault("SnapshotPath", "archives")
+	viper.SetDefault("Freeze.Path", "")
+	viper.SetDefault("Freeze.KeyFile", "")
+	viper.SetDefault("Humans.Enabled", false)
+	viper.SetDefault("Humans.Team", []human{})
+	viper.SetDefault("Humans.Thanks", []string{})
+	viper.SetDefault("Humans.Tools", []string{})
+	viper.SetDefault("Humans.ColophonOutput", "")
+	viper.SetDefault("Humans.ColophonIntro", "")
+	viper.SetDefault("CSSPruning.Enabled", false)
+	viper.SetDefault("CSSPruning.Safelist", []string{})
+	viper.SetDefault("Fonts.Files", []webFont{})
+	viper.SetDefault("Fonts.Path", "fonts")
+	viper.SetDefault("Fonts.Extra", "")
+	viper.SetDefault("CacheManifest.Enabled", false)
+	viper.SetDefault("CacheManifest.Immutable", "public, max-age=31536000, immutable")
+	viper.SetDefault("CacheManifest.Pages", "public, max-age=0, must-revalidate")
+	viper.SetDefault("CacheManifest.Default", "public, max-age=3600")
+	viper.SetDefault("Dashboard.Enabled", false)
+	viper.SetDefault("Dashboard.Output", "")
+	viper.SetDefault("Dashboard.StaleYears", 2)
+	viper.SetDefault("StaleNotice.Years", 0)
+	viper.SetDefault("StaleNotice.Text", "This post was last updated more than {years} years ago, so parts of it may be out of date.")
+	viper.SetDefault("Test.Expected", "expected")
+	viper.SetDefault("Test.Normalize", []normalizeRule{})
+	viper.SetDefault("Test.Ignore", []string{})
 	if err := viper.ReadInConfig(); err != nil {
 		return siteConfig{}, fmt.Errorf("loading config: %w", err)
 	}
+	if err := mergeConfigOverlay(); err != nil {
+		return siteConfig{}, fmt.Errorf("loading config: %w", err)
+	}
 	config := siteConfig{}
 	if err := viper.UnmarshalExact(&config); err != nil {
 		return siteConfig{}, fmt.Errorf("loading config: %w", err)
 	}
+	if err := config.Footnotes.validate(); err != nil {
+		return siteConfig{}, fmt.Errorf("loading config: %w", err)
+	}
+	if err := config.HeadingAnchors.validate(); err != nil {
+		return siteConfig{}, fmt.Errorf("loading config: %w", err)
+	}
+	if err := config.Sandbox.validate(); err != nil {
+		return siteConfig{}, fmt.Errorf("loading config: %w", err)
+	}
+	if err := validateAudiences(config.Audiences, config); err != nil {
+		return siteConfig{}, fmt.Errorf("loading config: %w", err)
+	}
+	if err := validateSnapshotPath(config); err != nil {
+		return siteConfig{}, fmt.Errorf("loading config: %w", err)
+	}
+	if err := config.Storage.validate(); err != nil {
+		return siteConfig{}, fmt.Errorf("loading config: %w", err)
+	}
+	if err := config.Workspace.validate(); err != nil {
+		return siteConfig{}, fmt.Errorf("loading config: %w", err)
+	}
+	if err := validateRedirects(config.Redirects, config.Hosting); err != nil {
+		return siteConfig{}, fmt.Errorf("loading config: %w", err)
+	}
+	if err := validateBaseURL(config.BaseURL); err != nil {
+		return siteConfig{}, fmt.Errorf("loading config: %w", err)
+	}
+	if err := config.Pagination.validate(); err != nil {
+		return siteConfig{}, fmt.Errorf("loading config: %w", err)
+	}
+	if config.SitemapOutput != "" && config.BaseURL == "" {
+		return siteConfig{}, fmt.Errorf("loading config: SitemapOutput requires BaseURL")
+	}
+	if err := config.Robots.validate(config.BaseURL); err != nil {
+		return siteConfig{}, fmt.Errorf("loading config: %w", err)
+	}
+	if err := config.URLFreeze.validate(config.Storage); err != nil {
+		return siteConfig{}, fmt.Errorf("loading config: %w", err)
+	}
+	if err := config.Freeze.validate(); err != nil {
+		return siteConfig{}, fmt.Errorf("loading config: %w", err)
+	}
+	if err := config.Markdown.validate(); err != nil {
+		return siteConfig{}, fmt.Errorf("loading config: %w", err)
+	}
+	if err := config.Abbreviations.validate(); err != nil {
+		return siteConfig{}, fmt.Errorf("loading config: %w", err)
+	}
+	if err := config.Humans.validate(); err != nil {
+		return siteConfig{}, fmt.Errorf("loading config: %w", err)
+	}
+	if err := config.Fonts.validate(); err != nil {
+		return siteConfig{}, fmt.Errorf("loading config: %w", err)
+	}
+	if config.MemoryLimit < 0 {
+		return siteConfig{}, fmt.Errorf("loading config: invalid MemoryLimit %d", config.MemoryLimit)
+	}
+	// the limit applies to every command
+	applyMemoryLimit(config)
 	return config, nil
 }
 
@@ -126,14 +776,132 @@ func createDirs(conf siteConfig) error {
 type postMetadata struct {
 	DatePosted  time.Time   `json:"posted"`
 	DatesEdited []time.Time `json:"edited"`
+	Tags        []string    `json:"tags"`
+	Category    string      `json:"category"`
+	Author      string      `json:"author"`
+}
+
+// pageKind is the content type of a source file.
+type pageKind int
+
+const (
+	kindPage pageKind = iota
+	kindPost
+	kindNote
+	kindEvent
+	kindProject
+)
+
+// postRule selects the posts of a section of the site by their own naming
+// scheme.  Files under Dir, relative to SourcePath, are posts if their path
+// relative to Dir matches Pattern.
+type postRule struct {
+	Dir     string `mapstructure:"Dir"`
+	Pattern string `mapstructure:"Pattern"`
+	// Section names the section of the posts.  It defaults to Dir.
+	Section string `mapstructure:"Section"`
+}
+
+type compiledPostRule struct {
+	dir     string
+	pattern *regexp.Regexp
+	section string
+}
+
+// contentPatterns holds the compiled patterns that select the content type of
+// each source file.  Optional patterns are nil when disabled.
+type contentPatterns struct {
+	post      *regexp.Regexp
+	postRules []compiledPostRule
+	note      *regexp.Regexp
+	event     *regexp.Regexp
+	project   *regexp.Regexp
+}
+
+func compileContentPatterns(conf siteConfig) (contentPatterns, error) {
+	var patterns contentPatterns
+	var err error
+	if patterns.post, err = regexp.Compile(conf.PostPattern); err != nil {
+		return patterns, fmt.Errorf("compiling PostPattern: %w", err)
+	}
+	for idx, rule := range conf.PostRules {
+		if rule.Dir == "" {
+			return patterns, fmt.Errorf("PostRules[%d]: missing Dir", idx)
+		}
+		compiled := compiledPostRule{dir: filepath.Join(conf.SourcePath, rule.Dir), section: rule.Section}
+		if compiled.section == "" {
+			compiled.section = filepath.ToSlash(filepath.Clean(rule.Dir))
+		}
+		if compiled.pattern, err = regexp.Compile(rule.Pattern); err != nil {
+			return patterns, fmt.Errorf("compiling PostRules[%d] pattern: %w", idx, err)
+		}
+		patterns.postRules = append(patterns.postRules, compiled)
+	}
+	if conf.NotePattern != "" {
+		if patterns.note, err = regexp.Compile(conf.NotePattern); err != nil {
+			return patterns, fmt.Errorf("compiling NotePattern: %w", err)
+		}
+	}
+	if conf.EventPattern != "" {
+		if patterns.event, err = regexp.Compile(conf.EventPattern); err != nil {
+			return patterns, fmt.Errorf("compiling EventPattern: %w", err)
+		}
+	}
+	if conf.ProjectPattern != "" {
+		if patterns.project, err = regexp.Compile(conf.ProjectPattern); err != nil {
+			return patterns, fmt.Errorf("compiling ProjectPattern: %w", err)
+		}
+	}
+	return patterns, nil
+}
+
+// kind returns the content type of the source file.  Notes, events, and
+// projects take precedence over posts, so their patterns can be more specific
+// than the post pattern.
+func (cp contentPatterns) kind(fname string) pageKind {
+	switch {
+	case cp.note != nil && cp.note.MatchString(fname):
+		return kindNote
+	case cp.event != nil && cp.event.MatchString(fname):
+		return kindEvent
+	case cp.project != nil && cp.project.MatchString(fname):
+		return kindProject
+	}
+	if isPost, _ := cp.matchPost(fname); isPost {
+		return kindPost
+	}
+	return kindPage
+}
+
+// matchPost reports whether a file is a post and the section it belongs to.
+// Files under the directory of a post rule are matched by the first such rule
+// only; other files are matched by the PostPattern and have no section.
+func (cp contentPatterns) matchPost(fname string) (bool, string) {
+	for _, rule := range cp.postRules {
+		rel, err := filepath.Rel(rule.dir, fname)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		return rule.pattern.MatchString(filepath.ToSlash(rel)), rule.section
+	}
+	return cp.post.MatchString(fname), ""
 }
 
 type post struct {
-	title   string
-	summary string
-	url     string
+	title    string
+	summary  string
+	url      string
+	front    frontMatter
+	tags     []string
+	category string
+	// author is the ID of the author of the post.
+	author string
+	// reactions holds the comment and reaction counts of the post.
+	reactions reactionCounts
 
 	metadata *postMetadata
+	// fileDate is the date of the date prefix of the source file name.
+	fileDate time.Time
 }
 
 // childLiterals concatenates the literals under a given node into a single
@@ -150,8 +918,13 @@ func childLiterals(node ast.Node) string {
 	return lit
 }
 
+// parsePost reads the title and summary of a page source.  A title in the
+// front matter takes precedence over the first level 1 heading.  Malformed
+// front matter is ignored here and reported when the page is rendered.
 func parsePost(mdsource []byte) post {
 	var p post
+	p.front, mdsource, _ = parseFrontMatter(mdsource)
+	p.title = p.front.Title
 	rootnode := parseMD(mdsource)
 	visitor := func(node ast.Node, _ bool) ast.WalkStatus {
 		switch nd := node.(type) {
@@ -170,38 +943,197 @@ func parsePost(mdsource []byte) post {
 	return p
 }
 
+// datePrefixRe matches the date at the start of file names like
+// 20240101-title.md and 2024-01-01-title.md.
+var datePrefixRe = regexp.MustCompile(`^[0-9]{4}-?[0-9]{2}-?[0-9]{2}[-_]?`)
+
+// dateFromFilename returns the date of the date prefix of a source file
+// name, or the zero time if it has none.
+func dateFromFilename(fname string) time.Time {
+	prefix := datePrefixRe.FindString(filepath.Base(fname))
+	digits := strings.NewReplacer("-", "", "_", "").Replace(prefix)
+	date, err := time.Parse("20060102", digits)
+	if err != nil {
+		return time.Time{}
+	}
+	return date
+}
+
+// titleFromFilename derives a title for pages without one from the name of
+// their source file: the date prefix is removed, dashes and underscores become
+// spaces, and each word is capitalised.
+func titleFromFilename(fname string) string {
+	name := strings.TrimSuffix(filepath.Base(fname), filepath.Ext(fname))
+	if trimmed := datePrefixRe.ReplaceAllString(name, ""); trimmed != "" {
+		name = trimmed
+	}
+	words := strings.FieldsFunc(name, func(r rune) bool { return r == '-' || r == '_' || unicode.IsSpace(r) })
+	for idx, word := range words {
+		first, size := utf8.DecodeRuneInString(word)
+		words[idx] = string(unicode.ToTitle(first)) + word[size:]
+	}
+	return strings.Join(words, " ")
+}
+
+// renderBody renders a parsed markdown document to HTML.  When SanitizeHTML
+// is enabled, the output is passed through the HTML sanitizer.
+func renderBody(doc ast.Node, renderer *html.Renderer, conf siteConfig) []byte {
+	body := markdown.Render(doc, renderer)
+	if conf.SanitizeHTML {
+		body = sanitizeHTML(body)
+	}
+	return body
+}
+
 func parseMD(md []byte) ast.Node {
+	return parseMDWithExtensions(md, parser.CommonExtensions|parser.AutoHeadingIDs)
+}
+
+func parseMDWithExtensions(md []byte, extensions parser.Extensions) ast.Node {
 	// each Parse call requires a new parser
-	mdparser := parser.NewWithExtensions(parser.CommonExtensions | parser.AutoHeadingIDs)
+	mdparser := parser.NewWithExtensions(extensions)
 	return mdparser.Parse(md)
 }
 
-func readPostMetadata(fname string) (*postMetadata, error) {
-	// metadata files are stored next to each post but with the .meta.json extension
+// parsePage parses the markdown source of a page with the extensions of the
+// config.  footnotes replaces the footnote config for the page.
+func parsePage(md []byte, footnotes footnotesConfig, conf siteConfig) ast.Node {
+	extensions := conf.Markdown.extensions()
+	if footnotes.Enabled {
+		extensions |= parser.Footnotes
+	}
+	if conf.Math.Enabled {
+		extensions |= parser.MathJax
+	}
+	doc := parseMDWithExtensions(md, extensions)
+	if footnotes.Enabled && footnotes.Style == footnoteStyleSidenotes {
+		convertToSidenotes(doc, footnotes.AnchorPrefix)
+	}
+	return doc
+}
+
+// newPageRenderer creates the HTML renderer for pages with the rendering
+// options from the config.
+func newPageRenderer(conf siteConfig) *html.Renderer {
+	htmlOpts := html.RendererOptions{Flags: conf.Markdown.rendererFlags()}
+	conf.Footnotes.applyRendererOptions(&htmlOpts)
+	hooks := []html.RenderNodeFunc{termAnchorHook}
+	if conf.Footnotes.Enabled {
+		hooks = append(hooks, conf.Footnotes.renderHook)
+	}
+	if conf.HeadingAnchors.Enabled {
+		hooks = append(hooks, conf.HeadingAnchors.renderHook)
+	}
+	htmlOpts.RenderNodeHook = chainRenderHooks(hooks...)
+	return html.NewRenderer(htmlOpts)
+}
+
+// metadataPath returns the path of the metadata file for a source file.
+// Metadata files are stored next to each page but with the .meta.json
+// extension.
+func metadataPath(fname string) string {
 	fnameNoExt := strings.TrimSuffix(fname, filepath.Ext(fname))
-	metadataPath := fnameNoExt + ".meta.json"
+	return fnameNoExt + ".meta.json"
+}
 
-	if _, err := os.Stat(metadataPath); errors.Is(err, os.ErrNotExist) {
-		return nil, nil
+// readMetadata decodes the metadata file of the given source file into v.  It
+// returns false if the source file has no metadata file.
+func readMetadata(fname string, v any) (bool, error) {
+	mdpath := metadataPath(fname)
+	if _, err := os.Stat(mdpath); errors.Is(err, os.ErrNotExist) {
+		return false, nil
 	}
-	fp, err := os.Open(metadataPath)
+	fp, err := os.Open(mdpath)
 	if err != nil {
-		return nil, fmt.Errorf("reading post metadata %q: %w", metadataPath, err)
+		return false, fmt.Errorf("reading metadata %q: %w", mdpath, err)
 	}
 	defer func() {
 		if err := fp.Close(); err != nil {
-			fmt.Fprintf(os.Stderr, "closing file after reading post metadata: %v", err)
+			fmt.Fprintf(os.Stderr, "closing file after reading metadata: %v", err)
 		}
 	}()
 
 	decoder := json.NewDecoder(fp)
+	if err := decoder.Decode(v); err != nil {
+		return false, fmt.Errorf("reading metadata %q: %w", mdpath, err)
+	}
+	return true, nil
+}
+
+func readPostMetadata(fname string) (*postMetadata, error) {
 	pm := &postMetadata{}
-	if err := decoder.Decode(pm); err != nil {
-		return nil, fmt.Errorf("reading post metadata %q: %w", metadataPath, err)
+	found, err := readMetadata(fname, pm)
+	if err != nil {
+		return nil, fmt.Errorf("reading post metadata: %w", err)
+	}
+	if !found {
+		return nil, nil
 	}
 	return pm, nil
 }
 
+// newPost reads a post from its source, after the front matter is applied,
+// and its metadata file.  Tags from the front matter and the metadata file
+// are merged; the category and author of the metadata file take precedence.
+func newPost(fname, pageURL string, pagemd []byte, front frontMatter) (post, error) {
+	p := parsePost(pagemd)
+	if p.title == "" {
+		p.title = titleFromFilename(fname)
+	}
+	p.url = pageURL
+	p.front = front
+	p.fileDate = dateFromFilename(fname)
+	metadata, err := readPostMetadata(fname)
+	if err != nil {
+		return p, err
+	}
+	if metadata == nil && !front.Date.IsZero() {
+		metadata = &postMetadata{DatePosted: front.Date.Time}
+	}
+	p.metadata = metadata
+	p.tags = front.Tags
+	p.category = front.Category
+	p.author = front.Author
+	if metadata != nil {
+		p.tags = mergeTags(p.tags, metadata.Tags)
+		if metadata.Category != "" {
+			p.category = metadata.Category
+		}
+		if metadata.Author != "" {
+			p.author = metadata.Author
+		}
+	}
+	return p, nil
+}
+
+// scanPosts reads the posts ahead of rendering, for the parts of pages that
+// depend on other posts, such as series navigation and related posts.
+func scanPosts(pagesmd []string, patterns contentPatterns, conf siteConfig) (postSet, error) {
+	var posts postSet
+	for _, fname := range pagesmd {
+		if patterns.kind(fname) != kindPost {
+			continue
+		}
+		pagemd, _, err := readSource(fname)
+		if err != nil {
+			return nil, err
+		}
+		front, _, err := pageFrontMatter(fname, pagemd, conf)
+		if err != nil {
+			return nil, fmt.Errorf("reading file %q: %w", fname, err)
+		}
+		if _, section := patterns.matchPost(fname); front.Section == "" {
+			front.Section = section
+		}
+		p, err := newPost(fname, siteURL(outputPath(fname, conf), conf), pagemd, front)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, p)
+	}
+	return posts, nil
+}
+
 func collectMarkdownFiles(srcpath string) ([]string, error) {
 	var pagesmd []string
 	mdfinder := func(path string, _ os.FileInfo, err error) error {
@@ -219,6 +1151,12 @@ func collectMarkdownFiles(srcpath string) ([]string, error) {
 	return pagesmd, nil
 }
 
+// isRemoteURL reports whether a link has a URL scheme, e.g. https: or mailto:.
+func isRemoteURL(link string) bool {
+	u, err := url.Parse(link)
+	return err == nil && u.Scheme != ""
+}
+
 func plural(n int) string {
 	if n != 1 {
 		return "s"
@@ -226,22 +1164,45 @@ func plural(n int) string {
 	return ""
 }
 
-func renderPostsPage(posts []post, data templateData, renderer *html.Renderer, templateFile, destpath string) error {
+// postListMarkdown lists posts with their dates, summaries, and tags.  Links
+// are relative to relroot, the path to the site root from the listing page.
+func postListMarkdown(posts postSet, relroot string, conf siteConfig) string {
+	// TODO: create listing page as ast instead of manually rendering blocks
+	var bodystr string
+	for idx, p := range posts {
+		dateStr := p.date().Format("02 Jan 2006")
+		bodystr = fmt.Sprintf("%s%d. [%s](%s) (%s)\n    - %s\n", bodystr, idx, p.title, conf.pageLink(relroot, p.url), dateStr, p.summary)
+		if p.author != "" {
+			author := conf.author(p.author)
+			bodystr = fmt.Sprintf("%s    - By: [%s](%s)\n", bodystr, escapeMD(author.Name), path.Join(relroot, author.Page))
+		}
+		if p.category != "" {
+			bodystr = fmt.Sprintf("%s    - Category: [%s](%s)\n", bodystr, escapeMD(p.category), path.Join(relroot, categoryTaxonomy.termURL(p.category)))
+		}
+		if len(p.tags) > 0 {
+			bodystr = fmt.Sprintf("%s    - Tags: %s\n", bodystr, tagLinks(p.tags, relroot))
+		}
+		if summary := p.reactions.Summary(); summary != "" {
+			bodystr = fmt.Sprintf("%s    - %s\n", bodystr, summary)
+		}
+	}
+	return bodystr
+}
+
+func renderPostsPage(posts postSet, data templateData, renderer *html.Renderer, conf siteConfig) error {
 	fmt.Printf(":: Found %d posts\n", len(posts))
+	templateFile := conf.listTemplate()
+	destpath := conf.DestinationPath
 
 	// render to listing page
 	if len(posts) > 0 {
-		// TODO: create listing page as ast instead of manually rendering blocks
-		var bodystr string
-		for idx, p := range posts {
-			dateStr := p.metadata.DatePosted.Format("02 Jan 2006")
-			bodystr = fmt.Sprintf("%s%d. [%s](%s) (%s)\n    - %s\n", bodystr, idx, p.title, p.url, dateStr, p.summary)
-		}
-		doc := parseMD([]byte(bodystr))
-		data.Body = template.HTML(markdown.Render(doc, renderer))
+		doc := parseMD([]byte(postListMarkdown(posts, ".", conf)))
+		data.Body = template.HTML(renderBody(doc, renderer, conf))
+		data.RelRoot = "."
+		data.Permalink = conf.absoluteURL("posts.html")
 		outpath := filepath.Join(destpath, "posts.html")
 		fmt.Printf("   Saving posts: %s\n", outpath)
-		htmlData, err := makeHTML(data, templateFile)
+		htmlData, err := makeHTML(data, templateFile, conf)
 		if err != nil {
 			return fmt.Errorf("making html for posts page: %w", err)
 		}
@@ -254,7 +1215,10 @@ func renderPostsPage(posts []post, data templateData, renderer *html.Renderer, t
 
 func addDate(doc ast.Node, p post) {
 	// add posted date to the end of the post
-	dateStr := p.metadata.DatePosted.Format(time.RFC1123)
+	if p.date().IsZero() {
+		return
+	}
+	dateStr := p.date().Format(time.RFC1123)
 	footer := fmt.Sprintf("Posted: %s", dateStr)
 	hr := ast.HorizontalRule{}
 	dateParagraph := ast.Paragraph{}
@@ -267,68 +1231,372 @@ func addDate(doc ast.Node, p post) {
 	ast.AppendChild(doc, &dateParagraph)
 }
 
+// outputPath returns the path of the HTML file rendered from a markdown
+// source file, named after the slug of its front matter or else the source
+// file.  With PrettyURLs, pages other than index pages are written to
+// index.html in a directory of their own.
+func outputPath(fname string, conf siteConfig) string {
+	// trim source path
+	outpath := strings.TrimPrefix(fname, conf.SourcePath)
+	// replace the name (and the extension with .html)
+	outpath = filepath.Join(filepath.Dir(outpath), slugOutputName(fname))
+	if conf.PrettyURLs && filepath.Base(outpath) != "index" {
+		outpath = filepath.Join(outpath, "index")
+	}
+	outpath = fmt.Sprintf("%s.html", outpath)
+	return filepath.Join(conf.DestinationPath, outpath)
+}
+
+// pageLink returns a link to the page at pageURL, relative to relroot.  With
+// PrettyURLs, links to index pages end at their directory.
+func (c siteConfig) pageLink(relroot, pageURL string) string {
+	link := path.Join(relroot, pageURL)
+	if !c.PrettyURLs || path.Base(link) != "index.html" {
+		return link
+	}
+	if link = strings.TrimSuffix(link, "index.html"); link == "" {
+		return "./"
+	}
+	return link
+}
+
+// siteURL returns the URL of an output file relative to the root of the site.
+func siteURL(outpath string, conf siteConfig) string {
+	url := strings.TrimPrefix(outpath, conf.DestinationPath)
+	url = strings.TrimPrefix(url, "/") // make it relative
+	return filepath.ToSlash(url)
+}
+
+// relRootOf returns the relative path from the directory of a page to the
+// root of the site, given the page's site URL.  It matches the RelRoot value
+// of the page's template data.
+func relRootOf(pageURL string) string {
+	depth := strings.Count(pageURL, "/")
+	if depth == 0 {
+		return "."
+	}
+	return strings.TrimSuffix(strings.Repeat("../", depth), "/")
+}
+
 func renderPages(conf siteConfig) error {
 	srcpath := conf.SourcePath
 
-	sitename := conf.SiteName
-	var data templateData
-
-	data.SiteName = template.HTML(sitename)
+	data := newTemplateData(conf)
 
 	pagesmd, err := collectMarkdownFiles(srcpath)
 	if err != nil {
 		return fmt.Errorf("rendering pages: %w", err)
 	}
+	pagesmd, drafts, err := excludeDrafts(pagesmd, conf)
+	if err != nil {
+		return fmt.Errorf("rendering pages: %w", err)
+	}
+	pagesmd, restricted, err := excludeAudiences(pagesmd, conf)
+	if err != nil {
+		return fmt.Errorf("rendering pages: %w", err)
+	}
+	if err := checkOutputPaths(pagesmd, conf); err != nil {
+		return fmt.Errorf("rendering pages: %w", err)
+	}
 	npages := len(pagesmd)
 	pagelist := make([]string, npages)
 
 	destpath := conf.DestinationPath
-	templateFile := conf.PageTemplateFile
-	postrePattern := conf.PostPattern
 	fmt.Printf(":: Rendering %d page%s\n", npages, plural(npages))
-	postre, err := regexp.Compile(postrePattern)
+	for _, fname := range drafts {
+		fmt.Printf("   Skipping draft %s\n", fname)
+	}
+	for _, fname := range restricted {
+		fmt.Printf("   Skipping %s, not for %s\n", fname, conf.audience)
+	}
+	patterns, err := compileContentPatterns(conf)
+	if err != nil {
+		return fmt.Errorf("rendering pages: %w", err)
+	}
+
+	transforms, err := buildTransforms(conf.Transforms)
+	if err != nil {
+		return fmt.Errorf("rendering pages: %w", err)
+	}
+	shortcodes, err := loadShortcodes(conf)
+	if err != nil {
+		return fmt.Errorf("rendering pages: %w", err)
+	}
+
+	renderer := newPageRenderer(conf)
+	bundles := newBundler(conf)
+
+	glossaryTerms, err := loadGlossary(conf)
+	if err != nil {
+		return fmt.Errorf("rendering pages: %w", err)
+	}
+	bib, err := loadBibliography(conf)
+	if err != nil {
+		return fmt.Errorf("rendering pages: %w", err)
+	}
+	reactions, err := loadReactions(conf)
+	if err != nil {
+		return fmt.Errorf("rendering pages: %w", err)
+	}
+	webmentions, err := loadWebmentions(conf)
 	if err != nil {
 		return fmt.Errorf("rendering pages: %w", err)
 	}
 
-	htmlOpts := html.RendererOptions{}
-	renderer := html.NewRenderer(htmlOpts)
+	pages, err := newPageIndex(pagesmd, conf)
+	if err != nil {
+		return fmt.Errorf("rendering pages: %w", err)
+	}
+	graph, err := collectLinks(pagesmd, pages, conf)
+	if err != nil {
+		return fmt.Errorf("rendering pages: %w", err)
+	}
+	links := graph.backlinks()
 
-	posts := make([]post, 0, npages)
+	docs, err := collectDocs(pagesmd, conf)
+	if err != nil {
+		return fmt.Errorf("rendering pages: %w", err)
+	}
+	allPosts, err := scanPosts(pagesmd, patterns, conf)
+	if err != nil {
+		return fmt.Errorf("rendering pages: %w", err)
+	}
+	seriesNavs := collectSeriesNav(allPosts)
+	postsInTime := chronology(allPosts)
+
+	// with incremental builds, pages whose inputs did not change since the
+	// previous build are not rendered again
+	var store buildStore
+	var prevCache, cache *buildCache
+	if conf.Incremental {
+		store = cacheStore(conf)
+		prevCache = loadBuildCache(store, conf)
+		site, err := siteInputHash(conf, glossaryTerms, bib)
+		if err != nil {
+			return fmt.Errorf("rendering pages: hashing site inputs: %w", err)
+		}
+		if prevCache.Site != site {
+			prevCache.Pages = map[string]cachedPage{}
+		}
+		cache = &buildCache{Destination: prevCache.Destination, Site: site, Pages: map[string]cachedPage{}}
+	}
+	unchanged := 0
+
+	posts := make(postSet, 0, npages)
+	var notes []note
+	var events []event
+	var projects []project
+	var glossary []definition
+	var seriesParts []seriesPart
+	variantMap := map[string]map[string]string{}
+	// converted lists the sources that were not plain UTF-8
+	var converted []string
 
 	for idx, fname := range pagesmd {
+		if interrupted.Load() {
+			return saveInterrupted(pagesmd[idx:], prevCache, cache, store)
+		}
 		fmt.Printf("   %d: %s", idx+1, fname)
 
-		// trim source path
-		outpath := strings.TrimPrefix(fname, srcpath)
-		// trim extension (and replace with .html)
-		outpath = strings.TrimSuffix(outpath, filepath.Ext(outpath))
-		outpath = fmt.Sprintf("%s.html", outpath)
-		outpath = filepath.Join(destpath, outpath)
-		pagemd, err := os.ReadFile(fname)
+		outpath := outputPath(fname, conf)
+		pageURL := siteURL(outpath, conf)
+		pagemd, encoding, err := readSource(fname)
 		if err != nil {
-			return fmt.Errorf("rendering pages: reading file %q: %w", fname, err)
+			return fmt.Errorf("rendering pages: %w", err)
+		}
+		if encoding != "" {
+			converted = append(converted, fmt.Sprintf("%s (%s)", fname, encoding))
+		}
+		pagemd, err = resolveLinks(pagemd, pageURL, pages)
+		if err != nil {
+			return fmt.Errorf("rendering pages: %w", err)
+		}
+		if pagemd, err = expandHotspots(pagemd, fname, pageURL, pages, conf); err != nil {
+			return fmt.Errorf("rendering pages: %w", err)
+		}
+		if pagemd, err = shortcodes.expand(pagemd, fname, pageURL, pages, conf); err != nil {
+			return fmt.Errorf("rendering pages: %w", err)
 		}
 
-		doc := parseMD(pagemd)
-		if postre.MatchString(fname) {
-			p := parsePost(pagemd)
-			postURL := strings.TrimPrefix(outpath, destpath)
-			postURL = strings.TrimPrefix(postURL, "/") // make it relative
-			p.url = postURL
-			metadata, err := readPostMetadata(fname)
+		front, body, err := pageFrontMatter(fname, pagemd, conf)
+		if err != nil {
+			return fmt.Errorf("rendering pages: reading file %q: %w", fname, err)
+		}
+		data.Page = front
+		if data.Styles, data.Scripts, err = bundles.pageAssets(front); err != nil {
+			return fmt.Errorf("rendering pages: %q: %w", fname, err)
+		}
+		footnotes, err := conf.Footnotes.forPage(front.Footnotes)
+		if err != nil {
+			return fmt.Errorf("rendering pages: %q: %w", fname, err)
+		}
+		variants, err := pageVariants(body)
+		if err != nil {
+			return fmt.Errorf("rendering pages: %q: %w", fname, err)
+		}
+		doc := parsePage(selectVariant(body, controlVariant(variants)), footnotes, conf)
+		rebasePrettyLinks(doc, pageURL, pages, conf)
+		info := parsePost(pagemd)
+		if front.Title != "" {
+			info.title = front.Title
+		}
+		if info.title == "" {
+			info.title = titleFromFilename(fname)
+		}
+		data.Meta = newPageMeta(info, front, doc, pageURL, conf)
+		data.Permalink = conf.absoluteURL(pageURL)
+		data.MetaTags = data.Meta.tags(conf.SiteName)
+		kind := patterns.kind(fname)
+		if _, section := patterns.matchPost(fname); kind == kindPost && front.Section == "" {
+			front.Section = section
+			data.Page.Section = section
+		}
+		data.Author = conf.author(front.Author)
+		data.Series = seriesNav{}
+		data.Related = nil
+		data.PrevPost, data.NextPost = nil, nil
+		// decorations are the additions to the document of the page that are
+		// repeated for each of its variants
+		var decorations []func(doc ast.Node)
+		// notice is the stale notice of an old post
+		var notice string
+		if bib != nil {
+			decorations = append(decorations, func(doc ast.Node) { addCitations(doc, bib, fname) })
+		}
+		switch kind {
+		case kindEvent:
+			ev, err := newEvent(fname, pageURL, pagemd)
+			if err != nil {
+				return fmt.Errorf("rendering pages: %w", err)
+			}
+			events = append(events, ev)
+			decorations = append(decorations, func(doc ast.Node) { addEventDetails(doc, ev) })
+		case kindProject:
+			proj, err := newProject(fname, pageURL, pages.sourceURL(pageURL), pagemd)
+			if err != nil {
+				return fmt.Errorf("rendering pages: %w", err)
+			}
+			projects = append(projects, proj)
+			decorations = append(decorations, func(doc ast.Node) { addRepoLink(doc, proj) })
+		case kindPost:
+			p, err := newPost(fname, pageURL, pagemd, front)
 			if err != nil {
 				return fmt.Errorf("rendering pages: %w", err)
 			}
-			p.metadata = metadata
+			p.reactions = reactions[pageURL]
+			data.Author = conf.author(p.author)
+			adjacent := postsInTime[pageURL]
+			data.PrevPost = postLink(adjacent.prev, pageURL, conf)
+			data.NextPost = postLink(adjacent.next, pageURL, conf)
+			if conf.RelatedPosts > 0 {
+				data.Related = relatedLinks(allPosts.RelatedTo(p).Limit(conf.RelatedPosts), pageURL, conf)
+			}
 			posts = append(posts, p)
+			if front.Series != "" {
+				// the combined page of the series gets an undecorated
+				// copy of the document
+				sdoc := parsePage(selectVariant(body, controlVariant(variants)), footnotes, conf)
+				rebasePrettyLinks(sdoc, pageURL, pages, conf)
+				applyTransforms(sdoc, transforms)
+				seriesParts = append(seriesParts, seriesPart{post: p, doc: sdoc})
+			}
 
-			addDate(doc, p)
+			if nav, ok := seriesNavs[pageURL]; ok {
+				data.Series = nav
+				decorations = append(decorations, func(doc ast.Node) { addSeriesNav(doc, nav, pageURL, conf) })
+			}
+			if notice = staleNotice(p, conf.StaleNotice, time.Now()); notice != "" {
+				decorations = append(decorations, func(doc ast.Node) { addStaleNotice(doc, notice) })
+			}
+			decorations = append(decorations, func(doc ast.Node) { addDate(doc, p) })
+			decorations = append(decorations, func(doc ast.Node) { addReactions(doc, p.reactions) })
+			if mentions := webmentions[pageURL]; !mentions.empty() {
+				rendered, err := renderWebmentions(mentions)
+				if err != nil {
+					return fmt.Errorf("rendering pages: %q: %w", fname, err)
+				}
+				decorations = append(decorations, func(doc ast.Node) { addWebmentions(doc, rendered) })
+			}
+		}
+		gm, err := readGlossaryMetadata(fname)
+		if err != nil {
+			return fmt.Errorf("rendering pages: %w", err)
+		}
+		if gm.Glossary {
+			glossary = append(glossary, collectDefinitions(doc, pageURL)...)
+		}
+		if gm.expandTerms() {
+			decorations = append(decorations, func(doc ast.Node) { expandGlossaryTerms(doc, glossaryTerms, pageURL) })
+		}
+		if len(conf.Abbreviations.Terms) > 0 {
+			decorations = append(decorations, func(doc ast.Node) { expandAbbreviations(doc, conf.Abbreviations) })
+		}
+		data.Sidebar = ""
+		if docs.contains(pageURL) {
+			decorations = append(decorations, func(doc ast.Node) { docs.addPrevNext(doc, pageURL, conf) })
+			data.Sidebar = docs.sidebar(pageURL, conf)
+		}
+		data.Backlinks = links.of(pageURL)
+		data.Reactions = reactions[pageURL]
+		data.Webmentions = webmentions[pageURL]
+		// notes are always rendered, since their bodies go into the stream
+		// page
+		var pageInput string
+		if cache != nil && kind != kindNote {
+			if pageInput, err = pageInputHash(fname, pagemd, kind, notice, data); err != nil {
+				return fmt.Errorf("rendering pages: hashing inputs of %q: %w", fname, err)
+			}
+			if prev := prevCache.Pages[fname]; prev.upToDate(pageInput) {
+				cache.Pages[fname] = prev
+				if len(variants) > 0 {
+					urls := map[string]string{}
+					for _, variant := range variants {
+						urls[variant] = siteURL(variantPath(outpath, variant), conf)
+					}
+					variantMap[pageURL] = urls
+				}
+				fmt.Printf(" (unchanged) -> %s\n", outpath)
+				pagelist[idx] = outpath
+				unchanged++
+				continue
+			}
+		}
+		// written lists the files written for the page
+		var written []string
+		decorate := func(doc ast.Node) {
+			for _, decoration := range decorations {
+				decoration(doc)
+			}
+			applyTransforms(doc, transforms)
+			data.Placeholders = nil
+			if conf.ImagePlaceholders {
+				data.Placeholders = addImagePlaceholders(doc, pageURL, conf)
+			}
+			addColorSchemeVariants(doc, pageURL, conf)
+		}
+		decorate(doc)
+		if interrupted.Load() {
+			// e.g. while generating image placeholders
+			return saveInterrupted(pagesmd[idx:], prevCache, cache, store)
 		}
 
 		// reverse render posts
 		// data.Body[nposts-idx-1] = template.HTML(string(safe))
-		data.Body = template.HTML(markdown.Render(doc, renderer))
+		// each document gets its own renderer, which keeps heading IDs
+		// unique within the document only
+		data.Body = template.HTML(renderBody(doc, newPageRenderer(conf), conf))
+		data.Headings = collectHeadings(doc)
+		if kind == kindNote {
+			// the notes stream gets a copy of the document with links
+			// relative to the stream
+			ndoc := cloneNode(doc)
+			rebaseNoteLinks(ndoc, pageURL)
+			n, err := newNote(fname, pageURL, doc, template.HTML(renderBody(ndoc, newPageRenderer(conf), conf)))
+			if err != nil {
+				return fmt.Errorf("rendering pages: %w", err)
+			}
+			notes = append(notes, n)
+		}
 
 		// make potential parent directory
 		outpathpar, _ := filepath.Split(outpath)
@@ -339,25 +1607,192 @@ func renderPages(conf siteConfig) error {
 		}
 		data.RelRoot, _ = filepath.Rel(outpathpar, destpath)
 
-		htmlData, err := makeHTML(data, templateFile)
-		if err != nil {
-			return fmt.Errorf("rending pages: %w", err)
+		templateFile := conf.PageTemplateFile
+		if kind == kindPost {
+			templateFile = conf.postTemplate()
+		}
+		if front.Template != "" {
+			templateFile = front.Template
+		}
+		math := conf.Math.Enabled && hasMath(doc)
+		writePage := func(outpath string) error {
+			htmlData, err := makeHTML(data, templateFile, conf)
+			if err != nil {
+				return withSource(err, fname)
+			}
+			if conf.PreloadHints {
+				htmlData = addPreloadHints(htmlData, siteURL(outpath, conf), conf)
+			}
+			if math {
+				htmlData = addMathAssets(htmlData, siteURL(outpath, conf), conf.Math)
+			}
+			if err := os.WriteFile(outpath, htmlData, 0666); err != nil {
+				return fmt.Errorf("writing html file %q: %w", outpath, err)
+			}
+			written = append(written, outpath)
+			if conf.DebugTemplates {
+				if err := writeTemplateData(outpath, data, conf); err != nil {
+					return err
+				}
+				written = append(written, templateDataPath(outpath, conf))
+			}
+			if conf.FragmentPath != "" {
+				if err := writeFragment(outpath, []byte(data.Body), conf); err != nil {
+					return err
+				}
+				written = append(written, fragmentPath(outpath, conf))
+			}
+			if conf.TOCFiles {
+				if err := writeTOC(outpath, data.Headings); err != nil {
+					return err
+				}
+				written = append(written, tocPath(outpath))
+			}
+			return nil
+		}
+		if err := writePage(outpath); err != nil {
+			return fmt.Errorf("rendering pages: %w", err)
+		}
+		if len(front.Outputs) > 0 {
+			fdata := formatData{Title: info.title, URL: pageURL, Page: front}
+			fpaths, err := writeFormats(outpath, doc, fdata, string(data.Body), conf)
+			if err != nil {
+				return fmt.Errorf("rendering pages: %s: %w", fname, err)
+			}
+			written = append(written, fpaths...)
+			fmt.Printf(" (+%s)", strings.Join(front.Outputs, ", "))
 		}
 
-		if err := os.WriteFile(outpath, htmlData, 0666); err != nil {
-			return fmt.Errorf("rendering pages: writing html file %q: %w", outpath, err)
+		if len(variants) > 0 {
+			// variants share the directory of the page, so links relative
+			// to the page work unchanged
+			data.Canonical = path.Base(pageURL)
+			if conf.BaseURL != "" {
+				data.Canonical = conf.absoluteURL(pageURL)
+			}
+			urls := map[string]string{}
+			for _, variant := range variants {
+				vdoc := parsePage(selectVariant(body, variant), footnotes, conf)
+				rebasePrettyLinks(vdoc, pageURL, pages, conf)
+				decorate(vdoc)
+				data.Body = template.HTML(renderBody(vdoc, newPageRenderer(conf), conf))
+				data.Headings = collectHeadings(vdoc)
+				data.Variant = variant
+				voutpath := variantPath(outpath, variant)
+				if err := writePage(voutpath); err != nil {
+					return fmt.Errorf("rendering pages: %w", err)
+				}
+				urls[variant] = siteURL(voutpath, conf)
+			}
+			variantMap[pageURL] = urls
+			data.Canonical, data.Variant = "", ""
+			fmt.Printf(" (+%d variant%s)", len(variants), plural(len(variants)))
+		}
+
+		if cache != nil && kind != kindNote {
+			outputs, err := hashOutputs(written)
+			if err != nil {
+				return fmt.Errorf("rendering pages: hashing outputs of %q: %w", fname, err)
+			}
+			cache.Pages[fname] = cachedPage{Input: pageInput, Outputs: outputs}
 		}
 
 		fmt.Printf(" -> %s\n", outpath)
 		pagelist[idx] = outpath
 	}
-	renderPostsPage(posts, data, renderer, templateFile, destpath)
+	if cache != nil {
+		fmt.Printf("   %d unchanged page%s\n", unchanged, plural(unchanged))
+		if err := cache.save(store); err != nil {
+			return fmt.Errorf("rendering pages: %w", err)
+		}
+	}
+	if len(converted) > 0 {
+		fmt.Fprintf(os.Stderr, "warning: converted %d source%s to UTF-8:\n", len(converted), plural(len(converted)))
+		for _, fname := range converted {
+			fmt.Fprintf(os.Stderr, "  %s\n", fname)
+		}
+	}
+	data.Sidebar = ""
+	data.Placeholders = nil
+	data.Backlinks = nil
+	data.Headings = nil
+	data.Author = authorInfo{}
+	data.Series = seriesNav{}
+	data.Related = nil
+	data.PrevPost, data.NextPost = nil, nil
+	data.Reactions = reactionCounts{}
+	data.Webmentions = pageMentions{}
+	data.Page = frontMatter{}
+	data.Meta, data.MetaTags = pageMeta{}, ""
+	data.Permalink = ""
+	data.Styles, data.Scripts = nil, nil
+	if docs != nil {
+		if err := docs.writeSearchIndex(conf); err != nil {
+			return fmt.Errorf("rendering pages: %w", err)
+		}
+	}
+	if err := writeGlossary(glossary, conf); err != nil {
+		return fmt.Errorf("rendering pages: %w", err)
+	}
+	if err := writeVariantMap(variantMap, conf); err != nil {
+		return fmt.Errorf("rendering pages: %w", err)
+	}
+	if conf.GraphOutput != "" {
+		if err := graph.writeGraph(conf); err != nil {
+			return fmt.Errorf("rendering pages: %w", err)
+		}
+	}
+	posts = posts.SortedByDate()
+	if conf.PostsAscending {
+		posts = posts.OldestFirst()
+	}
+	if err := renderPostsPage(posts, data, renderer, conf); err != nil {
+		return fmt.Errorf("rendering pages: %w", err)
+	}
+	if err := renderSeriesPages(seriesParts, data, conf); err != nil {
+		return fmt.Errorf("rendering pages: %w", err)
+	}
+	for _, tx := range []taxonomy{tagTaxonomy, categoryTaxonomy, authorTaxonomy(conf)} {
+		if err := renderTaxonomyPages(tx, posts, data, conf); err != nil {
+			return fmt.Errorf("rendering pages: %w", err)
+		}
+	}
+	if err := renderArchivePages(posts, data, conf); err != nil {
+		return fmt.Errorf("rendering pages: %w", err)
+	}
+	if err := renderNotesPage(notes, data, conf); err != nil {
+		return fmt.Errorf("rendering pages: %w", err)
+	}
+	if err := renderEventsPage(events, data, renderer, conf); err != nil {
+		return fmt.Errorf("rendering pages: %w", err)
+	}
+	if err := renderProjectsPage(projects, data, conf); err != nil {
+		return fmt.Errorf("rendering pages: %w", err)
+	}
+	if conf.GraphOutput != "" {
+		graph.printMostConnected()
+	}
+	if conf.rendered != nil {
+		for _, outpath := range pagelist {
+			if outpath != "" {
+				*conf.rendered = append(*conf.rendered, siteURL(outpath, conf))
+			}
+		}
+		for _, urls := range variantMap {
+			for _, url := range urls {
+				*conf.rendered = append(*conf.rendered, url)
+			}
+		}
+	}
 	fmt.Println(":: Rendering complete!")
 	return nil
 }
 
 // copyResources copies all files from the configured resource directory
-// to the "res" subdirectory under the destination path.
+// to the "res" subdirectory under the destination path.  Copies keep the
+// modification times of their files, and files whose copies have the same
+// size and modification time are not copied again, so that interrupted
+// builds resume where they stopped.
 func copyResources(conf siteConfig) error {
 	fmt.Println(":: Copying resources")
 	dstroot := conf.DestinationPath
@@ -365,12 +1800,22 @@ func copyResources(conf siteConfig) error {
 		if err != nil {
 			return err
 		}
+		if err := checkInterrupted(); err != nil {
+			return err
+		}
 		if info.Mode().IsRegular() {
 			dstloc := path.Join(dstroot, srcloc)
+			if copied, err := os.Stat(dstloc); err == nil && copied.Size() == info.Size() && copied.ModTime().Equal(info.ModTime()) {
+				fmt.Printf("   %s (unchanged) -> %s\n", srcloc, dstloc)
+				return nil
+			}
 			fmt.Printf("   %s -> %s\n", srcloc, dstloc)
 			if err := copyFile(srcloc, dstloc); err != nil {
 				return fmt.Errorf("copying resources: %w", err)
 			}
+			if err := os.Chtimes(dstloc, time.Time{}, info.ModTime()); err != nil {
+				return fmt.Errorf("copying resources: %w", err)
+			}
 		} else if info.Mode().IsDir() {
 			dstloc := path.Join(dstroot, srcloc)
 			fmt.Printf("   Creating directory %s\n", dstloc)
@@ -388,6 +1833,83 @@ func copyResources(conf siteConfig) error {
 	return nil
 }
 
+// buildContent renders the markdown sources and the generated pages.
+func buildContent(conf siteConfig) error {
+	if err := renderPages(conf); err != nil {
+		return err
+	}
+	if err := renderChangelog(conf); err != nil {
+		return err
+	}
+	if err := renderContactPage(conf); err != nil {
+		return err
+	}
+	if err := writeRedirects(conf); err != nil {
+		return err
+	}
+	if err := writeRobots(conf); err != nil {
+		return err
+	}
+	if err := writeHumans(conf); err != nil {
+		return err
+	}
+	if err := renderColophon(conf); err != nil {
+		return err
+	}
+	return renderDashboard(conf)
+}
+
+// buildResources copies the site resources and generates the directory
+// indexes for them.
+func buildResources(conf siteConfig) error {
+	if err := copyResources(conf); err != nil {
+		return err
+	}
+	return renderAutoIndexes(conf)
+}
+
+// buildSite performs a full build of the site.  The manifest of the
+// processed theme assets is recorded in conf for use by later partial
+// rebuilds.
+func buildSite(conf *siteConfig) error {
+	if err := createDirs(*conf); err != nil {
+		return err
+	}
+	if conf.Sandbox.Enabled {
+		if err := conf.Sandbox.checkTemplates(conf.templateFiles()); err != nil {
+			return err
+		}
+	}
+	assets, err := processThemeAssets(*conf)
+	if err != nil {
+		return err
+	}
+	conf.assets = assets
+	conf.rendered = new([]string)
+	if err := buildContent(*conf); err != nil {
+		return err
+	}
+	if err := checkInterrupted(); err != nil {
+		return err
+	}
+	if err := buildResources(*conf); err != nil {
+		return err
+	}
+	if err := checkInterrupted(); err != nil {
+		return err
+	}
+	if err := subsetFonts(*conf); err != nil {
+		return err
+	}
+	if err := pruneStylesheets(*conf); err != nil {
+		return err
+	}
+	if err := writeSitemap(*conf); err != nil {
+		return err
+	}
+	return writeCacheManifest(*conf)
+}
+
 func printversion() {
 	fmt.Println(verstr)
 }
@@ -402,24 +1924,40 @@ func init() {
 
 func main() {
 	var printver bool
+	var config string
+	var opts buildOptions
 	flag.BoolVar(&printver, "version", false, "print version number")
+	flag.StringVar(&configEnv, "env", os.Getenv("STATIKO_ENV"), "environment whose config overlay (e.g. config.production.yaml) is merged over the config (default: $STATIKO_ENV)")
+	flag.StringVar(&config, "config", "", "config file (default: config.yaml or another format in the working directory or the XDG config directories); paths in it are relative to its directory")
+	opts.register(flag.CommandLine)
+	flag.Usage = usage
 	flag.Parse()
 	if printver {
 		printversion()
 		return
 	}
-	conf, err := loadConfig()
-	if err != nil {
-		die("error: %v", err)
-	}
-	if err := createDirs(conf); err != nil {
-		die("error: %v", err)
+	if config != "" {
+		if err := useConfigFile(config); err != nil {
+			die("error: %v\n", err)
+		}
 	}
-
-	if err := renderPages(conf); err != nil {
-		die("error: %v", err)
+	// the config overrides before the command apply to all commands
+	opts.apply()
+	if flag.NArg() == 0 {
+		// building is the default for backward compatibility
+		if err := buildAndExit(opts); err != nil {
+			die("error: %v\n", err)
+		}
+		return
 	}
-	if err := copyResources(conf); err != nil {
-		die("error: %v", err)
+	for _, cmd := range commands(opts) {
+		if cmd.name == flag.Arg(0) {
+			if err := cmd.run(flag.Args()[1:]); err != nil {
+				die("error: %v\n", err)
+			}
+			return
+		}
 	}
+	flag.Usage()
+	die("error: unknown command %q\n", flag.Arg(0))
 }
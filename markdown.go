@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gomarkdown/markdown/html"
+	"github.com/gomarkdown/markdown/parser"
+)
+
+// markdownConfig configures the markdown dialect of pages.
+type markdownConfig struct {
+	// Extensions lists the parser extensions of pages by name.  "common" is
+	// the common set of gomarkdown: no-intra-emphasis, tables, fenced-code,
+	// autolink, strikethrough, space-headings, heading-ids,
+	// backslash-line-break, and definition-lists.  Footnotes and math are
+	// enabled with Footnotes.Enabled and Math.Enabled instead.
+	Extensions []string `mapstructure:"Extensions"`
+	// Smartypants renders straight quotes as curly quotes, -- and --- as
+	// dashes, and fractions like 1/2 as fraction characters.
+	Smartypants bool `mapstructure:"Smartypants"`
+}
+
+// markdownExtensions maps the names of the extensions of the config to the
+// parser extensions.
+var markdownExtensions = map[string]parser.Extensions{
+	"common":                     parser.CommonExtensions &^ parser.MathJax,
+	"no-intra-emphasis":          parser.NoIntraEmphasis,
+	"tables":                     parser.Tables,
+	"fenced-code":                parser.FencedCode,
+	"autolink":                   parser.Autolink,
+	"strikethrough":              parser.Strikethrough,
+	"lax-html-blocks":            parser.LaxHTMLBlocks,
+	"space-headings":             parser.SpaceHeadings,
+	"hard-line-break":            parser.HardLineBreak,
+	"non-blocking-space":         parser.NonBlockingSpace,
+	"tab-size-eight":             parser.TabSizeEight,
+	"no-empty-line-before-block": parser.NoEmptyLineBeforeBlock,
+	"heading-ids":                parser.HeadingIDs,
+	"titleblock":                 parser.Titleblock,
+	"auto-heading-ids":           parser.AutoHeadingIDs,
+	"backslash-line-break":       parser.BackslashLineBreak,
+	"definition-lists":           parser.DefinitionLists,
+	"ordered-list-start":         parser.OrderedListStart,
+	"attributes":                 parser.Attributes,
+	"super-subscript":            parser.SuperSubscript,
+	"empty-lines-break-list":     parser.EmptyLinesBreakList,
+}
+
+func (c markdownConfig) validate() error {
+	for _, name := range c.Extensions {
+		if _, ok := markdownExtensions[name]; !ok {
+			names := make([]string, 0, len(markdownExtensions))
+			for known := range markdownExtensions {
+				names = append(names, known)
+			}
+			sort.Strings(names)
+			return fmt.Errorf("unknown markdown extension %q (must be one of %s)", name, strings.Join(names, ", "))
+		}
+	}
+	return nil
+}
+
+// extensions returns the parser extensions of the config.
+func (c markdownConfig) extensions() parser.Extensions {
+	var extensions parser.Extensions
+	for _, name := range c.Extensions {
+		extensions |= markdownExtensions[name]
+	}
+	return extensions
+}
+
+// rendererFlags returns the HTML renderer flags of the config.
+func (c markdownConfig) rendererFlags() html.Flags {
+	if c.Smartypants {
+		return html.CommonFlags
+	}
+	return html.FlagsNone
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	gohtml "html"
+	"path"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// mathConfig configures math on pages.
+type mathConfig struct {
+	// Enabled parses $inline$ math and $$ blocks of display math on pages.
+	// Without it, dollar signs are plain text.
+	Enabled bool `mapstructure:"Enabled"`
+	// KaTeXURL is the URL of the dist directory of KaTeX, whose stylesheet
+	// and scripts are added to the pages with math to render it in the
+	// browser.  Relative URLs are relative to the site root.  Empty leaves
+	// rendering the math to the templates.
+	KaTeXURL string `mapstructure:"KaTeXURL"`
+}
+
+// hasMath reports whether a document contains inline or display math.
+func hasMath(doc ast.Node) bool {
+	found := false
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		switch node.(type) {
+		case *ast.Math, *ast.MathBlock:
+			found = true
+			return ast.Terminate
+		}
+		return ast.GoToNext
+	})
+	return found
+}
+
+// katexAssets returns the stylesheet and scripts of KaTeX for the head of a
+// page.  The auto-render extension renders the \(...\) and \[...\] spans of
+// the math of the page.
+func (c mathConfig) katexAssets(pageURL string) string {
+	base := strings.TrimSuffix(c.KaTeXURL, "/")
+	if !isRemoteURL(base) && !path.IsAbs(base) {
+		base = path.Join(relRootOf(pageURL), base)
+	}
+	base = gohtml.EscapeString(base)
+	return fmt.Sprintf(`<link rel="stylesheet" href="%[1]s/katex.min.css">`+
+		`<script defer src="%[1]s/katex.min.js"></script>`+
+		`<script defer src="%[1]s/contrib/auto-render.min.js" onload="renderMathInElement(document.body)"></script>`, base)
+}
+
+// addMathAssets adds the KaTeX assets to the head of a page.
+func addMathAssets(page []byte, pageURL string, conf mathConfig) []byte {
+	loc := headRe.FindIndex(page)
+	if loc == nil || conf.KaTeXURL == "" {
+		return page
+	}
+	assets := conf.katexAssets(pageURL)
+	withAssets := make([]byte, 0, len(page)+len(assets))
+	withAssets = append(withAssets, page[:loc[1]]...)
+	withAssets = append(withAssets, assets...)
+	return append(withAssets, page[loc[1]:]...)
+}
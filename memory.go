@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"runtime/debug"
+)
+
+// applyMemoryLimit sets the soft memory limit of the process to the
+// configured MemoryLimit.  Past the limit, the garbage collector runs more
+// often to stay under it.
+func applyMemoryLimit(conf siteConfig) {
+	if conf.MemoryLimit > 0 {
+		debug.SetMemoryLimit(int64(conf.MemoryLimit) << 20)
+	}
+}
+
+// hashFile returns the SHA-256 hash of the contents of a file, reading it in
+// chunks rather than whole.
+func hashFile(fname string) ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+	fp, err := os.Open(fname)
+	if err != nil {
+		return sum, err
+	}
+	defer fp.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, fp); err != nil {
+		return sum, fmt.Errorf("hashing %q: %w", fname, err)
+	}
+	copy(sum[:], hash.Sum(nil))
+	return sum, nil
+}
+
+// sameReaderContent reports whether two readers have the same contents,
+// comparing them in chunks.
+func sameReaderContent(a, b io.Reader) bool {
+	bufA, bufB := make([]byte, 64<<10), make([]byte, 64<<10)
+	for {
+		na, errA := io.ReadFull(a, bufA)
+		nb, errB := io.ReadFull(b, bufB)
+		if na != nb || !bytes.Equal(bufA[:na], bufB[:nb]) {
+			return false
+		}
+		if errA != nil || errB != nil {
+			// both ended, or one failed
+			return (errA == io.EOF || errA == io.ErrUnexpectedEOF) && errA == errB
+		}
+	}
+}
+
+// checkImageSize fails for images whose decoded pixels would take more than a
+// quarter of the MemoryLimit.  Only the header of the image is read.
+func checkImageSize(fname string, conf siteConfig) error {
+	if conf.MemoryLimit <= 0 {
+		return nil
+	}
+	fp, err := os.Open(fname)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+	cfg, _, err := image.DecodeConfig(fp)
+	if err != nil {
+		return fmt.Errorf("decoding image %q: %w", fname, err)
+	}
+	// decoded images take up to 8 bytes per pixel, for 16-bit colour
+	size := int64(cfg.Width) * int64(cfg.Height) * 8
+	if limit := int64(conf.MemoryLimit) << 20 / 4; size > limit {
+		return fmt.Errorf("image %q is %dx%d, too large to decode within the memory limit of %d MB", fname, cfg.Width, cfg.Height, conf.MemoryLimit)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// metricsPath is the URL path of the build metrics.
+const metricsPath = "/_statiko/metrics"
+
+// buildMetrics records the builds of a long running watch, for dashboards
+// and uptime checkers.  A nil *buildMetrics records nothing.
+type buildMetrics struct {
+	mu       sync.Mutex
+	started  time.Time
+	builds   int
+	failures int
+	total    time.Duration
+	last     time.Time
+	duration time.Duration
+	err      error
+}
+
+// record adds a build that started at start and ended now with err.
+func (bm *buildMetrics) record(start time.Time, err error) {
+	if bm == nil {
+		return
+	}
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	bm.last = time.Now()
+	bm.duration = bm.last.Sub(start)
+	bm.total += bm.duration
+	bm.builds++
+	bm.err = err
+	if err != nil {
+		bm.failures++
+	}
+}
+
+// metricsReport is the JSON document of the metrics endpoint.  Durations are
+// in seconds.
+type metricsReport struct {
+	Status          string    `json:"status"`
+	Uptime          float64   `json:"uptimeSeconds"`
+	Builds          int       `json:"builds"`
+	Failures        int       `json:"failures"`
+	LastBuild       time.Time `json:"lastBuild,omitzero"`
+	LastDuration    float64   `json:"lastBuildSeconds"`
+	AverageDuration float64   `json:"averageBuildSeconds"`
+	LastError       string    `json:"lastError,omitempty"`
+}
+
+func (bm *buildMetrics) report() metricsReport {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	report := metricsReport{
+		Status:       "ok",
+		Uptime:       time.Since(bm.started).Seconds(),
+		Builds:       bm.builds,
+		Failures:     bm.failures,
+		LastBuild:    bm.last,
+		LastDuration: bm.duration.Seconds(),
+	}
+	if bm.builds > 0 {
+		report.AverageDuration = bm.total.Seconds() / float64(bm.builds)
+	}
+	if bm.err != nil {
+		report.Status = "failed"
+		report.LastError = bm.err.Error()
+	}
+	return report
+}
+
+// ServeHTTP serves the metrics as JSON.  The status is 503 Service
+// Unavailable while the last build failed, so that uptime checkers that only
+// look at the status notice failed builds.
+func (bm *buildMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	report := bm.report()
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	if report.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(report)
+}
+
+// startMetrics returns the metrics of a watch whose initial build started at
+// start, served on addr.  With an empty addr, there are no metrics and it
+// returns nil.
+func startMetrics(addr string, start time.Time) (*buildMetrics, error) {
+	if addr == "" {
+		return nil, nil
+	}
+	bm := &buildMetrics{started: start}
+	bm.record(start, nil)
+	if err := serveMetrics(addr, bm); err != nil {
+		return nil, err
+	}
+	return bm, nil
+}
+
+// serveMetrics serves the metrics at metricsPath on addr in the background.
+func serveMetrics(addr string, bm *buildMetrics) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("serving metrics: %w", err)
+	}
+	fmt.Printf(":: Serving build metrics at http://%s%s\n", listener.Addr(), metricsPath)
+	mux := http.NewServeMux()
+	mux.Handle(metricsPath, bm)
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			fmt.Fprintf(os.Stderr, "error: serving metrics: %v\n", err)
+		}
+	}()
+	return nil
+}
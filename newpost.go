@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// newPostSource returns the source of a new post: a title heading, preceded
+// by YAML front matter with the posted date if frontMatterDate is set.
+func newPostSource(title string, posted time.Time, frontMatterDate bool) ([]byte, error) {
+	source := fmt.Sprintf("# %s\n\n", title)
+	if !frontMatterDate {
+		return []byte(source), nil
+	}
+	front, err := yaml.Marshal(struct {
+		Date time.Time `yaml:"date"`
+	}{posted})
+	if err != nil {
+		return nil, fmt.Errorf("encoding front matter: %w", err)
+	}
+	return []byte(yamlDelimiter + "\n" + string(front) + yamlDelimiter + "\n\n" + source), nil
+}
+
+// errPostExists is returned when the source or metadata file of a new post
+// already exists.
+var errPostExists = errors.New("already exists")
+
+// postPath returns the path of a new post with the given title under dir: the
+// posted date in the prefix layout followed by the slug of the title.
+func postPath(title, dir, prefix string, posted time.Time) (string, error) {
+	slug := slugify(title)
+	if slug == "" {
+		return "", fmt.Errorf("title %q has no letters or numbers for a file name", title)
+	}
+	return filepath.Join(dir, posted.Format(prefix)+slug+".md"), nil
+}
+
+// createPost writes a new post with the given title and body under dir and
+// returns its path.  The path, from postPath, must be matched as a post by
+// the configured patterns.  The posted date is saved in the metadata file, or
+// in the front matter if frontMatterDate is set.
+func createPost(title string, body []byte, dir, prefix string, posted time.Time, frontMatterDate bool, conf siteConfig) (string, error) {
+	fname, err := postPath(title, dir, prefix, posted)
+	if err != nil {
+		return "", err
+	}
+	patterns, err := compileContentPatterns(conf)
+	if err != nil {
+		return "", err
+	}
+	if patterns.kind(fname) != kindPost {
+		return "", fmt.Errorf("%q would not be a post: it does not match PostPattern or PostRules (set the date layout with -prefix)", fname)
+	}
+	for _, loc := range []string{fname, metadataPath(fname)} {
+		if _, err := os.Stat(loc); err == nil {
+			return "", fmt.Errorf("%q %w", loc, errPostExists)
+		}
+	}
+
+	source, err := newPostSource(title, posted, frontMatterDate)
+	if err != nil {
+		return "", err
+	}
+	source = append(source, body...)
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return "", fmt.Errorf("creating path %q: %w", dir, err)
+	}
+	if err := os.WriteFile(fname, source, 0666); err != nil {
+		return "", fmt.Errorf("writing post %q: %w", fname, err)
+	}
+	if frontMatterDate {
+		return fname, nil
+	}
+	meta, err := json.MarshalIndent(postMetadata{DatePosted: posted, DatesEdited: []time.Time{}, Tags: []string{}}, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("encoding metadata of %q: %w", fname, err)
+	}
+	if err := os.WriteFile(metadataPath(fname), meta, 0666); err != nil {
+		return "", fmt.Errorf("writing metadata %q: %w", metadataPath(fname), err)
+	}
+	return fname, nil
+}
+
+// runNew creates new content from the command line.  Posts are the only kind
+// of content it creates.
+func runNew(args []string) error {
+	if len(args) == 0 || args[0] != "post" {
+		return fmt.Errorf("new: usage: statiko new post [options] <title>")
+	}
+	flags := flag.NewFlagSet("new post", flag.ExitOnError)
+	dir := flags.String("dir", "", "directory, relative to the source path, to create the post in")
+	prefix := flags.String("prefix", "20060102-", "Go time layout of the date prefix of the file name")
+	frontMatterDate := flags.Bool("front-matter", false, "set the date in YAML front matter instead of the metadata file")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: statiko new post [options] <title>\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	title := strings.TrimSpace(strings.Join(flags.Args(), " "))
+	if title == "" {
+		flags.Usage()
+		return fmt.Errorf("new post: expected a title")
+	}
+
+	conf, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	posted := time.Now().Truncate(time.Second)
+	fname, err := createPost(title, nil, filepath.Join(conf.SourcePath, *dir), *prefix, posted, *frontMatterDate, conf)
+	if err != nil {
+		return fmt.Errorf("new post: %w", err)
+	}
+	fmt.Println(fname)
+	return nil
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// note is a short, untitled entry rendered into the notes stream and feed.
+type note struct {
+	url     string
+	summary string
+	body    template.HTML
+	date    time.Time
+	edited  time.Time
+}
+
+// noteTitleLength is the maximum length of the feed entry title derived from
+// the text of a note.
+const noteTitleLength = 60
+
+// newNote collects the information needed to show a rendered note in the
+// stream page and feed.  The date of the note is taken from its metadata
+// file, falling back to the modification time of the source file.
+func newNote(fname, url string, doc ast.Node, body template.HTML) (note, error) {
+	n := note{url: url, body: body}
+	metadata, err := readPostMetadata(fname)
+	if err != nil {
+		return n, err
+	}
+	if metadata != nil {
+		n.date = metadata.DatePosted
+		n.edited = metadata.DatePosted
+		for _, edited := range metadata.DatesEdited {
+			if edited.After(n.edited) {
+				n.edited = edited
+			}
+		}
+	} else {
+		info, err := os.Stat(fname)
+		if err != nil {
+			return n, err
+		}
+		n.date = info.ModTime()
+		n.edited = n.date
+	}
+
+	visitor := func(node ast.Node, _ bool) ast.WalkStatus {
+		if _, ok := node.(*ast.Paragraph); ok {
+			n.summary = childLiterals(node)
+			return ast.Terminate
+		}
+		return ast.GoToNext
+	}
+	ast.WalkFunc(doc, visitor)
+	return n, nil
+}
+
+// rebaseNoteLinks rewrites the relative links and images of the document of
+// the note at noteURL, which are relative to the note page, for the notes
+// stream and feed at the site root.
+func rebaseNoteLinks(doc ast.Node, noteURL string) {
+	rebase := func(dest []byte) []byte {
+		link := string(dest)
+		if link == "" || strings.HasPrefix(link, "#") || strings.HasPrefix(link, "/") || isRemoteURL(link) {
+			return dest
+		}
+		rebased := siteRelativeURL(noteURL, link)
+		if strings.HasSuffix(link, "/") {
+			rebased += "/"
+		}
+		return []byte(rebased)
+	}
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if !entering {
+			return ast.GoToNext
+		}
+		switch node := node.(type) {
+		case *ast.Link:
+			node.Destination = rebase(node.Destination)
+		case *ast.Image:
+			node.Destination = rebase(node.Destination)
+		}
+		return ast.GoToNext
+	})
+}
+
+// title returns a feed entry title for the note from the start of its text.
+func (n note) title() string {
+	text := strings.Join(strings.Fields(n.summary), " ")
+	if utf8.RuneCountInString(text) <= noteTitleLength {
+		if text == "" {
+			return n.date.Format("02 Jan 2006 15:04")
+		}
+		return text
+	}
+	runes := []rune(text)
+	return strings.TrimSpace(string(runes[:noteTitleLength])) + "…"
+}
+
+const noteStreamHTML = `{{range .}}<article class="note">
+{{.Body}}
+<p class="note-meta"><a href="{{.URL}}"><time datetime="{{.DateISO}}">{{.Date}}</time></a></p>
+</article>
+{{end}}`
+
+var noteStreamTemplate = template.Must(template.New("notes").Parse(noteStreamHTML))
+
+// sortNotes sorts notes newest first.
+func sortNotes(notes []note) {
+	sort.SliceStable(notes, func(i, j int) bool {
+		return notes[i].date.After(notes[j].date)
+	})
+}
+
+// renderNotesPage renders all notes, newest first, into a single stream page
+// and writes the notes feed next to it.
+func renderNotesPage(notes []note, data templateData, conf siteConfig) error {
+	if len(notes) == 0 {
+		return nil
+	}
+	fmt.Printf(":: Found %d note%s\n", len(notes), plural(len(notes)))
+	sortNotes(notes)
+
+	type streamEntry struct {
+		Body    template.HTML
+		URL     string
+		Date    string
+		DateISO string
+	}
+	entries := make([]streamEntry, len(notes))
+	for idx, n := range notes {
+		entries[idx] = streamEntry{
+			Body:    n.body,
+			URL:     conf.pageLink(".", n.url),
+			Date:    n.date.Format("02 Jan 2006 15:04"),
+			DateISO: atomTime(n.date),
+		}
+	}
+	stream := new(bytes.Buffer)
+	if err := noteStreamTemplate.Execute(stream, entries); err != nil {
+		return fmt.Errorf("rendering notes stream: %w", err)
+	}
+
+	destpath := conf.DestinationPath
+	data.Body = template.HTML(stream.String())
+	data.RelRoot = "."
+	data.Permalink = conf.absoluteURL("notes.html")
+	outpath := filepath.Join(destpath, "notes.html")
+	fmt.Printf("   Saving notes: %s\n", outpath)
+	htmlData, err := makeHTML(data, conf.listTemplate(), conf)
+	if err != nil {
+		return fmt.Errorf("making html for notes page: %w", err)
+	}
+	if err := os.WriteFile(outpath, htmlData, 0666); err != nil {
+		return fmt.Errorf("writing notes page %q: %w", outpath, err)
+	}
+
+	feed := atomFeed{
+		Title: fmt.Sprintf("%s: Notes", conf.SiteName),
+		ID:    conf.absoluteURL("notes.html"),
+		Links: []atomLink{
+			{Href: conf.absoluteURL("notes.html"), Rel: "alternate", Type: "text/html"},
+			{Href: conf.absoluteURL("notes.xml"), Rel: "self", Type: "application/atom+xml"},
+		},
+	}
+	for _, n := range notes {
+		feed.Entries = append(feed.Entries, atomEntry{
+			Title:     n.title(),
+			ID:        conf.absoluteURL(n.url),
+			Link:      atomLink{Href: conf.absoluteURL(n.url), Rel: "alternate", Type: "text/html"},
+			Published: atomTime(n.date),
+			Updated:   atomTime(n.edited),
+			Content:   &atomContent{Type: "html", Body: string(n.body)},
+		})
+	}
+	feedpath := filepath.Join(destpath, "notes.xml")
+	fmt.Printf("   Saving notes feed: %s\n", feedpath)
+	return writeAtomFeed(feed, feedpath)
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// obsidianLinkRe matches Obsidian wikilinks and embeds: [[target]],
+// [[target#heading|label]], and ![[target]].
+var obsidianLinkRe = regexp.MustCompile(`(!?)\[\[([^\[\]|#]*)(?:#([^\[\]|]*))?(?:\|([^\[\]]*))?\]\]`)
+
+// maxEmbedDepth limits the nesting of embedded notes.
+const maxEmbedDepth = 8
+
+// obsidianVault indexes the notes and attachments of a vault by the names
+// Obsidian links use.
+type obsidianVault struct {
+	root string
+	// notes maps lowercase note names and vault-relative paths, without the
+	// extension, to the vault-relative path of the note.
+	notes map[string]string
+	// attachments maps lowercase file names and vault-relative paths to the
+	// vault-relative path of the file.
+	attachments map[string]string
+}
+
+// addShallowest maps a bare name to the file closest to the vault root, which
+// is how Obsidian resolves names shared by several files.
+func addShallowest(m map[string]string, name, rel string) {
+	if existing, exists := m[name]; exists && strings.Count(existing, "/") <= strings.Count(rel, "/") {
+		return
+	}
+	m[name] = rel
+}
+
+func scanObsidianVault(root string) (*obsidianVault, error) {
+	vault := &obsidianVault{root: root, notes: map[string]string{}, attachments: map[string]string{}}
+	walker := func(loc string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if loc != root && strings.HasPrefix(info.Name(), ".") {
+				// .obsidian, .trash, .git
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(root, loc)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if strings.ToLower(path.Ext(rel)) == ".md" {
+			stem := strings.TrimSuffix(rel, path.Ext(rel))
+			vault.notes[strings.ToLower(stem)] = rel
+			addShallowest(vault.notes, strings.ToLower(path.Base(stem)), rel)
+		} else {
+			vault.attachments[strings.ToLower(rel)] = rel
+			addShallowest(vault.attachments, strings.ToLower(path.Base(rel)), rel)
+		}
+		return nil
+	}
+	if err := filepath.Walk(root, walker); err != nil {
+		return nil, fmt.Errorf("scanning vault %q: %w", root, err)
+	}
+	return vault, nil
+}
+
+// obsidianImport converts the notes of a vault subfolder into pages.
+type obsidianImport struct {
+	vault *obsidianVault
+	// subdir is the vault-relative folder being imported.
+	subdir string
+	// destdir is the directory the pages are written to and attachmentsdir
+	// the directory the attachments are copied to.
+	destdir        string
+	attachmentsdir string
+	conf           siteConfig
+	// copied records the attachments already copied.
+	copied map[string]bool
+}
+
+// imported reports whether a note is part of the import.
+func (imp *obsidianImport) imported(note string) bool {
+	return imp.subdir == "." || strings.HasPrefix(note, imp.subdir+"/")
+}
+
+// pageName returns the ref name of the page an imported note becomes.
+func (imp *obsidianImport) pageName(note string) (string, error) {
+	rel := strings.TrimSuffix(note, path.Ext(note))
+	if imp.subdir != "." {
+		rel = strings.TrimPrefix(rel, imp.subdir+"/")
+	}
+	name, err := filepath.Rel(imp.conf.SourcePath, filepath.Join(imp.destdir, filepath.FromSlash(rel)))
+	if err != nil || strings.HasPrefix(name, "..") {
+		return "", fmt.Errorf("import destination %q is not under the source path %q", imp.destdir, imp.conf.SourcePath)
+	}
+	return filepath.ToSlash(name), nil
+}
+
+// copyAttachment copies an attachment to the resources of the site and
+// returns its URL relative to the site root.
+func (imp *obsidianImport) copyAttachment(attachment string) (string, error) {
+	dstloc := filepath.Join(imp.attachmentsdir, path.Base(attachment))
+	if !imp.copied[attachment] {
+		if err := os.MkdirAll(imp.attachmentsdir, 0777); err != nil {
+			return "", fmt.Errorf("creating path %q: %w", imp.attachmentsdir, err)
+		}
+		srcloc := filepath.Join(imp.vault.root, filepath.FromSlash(attachment))
+		fmt.Printf("   %s -> %s\n", srcloc, dstloc)
+		if err := copyFile(srcloc, dstloc); err != nil {
+			return "", err
+		}
+		imp.copied[attachment] = true
+	}
+	return filepath.ToSlash(dstloc), nil
+}
+
+// convertLinks rewrites the wikilinks and embeds of a note.  Links to
+// imported notes become refs, embedded notes are inlined, and attachments
+// are copied and linked.
+func (imp *obsidianImport) convertLinks(body []byte, pageURL string, depth int) ([]byte, error) {
+	relroot := relRootOf(pageURL)
+	var convErr error
+	converted := obsidianLinkRe.ReplaceAllFunc(body, func(match []byte) []byte {
+		if convErr != nil {
+			return match
+		}
+		sub := obsidianLinkRe.FindSubmatch(match)
+		embed := len(sub[1]) > 0
+		target, heading, label := strings.TrimSpace(string(sub[2])), string(sub[3]), string(sub[4])
+		if label == "" {
+			label = path.Base(target)
+			if heading != "" {
+				label += " > " + heading
+			}
+		}
+
+		if note, ok := imp.vault.notes[strings.ToLower(strings.TrimSuffix(target, ".md"))]; ok {
+			if embed {
+				if depth >= maxEmbedDepth {
+					fmt.Fprintf(os.Stderr, "warning: embeds of %q nested too deeply\n", note)
+					return match
+				}
+				content, _, err := readSource(filepath.Join(imp.vault.root, filepath.FromSlash(note)))
+				if err != nil {
+					convErr = fmt.Errorf("reading embedded note: %w", err)
+					return match
+				}
+				_, content, _ = splitFrontMatter(content, yamlDelimiter)
+				content, convErr = imp.convertLinks(content, pageURL, depth+1)
+				return content
+			}
+			if !imp.imported(note) {
+				fmt.Fprintf(os.Stderr, "warning: link to %q, which is not imported, converted to text\n", note)
+				return []byte(label)
+			}
+			name, err := imp.pageName(note)
+			if err != nil {
+				convErr = err
+				return match
+			}
+			if heading != "" {
+				name += "#" + slugify(heading)
+			}
+			return []byte(fmt.Sprintf(`[%s]({{< ref "%s" >}})`, label, name))
+		}
+
+		if attachment, ok := imp.vault.attachments[strings.ToLower(target)]; ok {
+			url, err := imp.copyAttachment(attachment)
+			if err != nil {
+				convErr = err
+				return match
+			}
+			if embed {
+				// the label of an embed is its size, not its text
+				return []byte(fmt.Sprintf("![%s](%s)", path.Base(target), path.Join(relroot, url)))
+			}
+			return []byte(fmt.Sprintf("[%s](%s)", label, path.Join(relroot, url)))
+		}
+
+		fmt.Fprintf(os.Stderr, "warning: unresolved link %s\n", match)
+		return []byte(label)
+	})
+	return converted, convErr
+}
+
+// frontMatterTags returns the tags of an Obsidian front matter block, which
+// may be a list or a comma or space separated string.
+func frontMatterTags(front []byte) ([]string, error) {
+	var fm struct {
+		Tags any `yaml:"tags"`
+	}
+	if err := yaml.Unmarshal(front, &fm); err != nil {
+		return nil, fmt.Errorf("parsing front matter: %w", err)
+	}
+	var tags []string
+	add := func(tag string) {
+		if tag = strings.TrimPrefix(strings.TrimSpace(tag), "#"); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	switch t := fm.Tags.(type) {
+	case string:
+		for _, tag := range strings.FieldsFunc(t, func(r rune) bool { return r == ',' || r == ' ' }) {
+			add(tag)
+		}
+	case []any:
+		for _, tag := range t {
+			add(fmt.Sprint(tag))
+		}
+	}
+	return tags, nil
+}
+
+// importNote converts a note and writes it, with a metadata file holding its
+// tags, to the destination.
+func (imp *obsidianImport) importNote(note string) error {
+	srcloc := filepath.Join(imp.vault.root, filepath.FromSlash(note))
+	content, _, err := readSource(srcloc)
+	if err != nil {
+		return fmt.Errorf("reading note: %w", err)
+	}
+	front, body, _ := splitFrontMatter(content, yamlDelimiter)
+	tags, err := frontMatterTags(front)
+	if err != nil {
+		return fmt.Errorf("importing %q: %w", srcloc, err)
+	}
+
+	name, err := imp.pageName(note)
+	if err != nil {
+		return err
+	}
+	dstloc := filepath.Join(imp.conf.SourcePath, filepath.FromSlash(name)+".md")
+	body, err = imp.convertLinks(body, siteURL(outputPath(dstloc, imp.conf), imp.conf), 0)
+	if err != nil {
+		return fmt.Errorf("importing %q: %w", srcloc, err)
+	}
+	if title := parsePost(body).title; title == "" {
+		// Obsidian shows the file name as the title
+		body = append([]byte(fmt.Sprintf("# %s\n\n", strings.TrimSuffix(path.Base(note), path.Ext(note)))), body...)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dstloc), 0777); err != nil {
+		return fmt.Errorf("creating path %q: %w", filepath.Dir(dstloc), err)
+	}
+	fmt.Printf("   %s -> %s\n", srcloc, dstloc)
+	if err := os.WriteFile(dstloc, body, 0666); err != nil {
+		return fmt.Errorf("writing page %q: %w", dstloc, err)
+	}
+	if len(tags) > 0 {
+		meta, err := json.MarshalIndent(map[string][]string{"tags": tags}, "", "  ")
+		if err != nil {
+			return fmt.Errorf("encoding metadata of %q: %w", dstloc, err)
+		}
+		if err := os.WriteFile(metadataPath(dstloc), meta, 0666); err != nil {
+			return fmt.Errorf("writing metadata %q: %w", metadataPath(dstloc), err)
+		}
+	}
+	return nil
+}
+
+// importObsidian converts the notes under subdir of a vault into pages under
+// destdir and copies the attachments they use to attachmentsdir.
+func importObsidian(vaultroot, subdir, destdir, attachmentsdir string, conf siteConfig) error {
+	vault, err := scanObsidianVault(vaultroot)
+	if err != nil {
+		return err
+	}
+	imp := &obsidianImport{
+		vault:          vault,
+		subdir:         path.Clean(filepath.ToSlash(subdir)),
+		destdir:        destdir,
+		attachmentsdir: attachmentsdir,
+		conf:           conf,
+		copied:         map[string]bool{},
+	}
+	fmt.Printf(":: Importing Obsidian vault %s\n", filepath.Join(vaultroot, subdir))
+	var notes []string
+	for key, note := range vault.notes {
+		// each note is indexed by its path and possibly its name
+		if key == strings.ToLower(strings.TrimSuffix(note, path.Ext(note))) && imp.imported(note) {
+			notes = append(notes, note)
+		}
+	}
+	sort.Strings(notes)
+	for _, note := range notes {
+		if err := imp.importNote(note); err != nil {
+			return fmt.Errorf("importing vault: %w", err)
+		}
+	}
+	fmt.Printf("   Imported %d note%s and %d attachment%s\n", len(notes), plural(len(notes)), len(imp.copied), plural(len(imp.copied)))
+	return nil
+}
+
+func runImportObsidian(args []string) error {
+	flags := flag.NewFlagSet("import-obsidian", flag.ExitOnError)
+	destdir := flags.String("dest", "", "directory to write the pages to (default: the source path)")
+	attachments := flags.String("attachments", "attachments", "directory, relative to the resource path, to copy attachments to")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: statiko import-obsidian [options] <vault> [subfolder]\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		flags.Usage()
+		return fmt.Errorf("import-obsidian: expected a vault path and an optional subfolder")
+	}
+	subdir := "."
+	if flags.NArg() == 2 {
+		subdir = flags.Arg(1)
+	}
+
+	conf, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if *destdir == "" {
+		*destdir = conf.SourcePath
+	} else {
+		*destdir = argPath(*destdir)
+	}
+	return importObsidian(argPath(flags.Arg(0)), subdir, *destdir, filepath.Join(conf.ResourcePath, *attachments), conf)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// pageMeta describes a page for link previews, such as OpenGraph and Twitter
+// cards.
+type pageMeta struct {
+	Title   string
+	Summary string
+	// Image is the URL of the cover image: the image of the front matter or
+	// else the first image on the page.  It is relative to the page, or
+	// absolute with BaseURL.
+	Image string
+	// URL is the URL of the page, relative to the site root or absolute
+	// with BaseURL.
+	URL string
+}
+
+// firstImage returns the destination of the first image of a document.
+func firstImage(doc ast.Node) string {
+	var src string
+	visitor := func(node ast.Node, entering bool) ast.WalkStatus {
+		if img, ok := node.(*ast.Image); ok && entering {
+			src = string(img.Destination)
+			return ast.Terminate
+		}
+		return ast.GoToNext
+	}
+	ast.WalkFunc(doc, visitor)
+	return src
+}
+
+func newPageMeta(p post, front frontMatter, doc ast.Node, pageURL string, conf siteConfig) pageMeta {
+	meta := pageMeta{Title: p.title, Summary: p.summary, Image: front.Image, URL: conf.absoluteURL(pageURL)}
+	if meta.Image == "" {
+		meta.Image = firstImage(doc)
+	}
+	if conf.BaseURL != "" {
+		// link preview crawlers require absolute URLs
+		meta.Image = conf.absoluteURL(siteRelativeURL(pageURL, meta.Image))
+	}
+	return meta
+}
+
+// tags renders the OpenGraph and Twitter card meta tags of the page.
+func (m pageMeta) tags(siteName string) template.HTML {
+	var b strings.Builder
+	add := func(attr, name, content string) {
+		if content != "" {
+			fmt.Fprintf(&b, "<meta %s=\"%s\" content=\"%s\">\n", attr, name, template.HTMLEscapeString(content))
+		}
+	}
+	add("property", "og:type", "website")
+	add("property", "og:site_name", siteName)
+	add("property", "og:title", m.Title)
+	add("property", "og:description", m.Summary)
+	add("property", "og:url", m.URL)
+	add("property", "og:image", m.Image)
+	card := "summary"
+	if m.Image != "" {
+		card = "summary_large_image"
+	}
+	add("name", "twitter:card", card)
+	add("name", "twitter:title", m.Title)
+	add("name", "twitter:description", m.Summary)
+	add("name", "twitter:image", m.Image)
+	return template.HTML(b.String())
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// Output formats a page can request in addition to HTML, with the extension
+// of their files.
+const (
+	formatGemtext = "gemtext"
+	formatText    = "text"
+	formatJSON    = "json"
+)
+
+var formatExtensions = map[string]string{
+	formatGemtext: ".gmi",
+	formatText:    ".txt",
+	formatJSON:    ".json",
+}
+
+// formatData is the data of the templates of the additional output formats.
+type formatData struct {
+	Title string
+	// URL is the URL of the HTML page relative to the site root.
+	URL  string
+	Page frontMatter
+	// Content is the page rendered in the format.
+	Content string
+}
+
+// pageJSON is the JSON output format of a page.
+type pageJSON struct {
+	Title string      `json:"title"`
+	URL   string      `json:"url"`
+	Page  frontMatter `json:"page"`
+	HTML  string      `json:"html"`
+	Text  string      `json:"text"`
+}
+
+// lineRenderer renders a document as lines of text.  In gemini mode, headings
+// keep their level markers and the links of each block are listed after it
+// as link lines.
+type lineRenderer struct {
+	gemini bool
+	lines  []string
+	// links holds the link lines of the current block.
+	links []string
+}
+
+// inline returns the text of the inline children of a node, recording the
+// links it contains.
+func (lr *lineRenderer) inline(node ast.Node) string {
+	var b strings.Builder
+	visitor := func(node ast.Node, entering bool) ast.WalkStatus {
+		if !entering {
+			return ast.GoToNext
+		}
+		switch nd := node.(type) {
+		case *ast.Text:
+			b.Write(nd.Literal)
+		case *ast.Code:
+			b.Write(nd.Literal)
+		case *ast.Softbreak:
+			b.WriteString(" ")
+		case *ast.Hardbreak:
+			b.WriteString("\n")
+		case *ast.Link:
+			label := strings.TrimSpace(childLiterals(nd))
+			lr.links = append(lr.links, strings.TrimSpace(fmt.Sprintf("=> %s %s", nd.Destination, label)))
+		case *ast.Image:
+			alt := strings.TrimSpace(childLiterals(nd))
+			lr.links = append(lr.links, strings.TrimSpace(fmt.Sprintf("=> %s %s", nd.Destination, alt)))
+			b.WriteString(alt)
+			return ast.SkipChildren
+		}
+		return ast.GoToNext
+	}
+	for _, child := range node.GetChildren() {
+		ast.WalkFunc(child, visitor)
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// block renders a block node and the link lines of its links.
+func (lr *lineRenderer) block(node ast.Node, prefix string) {
+	switch nd := node.(type) {
+	case *ast.Heading:
+		text := lr.inline(nd)
+		if lr.gemini {
+			text = strings.Repeat("#", min(nd.Level, 3)) + " " + text
+		}
+		lr.lines = append(lr.lines, text)
+	case *ast.Paragraph:
+		lr.lines = append(lr.lines, prefix+lr.inline(nd))
+	case *ast.List:
+		var items []string
+		for _, item := range nd.GetChildren() {
+			var texts []string
+			for _, child := range item.GetChildren() {
+				if _, isList := child.(*ast.List); isList {
+					texts = append(texts, plainText(child))
+				} else {
+					texts = append(texts, lr.inline(child))
+				}
+			}
+			items = append(items, prefix+"* "+strings.Join(texts, " "))
+		}
+		lr.lines = append(lr.lines, strings.Join(items, "\n"))
+	case *ast.CodeBlock:
+		code := strings.TrimSuffix(string(nd.Literal), "\n")
+		if lr.gemini {
+			code = "```\n" + code + "\n```"
+		}
+		lr.lines = append(lr.lines, code)
+	case *ast.BlockQuote:
+		for _, child := range nd.GetChildren() {
+			lr.block(child, "> ")
+		}
+		return
+	case *ast.HTMLBlock, *ast.HorizontalRule:
+		return
+	default:
+		if text := plainText(nd); text != "" {
+			lr.lines = append(lr.lines, prefix+text)
+		}
+	}
+	if lr.gemini && len(lr.links) > 0 {
+		lr.lines = append(lr.lines, strings.Join(lr.links, "\n"))
+	}
+	lr.links = nil
+}
+
+// renderLines renders a document as gemtext or as plain text.
+func renderLines(doc ast.Node, gemini bool) string {
+	lr := &lineRenderer{gemini: gemini}
+	for _, child := range doc.GetChildren() {
+		lr.block(child, "")
+	}
+	return strings.Join(lr.lines, "\n\n") + "\n"
+}
+
+// renderFormat renders a page in an additional output format.
+func renderFormat(format string, doc ast.Node, data formatData, body string) ([]byte, error) {
+	switch format {
+	case formatGemtext:
+		return []byte(renderLines(doc, true)), nil
+	case formatText:
+		return []byte(renderLines(doc, false)), nil
+	case formatJSON:
+		return json.MarshalIndent(pageJSON{Title: data.Title, URL: data.URL, Page: data.Page, HTML: body, Text: renderLines(doc, false)}, "", "  ")
+	}
+	return nil, fmt.Errorf("unknown output format %q", format)
+}
+
+// writeFormats writes the additional output formats requested by a page next
+// to its HTML file and returns the paths of the files.  Formats with a
+// template in OutputTemplates are written by executing the template with the
+// rendered content.
+func writeFormats(outpath string, doc ast.Node, data formatData, body string, conf siteConfig) ([]string, error) {
+	var written []string
+	for _, format := range data.Page.Outputs {
+		ext, ok := formatExtensions[format]
+		if !ok {
+			return nil, fmt.Errorf("unknown output format %q (must be %q, %q, or %q)", format, formatGemtext, formatText, formatJSON)
+		}
+		content, err := renderFormat(format, doc, data, body)
+		if err != nil {
+			return nil, err
+		}
+		if tfile := conf.OutputTemplates[format]; tfile != "" {
+			tsrc, err := readTemplate(tfile)
+			if err != nil {
+				return nil, err
+			}
+			t, err := template.New(tfile).Parse(tsrc)
+			if err != nil {
+				return nil, newTemplateError(tfile, err)
+			}
+			data.Content = string(content)
+			rendered := new(bytes.Buffer)
+			if err := t.Execute(rendered, data); err != nil {
+				return nil, newTemplateError(tfile, err)
+			}
+			content = rendered.Bytes()
+		}
+		fpath := strings.TrimSuffix(outpath, filepath.Ext(outpath)) + ext
+		if err := os.WriteFile(fpath, content, 0666); err != nil {
+			return nil, fmt.Errorf("writing %s file %q: %w", format, fpath, err)
+		}
+		written = append(written, fpath)
+	}
+	return written, nil
+}
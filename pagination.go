@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Sitemap inclusion rules for the pages of paginated listings.
+const (
+	sitemapFirstPage = "first"
+	sitemapAllPages  = "all"
+)
+
+// paginationConfig configures the pagination of the listings of tags,
+// categories, authors, and archives.
+type paginationConfig struct {
+	// PageSize is the number of posts on each page of a listing.  Zero
+	// disables pagination.
+	PageSize int `mapstructure:"PageSize"`
+	// Sitemap selects the pages of each listing that are listed in the
+	// sitemap: "first" or "all".
+	Sitemap string `mapstructure:"Sitemap"`
+}
+
+func (c paginationConfig) validate() error {
+	if c.PageSize < 0 {
+		return fmt.Errorf("pagination page size must not be negative")
+	}
+	switch c.Sitemap {
+	case sitemapFirstPage, sitemapAllPages:
+		return nil
+	}
+	return fmt.Errorf("unknown pagination sitemap rule %q: must be %q or %q", c.Sitemap, sitemapFirstPage, sitemapAllPages)
+}
+
+// paginatedPageRe matches the URLs of the pages of listings after the first.
+var paginatedPageRe = regexp.MustCompile(`-page-[0-9]+\.html$`)
+
+// paginatedURL returns the URL of a page of a listing: the URL of the listing
+// for the first page, and the URL with -page-N inserted before the extension
+// for the others, e.g. tags/go-page-2.html.  Pages stay in the directory of
+// the listing, so relative links work the same on every page.
+func paginatedURL(url string, page int) string {
+	if page <= 1 {
+		return url
+	}
+	return fmt.Sprintf("%s-page-%d.html", strings.TrimSuffix(url, ".html"), page)
+}
+
+// paginate splits the posts of a listing into pages.  Without pagination, or
+// without posts, there is a single page.
+func paginate(posts postSet, size int) []postSet {
+	if size <= 0 || len(posts) <= size {
+		return []postSet{posts}
+	}
+	var pages []postSet
+	for start := 0; start < len(posts); start += size {
+		pages = append(pages, posts[start:min(start+size, len(posts))])
+	}
+	return pages
+}
+
+// pagination describes a page of a paginated listing for templates.  Links
+// are relative to the page, and empty where there is no such page.
+type pagination struct {
+	Page  int
+	Pages int
+	First string
+	Prev  string
+	Next  string
+	// ascending is set when the posts are listed oldest first, so the
+	// previous pages hold older posts.
+	ascending bool
+}
+
+// newPagination returns the pagination of a page of the listing at url.
+func newPagination(url string, page, pages int, conf siteConfig) pagination {
+	link := func(n int) string {
+		return conf.pageLink(".", path.Base(paginatedURL(url, n)))
+	}
+	p := pagination{Page: page, Pages: pages, First: link(1), ascending: conf.PostsAscending}
+	if page > 1 {
+		p.Prev = link(page - 1)
+	}
+	if page < pages {
+		p.Next = link(page + 1)
+	}
+	return p
+}
+
+// markdown returns the navigation between the pages of the listing.
+func (p pagination) markdown() string {
+	if p.Pages <= 1 {
+		return ""
+	}
+	prev, next := "Newer", "Older"
+	if p.ascending {
+		prev, next = next, prev
+	}
+	nav := []string{fmt.Sprintf("Page %d of %d", p.Page, p.Pages)}
+	if p.Prev != "" {
+		nav = append([]string{fmt.Sprintf("[← %s](%s)", prev, p.Prev)}, nav...)
+	}
+	if p.Next != "" {
+		nav = append(nav, fmt.Sprintf("[%s →](%s)", next, p.Next))
+	}
+	return "\n" + strings.Join(nav, " · ") + "\n"
+}
+
+// listingPagination returns the pagination and the canonical URL of a page of
+// the listing at url.  Each page of a paginated listing is its own canonical
+// page, since the pages list different posts; listings with a single page
+// have neither.
+func listingPagination(url string, page, pages int, conf siteConfig) (pagination, string) {
+	if pages <= 1 {
+		return pagination{}, ""
+	}
+	pageURL := paginatedURL(url, page)
+	canonical := conf.pageLink(".", path.Base(pageURL))
+	if conf.BaseURL != "" {
+		canonical = conf.absoluteURL(pageURL)
+	}
+	return newPagination(url, page, pages, conf), canonical
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// fontURLRe matches the web font URLs of a stylesheet.
+var fontURLRe = regexp.MustCompile(`url\(\s*['"]?([^'")?#]+\.(woff2|woff|ttf|otf))(?:[?#][^'")]*)?['"]?\s*\)`)
+
+// headRe matches the opening tag of the head of a page.
+var headRe = regexp.MustCompile(`(?i)<head(?:\s[^>]*)?>`)
+
+// preloadHint is a <link rel="preload"> for an asset of a page.
+type preloadHint struct {
+	href string
+	as   string
+	// fontType is the MIME type of fonts, which are fetched in CORS mode.
+	fontType string
+}
+
+func (h preloadHint) String() string {
+	href := template.HTMLEscapeString(h.href)
+	if h.as == "font" {
+		return fmt.Sprintf(`<link rel="preload" href="%s" as="font" type="%s" crossorigin>`, href, h.fontType)
+	}
+	return fmt.Sprintf(`<link rel="preload" href="%s" as="%s">`, href, h.as)
+}
+
+// criticalAssets returns the href of the first stylesheet and the source of
+// the first image of a rendered page, and the assets the page already
+// preloads.
+func criticalAssets(page []byte) (stylesheet, image string, preloaded map[string]bool) {
+	preloaded = map[string]bool{}
+	tokenizer := html.NewTokenizer(bytes.NewReader(page))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return stylesheet, image, preloaded
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			attrs := map[string]string{}
+			for _, attr := range token.Attr {
+				attrs[attr.Key] = attr.Val
+			}
+			switch token.Data {
+			case "link":
+				rels := strings.Fields(strings.ToLower(attrs["rel"]))
+				for _, rel := range rels {
+					switch {
+					case rel == "stylesheet" && stylesheet == "":
+						stylesheet = attrs["href"]
+					case rel == "preload":
+						preloaded[attrs["href"]] = true
+					}
+				}
+			case "img":
+				if src := attrs["src"]; image == "" && !strings.HasPrefix(src, "data:") {
+					image = src
+				}
+			}
+		}
+	}
+}
+
+// readSiteFile reads a file of the site by its URL relative to the site root.
+// Resources are read from the resource directory, since pages are rendered
+// before the resources are copied, and other files, such as theme assets,
+// from the destination.
+func readSiteFile(url string, conf siteConfig) ([]byte, error) {
+	resloc := filepath.FromSlash(url)
+	if isUnder(absPath(resloc), absPath(conf.ResourcePath)) {
+		if content, err := os.ReadFile(resloc); err == nil {
+			return content, nil
+		}
+	}
+	return os.ReadFile(filepath.Join(conf.DestinationPath, filepath.FromSlash(url)))
+}
+
+// stylesheetFonts returns the URLs, relative to the site root, of the web
+// fonts a local stylesheet uses.  When the stylesheet has WOFF2 fonts, the
+// fallback formats, which browsers with WOFF2 support never fetch, are left
+// out.
+func stylesheetFonts(cssURL string, conf siteConfig) []preloadHint {
+	css, err := readSiteFile(cssURL, conf)
+	if err != nil {
+		return nil
+	}
+	var fonts []preloadHint
+	seen := map[string]bool{}
+	for _, match := range fontURLRe.FindAllSubmatch(css, -1) {
+		ref := string(match[1])
+		if isRemoteURL(ref) || strings.HasPrefix(ref, "//") {
+			continue
+		}
+		url := linkTarget(ref, cssURL)
+		if url == "" || seen[url] {
+			continue
+		}
+		seen[url] = true
+		fonts = append(fonts, preloadHint{href: url, as: "font", fontType: "font/" + string(match[2])})
+	}
+	var woff2 []preloadHint
+	for _, font := range fonts {
+		if font.fontType == "font/woff2" {
+			woff2 = append(woff2, font)
+		}
+	}
+	if len(woff2) > 0 {
+		return woff2
+	}
+	return fonts
+}
+
+// addPreloadHints inserts preload links at the start of the head of a page
+// for its critical assets: the first stylesheet, the web fonts it uses, and
+// the first image, which is usually the hero image.
+func addPreloadHints(page []byte, pageURL string, conf siteConfig) []byte {
+	loc := headRe.FindIndex(page)
+	if loc == nil {
+		return page
+	}
+	stylesheet, image, preloaded := criticalAssets(page)
+	var hints []preloadHint
+	if stylesheet != "" {
+		hints = append(hints, preloadHint{href: stylesheet, as: "style"})
+		if cssURL := linkTarget(stylesheet, pageURL); cssURL != "" {
+			relroot := relRootOf(pageURL)
+			for _, font := range stylesheetFonts(cssURL, conf) {
+				font.href = path.Join(relroot, font.href)
+				hints = append(hints, font)
+			}
+		}
+	}
+	if image != "" {
+		hints = append(hints, preloadHint{href: image, as: "image"})
+	}
+
+	var links strings.Builder
+	for _, hint := range hints {
+		if !preloaded[hint.href] {
+			links.WriteString(hint.String())
+		}
+	}
+	if links.Len() == 0 {
+		return page
+	}
+	hinted := make([]byte, 0, len(page)+links.Len())
+	hinted = append(hinted, page[:loc[1]]...)
+	hinted = append(hinted, links.String()...)
+	return append(hinted, page[loc[1]:]...)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"path"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// rebasePrettyLinks rewrites the relative links and images of the document
+// of the page at pageURL, which are relative to its source, for the page
+// written with PrettyURLs, a directory deeper: about.md links to contact.html
+// as ../contact/ and to res/style.css as ../res/style.css.  Without
+// PrettyURLs, the document is left unchanged.
+func rebasePrettyLinks(doc ast.Node, pageURL string, idx pageIndex, conf siteConfig) {
+	if !conf.PrettyURLs {
+		return
+	}
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if !entering {
+			return ast.GoToNext
+		}
+		switch node := node.(type) {
+		case *ast.Link:
+			node.Destination = []byte(idx.prettyLink(string(node.Destination), pageURL, conf))
+		case *ast.Image:
+			node.Destination = []byte(idx.prettyLink(string(node.Destination), pageURL, conf))
+		}
+		return ast.GoToNext
+	})
+}
+
+// rebaseLink returns a link relative to the source of the page at pageURL
+// relative to the page, for links written into raw HTML that
+// rebasePrettyLinks does not see, like those of shortcodes.  Without
+// PrettyURLs, the link is returned unchanged.
+func (idx pageIndex) rebaseLink(link, pageURL string, conf siteConfig) string {
+	if !conf.PrettyURLs {
+		return link
+	}
+	return idx.prettyLink(link, pageURL, conf)
+}
+
+// prettyLink returns a link relative to the source of the page at pageURL
+// relative to the page itself.  Links to pages end at their directories.
+// Links within the page, absolute links, and remote links are returned
+// unchanged.
+func (idx pageIndex) prettyLink(link, pageURL string, conf siteConfig) string {
+	if link == "" || strings.HasPrefix(link, "#") || strings.HasPrefix(link, "/") || isRemoteURL(link) {
+		return link
+	}
+	linkpath, suffix := link, ""
+	if cut := strings.IndexAny(link, "?#"); cut >= 0 {
+		linkpath, suffix = link[:cut], link[cut:]
+	}
+	if linkpath == "" {
+		return link
+	}
+	target := path.Join(path.Dir(idx.sourceURL(pageURL)), linkpath)
+	if pretty, ok := idx.pretty[target]; ok {
+		target = pretty
+	}
+	relroot := relRootOf(pageURL)
+	if _, isPage := idx.sources[target]; isPage {
+		return conf.pageLink(relroot, target) + suffix
+	}
+	rebased := path.Join(relroot, target)
+	if strings.HasSuffix(linkpath, "/") {
+		rebased += "/"
+	}
+	return rebased + suffix
+}
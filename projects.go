@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// projectMetadata is read from the metadata file of each project.
+type projectMetadata struct {
+	Thumbnail string `json:"thumbnail"`
+	Repo      string `json:"repo"`
+	// Weight orders the projects on the index page; lower weights come first.
+	Weight int `json:"weight"`
+}
+
+type project struct {
+	title   string
+	summary string
+	url     string
+	// source is the URL of the page without PrettyURLs, which its
+	// thumbnail is relative to.
+	source    string
+	thumbnail string
+	repo      string
+	weight    int
+}
+
+// newProject reads the details of a project from its source and optional
+// metadata file.  url is the URL of the project page and source its URL
+// without PrettyURLs.
+func newProject(fname, url, source string, mdsource []byte) (project, error) {
+	p := parsePost(mdsource)
+	if p.title == "" {
+		p.title = titleFromFilename(fname)
+	}
+	proj := project{title: p.title, summary: p.summary, url: url, source: source}
+
+	var pm projectMetadata
+	if _, err := readMetadata(fname, &pm); err != nil {
+		return proj, fmt.Errorf("reading project metadata: %w", err)
+	}
+	proj.thumbnail = pm.Thumbnail
+	proj.repo = pm.Repo
+	proj.weight = pm.Weight
+	return proj, nil
+}
+
+// addRepoLink appends a link to the project's repository to the end of its
+// page.
+func addRepoLink(doc ast.Node, proj project) {
+	if proj.repo == "" {
+		return
+	}
+	hr := ast.HorizontalRule{}
+	repoParagraph := ast.Paragraph{}
+	ast.AppendChild(&repoParagraph, &ast.Text{
+		Leaf: ast.Leaf{
+			Literal: []byte("Repository: "),
+		},
+	})
+	link := &ast.Link{Destination: []byte(proj.repo)}
+	ast.AppendChild(link, &ast.Text{
+		Leaf: ast.Leaf{
+			Literal: []byte(proj.repo),
+		},
+	})
+	ast.AppendChild(&repoParagraph, link)
+	ast.AppendChild(doc, &hr)
+	ast.AppendChild(doc, &repoParagraph)
+}
+
+const projectCardsHTML = `<h1>Projects</h1>
+<div class="project-grid">
+{{- range .}}
+<article class="project-card">
+{{- if .Thumbnail}}
+<a href="{{.URL}}"><img class="project-thumbnail" src="{{.Thumbnail}}" alt="" loading="lazy"></a>
+{{- end}}
+<h2><a href="{{.URL}}">{{.Title}}</a></h2>
+{{- if .Summary}}
+<p>{{.Summary}}</p>
+{{- end}}
+{{- if .Repo}}
+<p class="project-repo"><a href="{{.Repo}}">Repository</a></p>
+{{- end}}
+</article>
+{{- end}}
+</div>
+`
+
+var projectCardsTemplate = template.Must(template.New("projects").Parse(projectCardsHTML))
+
+// renderProjectsPage renders the card grid index of all projects.
+func renderProjectsPage(projects []project, data templateData, conf siteConfig) error {
+	if len(projects) == 0 {
+		return nil
+	}
+	fmt.Printf(":: Found %d project%s\n", len(projects), plural(len(projects)))
+
+	sort.SliceStable(projects, func(i, j int) bool {
+		if projects[i].weight != projects[j].weight {
+			return projects[i].weight < projects[j].weight
+		}
+		return projects[i].title < projects[j].title
+	})
+
+	type card struct {
+		Title     string
+		Summary   string
+		URL       string
+		Thumbnail string
+		Repo      string
+	}
+	cards := make([]card, len(projects))
+	for idx, proj := range projects {
+		thumbnail := proj.thumbnail
+		if thumbnail != "" && !path.IsAbs(thumbnail) && !isRemoteURL(thumbnail) {
+			// thumbnails are relative to the project source
+			thumbnail = path.Join(path.Dir(proj.source), thumbnail)
+		}
+		cards[idx] = card{
+			Title:     proj.title,
+			Summary:   proj.summary,
+			URL:       conf.pageLink(".", proj.url),
+			Thumbnail: thumbnail,
+			Repo:      proj.repo,
+		}
+	}
+	grid := new(bytes.Buffer)
+	if err := projectCardsTemplate.Execute(grid, cards); err != nil {
+		return fmt.Errorf("rendering project cards: %w", err)
+	}
+
+	data.Body = template.HTML(grid.String())
+	data.RelRoot = "."
+	data.Permalink = conf.absoluteURL("projects.html")
+	outpath := filepath.Join(conf.DestinationPath, "projects.html")
+	fmt.Printf("   Saving projects: %s\n", outpath)
+	htmlData, err := makeHTML(data, conf.listTemplate(), conf)
+	if err != nil {
+		return fmt.Errorf("making html for projects page: %w", err)
+	}
+	if err := os.WriteFile(outpath, htmlData, 0666); err != nil {
+		return fmt.Errorf("writing projects page %q: %w", outpath, err)
+	}
+	return nil
+}
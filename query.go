@@ -0,0 +1,168 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// postSet is a list of posts with chainable queries for building listings,
+// e.g. posts.WithTag("go").SortedByDate().Limit(5).  Queries return new sets
+// and leave the set they are called on unchanged.
+type postSet []post
+
+// Where returns the posts for which keep returns true.
+func (ps postSet) Where(keep func(p post) bool) postSet {
+	var kept postSet
+	for _, p := range ps {
+		if keep(p) {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
+
+// WithTerm returns the posts classified under a term of a taxonomy.  Terms
+// are compared by their slugs, like the URLs of their listing pages.
+func (ps postSet) WithTerm(tx taxonomy, term string) postSet {
+	slug := slugify(term)
+	return ps.Where(func(p post) bool {
+		for _, t := range tx.terms(p) {
+			if slugify(t) == slug {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// WithTag returns the posts with a tag.
+func (ps postSet) WithTag(tag string) postSet {
+	return ps.WithTerm(tagTaxonomy, tag)
+}
+
+// InCategory returns the posts in a category.
+func (ps postSet) InCategory(category string) postSet {
+	return ps.WithTerm(categoryTaxonomy, category)
+}
+
+// InSection returns the posts of a section.
+func (ps postSet) InSection(section string) postSet {
+	return ps.Where(func(p post) bool { return p.front.Section == section })
+}
+
+// date returns the posted date of a post, falling back to the date in the
+// file name of its source, or the zero time if it has neither.
+func (p post) date() time.Time {
+	if p.metadata == nil || p.metadata.DatePosted.IsZero() {
+		return p.fileDate
+	}
+	return p.metadata.DatePosted
+}
+
+// SortedByDate returns the posts, newest first.  Posts without a date come
+// last, in their original order.
+func (ps postSet) SortedByDate() postSet {
+	sorted := append(postSet(nil), ps...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].date().After(sorted[j].date())
+	})
+	return sorted
+}
+
+// OldestFirst returns the posts, oldest first.  Posts without a date come
+// last, in their original order.
+func (ps postSet) OldestFirst() postSet {
+	sorted := append(postSet(nil), ps...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		di, dj := sorted[i].date(), sorted[j].date()
+		return !di.IsZero() && (dj.IsZero() || di.Before(dj))
+	})
+	return sorted
+}
+
+// RelatedTo returns the posts sharing tags with a post, other than the post
+// itself, ordered by the number of shared tags and then newest first.  Tags
+// are compared ignoring case.
+func (ps postSet) RelatedTo(p post) postSet {
+	tags := map[string]bool{}
+	for _, tag := range p.tags {
+		tags[strings.ToLower(tag)] = true
+	}
+	shared := map[string]int{}
+	related := ps.Where(func(other post) bool {
+		if other.url == p.url {
+			return false
+		}
+		for _, tag := range other.tags {
+			if tags[strings.ToLower(tag)] {
+				shared[other.url]++
+			}
+		}
+		return shared[other.url] > 0
+	}).SortedByDate()
+	sort.SliceStable(related, func(i, j int) bool {
+		return shared[related[i].url] > shared[related[j].url]
+	})
+	return related
+}
+
+// Limit returns at most the first n posts.
+func (ps postSet) Limit(n int) postSet {
+	if n < len(ps) {
+		return ps[:n:n]
+	}
+	return ps
+}
+
+// relatedLinks returns links to the related posts of the post at pageURL,
+// relative to the post.
+func relatedLinks(related postSet, pageURL string, conf siteConfig) []pageLink {
+	relroot := relRootOf(pageURL)
+	links := make([]pageLink, len(related))
+	for idx, p := range related {
+		links[idx] = pageLink{Title: p.title, URL: conf.pageLink(relroot, p.url)}
+	}
+	return links
+}
+
+// adjacentPosts are the posts before and after a post in time.
+type adjacentPosts struct {
+	prev *post
+	next *post
+}
+
+// chronology returns the older and newer neighbors of each dated post
+// within its section, by URL.
+func chronology(posts postSet) map[string]adjacentPosts {
+	bySection := map[string]postSet{}
+	for _, p := range posts {
+		if !p.date().IsZero() {
+			bySection[p.front.Section] = append(bySection[p.front.Section], p)
+		}
+	}
+	adjacent := map[string]adjacentPosts{}
+	for _, section := range bySection {
+		sorted := section.SortedByDate()
+		for idx, p := range sorted {
+			var adj adjacentPosts
+			if idx+1 < len(sorted) {
+				adj.prev = &sorted[idx+1]
+			}
+			if idx > 0 {
+				adj.next = &sorted[idx-1]
+			}
+			adjacent[p.url] = adj
+		}
+	}
+	return adjacent
+}
+
+// postLink returns a link to a post relative to the page at pageURL, or nil
+// for no post.
+func postLink(p *post, pageURL string, conf siteConfig) *pageLink {
+	if p == nil {
+		return nil
+	}
+	return &pageLink{Title: p.title, URL: conf.pageLink(relRootOf(pageURL), p.url)}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// reactionCounts holds the number of comments and reactions of a page, as
+// exported by a webmention service or mail workflow.
+type reactionCounts struct {
+	Comments int `json:"comments"`
+	// Reactions maps the kind of each reaction, e.g. "like" or "repost", to
+	// its count.
+	Reactions map[string]int `json:"reactions"`
+}
+
+// Summary returns the counts as text, e.g. "3 comments · 5 likes", with the
+// reactions in order of their count.  It is empty if there are no counts.
+func (rc reactionCounts) Summary() string {
+	var parts []string
+	if rc.Comments > 0 {
+		parts = append(parts, fmt.Sprintf("%d comment%s", rc.Comments, plural(rc.Comments)))
+	}
+	kinds := make([]string, 0, len(rc.Reactions))
+	for kind, count := range rc.Reactions {
+		if count > 0 {
+			kinds = append(kinds, kind)
+		}
+	}
+	sort.Slice(kinds, func(i, j int) bool {
+		ci, cj := rc.Reactions[kinds[i]], rc.Reactions[kinds[j]]
+		if ci != cj {
+			return ci > cj
+		}
+		return kinds[i] < kinds[j]
+	})
+	for _, kind := range kinds {
+		count := rc.Reactions[kind]
+		parts = append(parts, fmt.Sprintf("%d %s%s", count, kind, plural(count)))
+	}
+	return strings.Join(parts, " · ")
+}
+
+// loadReactions reads the reactions file, a JSON object mapping the URLs of
+// pages to their counts.  URLs may be relative to the site root, with or
+// without a leading slash, or absolute under BaseURL (see pageURLOf).
+func loadReactions(conf siteConfig) (map[string]reactionCounts, error) {
+	if conf.ReactionsFile == "" {
+		return nil, nil
+	}
+	content, err := os.ReadFile(conf.ReactionsFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading reactions %q: %w", conf.ReactionsFile, err)
+	}
+	var raw map[string]reactionCounts
+	if err := json.Unmarshal(content, &raw); err != nil {
+		return nil, fmt.Errorf("reading reactions %q: %w", conf.ReactionsFile, err)
+	}
+	reactions := make(map[string]reactionCounts, len(raw))
+	for url, counts := range raw {
+		reactions[conf.pageURLOf(url)] = counts
+	}
+	return reactions, nil
+}
+
+// addReactions appends the summary of the counts, in a footer with the
+// reactions class, to the document of a post.
+func addReactions(doc ast.Node, counts reactionCounts) {
+	summary := counts.Summary()
+	if summary == "" {
+		return
+	}
+	footer := &ast.HTMLBlock{Leaf: ast.Leaf{Literal: []byte(`<footer class="reactions">` + html.EscapeString(summary) + `</footer>`)}}
+	ast.AppendChild(doc, footer)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Hosting platforms with a redirects file format.
+const (
+	hostingNetlify    = "netlify"
+	hostingGitLab     = "gitlab"
+	hostingCloudflare = "cloudflare"
+)
+
+// redirectStatuses lists the status codes each platform supports in its
+// redirects file.  200 rewrites the request instead of redirecting it.
+var redirectStatuses = map[string][]int{
+	hostingNetlify:    {200, 301, 302, 303, 307, 308, 404, 410, 451},
+	hostingGitLab:     {200, 301, 302},
+	hostingCloudflare: {200, 301, 302, 303, 307, 308},
+}
+
+// redirect is an entry of the canonical redirects definition.
+type redirect struct {
+	// From is the path redirected, starting with a slash.  It may end in a
+	// * splat, which To can refer to as :splat.
+	From string `mapstructure:"From"`
+	To   string `mapstructure:"To"`
+	// Status is the HTTP status of the redirect.  It defaults to 301.
+	Status int `mapstructure:"Status"`
+}
+
+// validateRedirects checks the redirects against the features of the hosting
+// platform.
+func validateRedirects(redirects []redirect, hosting string) error {
+	statuses, ok := redirectStatuses[hosting]
+	if !ok {
+		return fmt.Errorf("invalid hosting %q (must be %q, %q, or %q)", hosting, hostingNetlify, hostingGitLab, hostingCloudflare)
+	}
+	for _, r := range redirects {
+		if !strings.HasPrefix(r.From, "/") {
+			return fmt.Errorf("redirect from %q: path must start with /", r.From)
+		}
+		if r.To == "" {
+			return fmt.Errorf("redirect from %q: missing target", r.From)
+		}
+		status := r.status()
+		supported := false
+		for _, s := range statuses {
+			supported = supported || s == status
+		}
+		if !supported {
+			return fmt.Errorf("redirect from %q: status %d is not supported on %s", r.From, status, hosting)
+		}
+		if status == 200 && isRemoteURL(r.To) && hosting != hostingNetlify {
+			return fmt.Errorf("redirect from %q: %s can only rewrite to paths of the site", r.From, hosting)
+		}
+	}
+	return nil
+}
+
+func (r redirect) status() int {
+	if r.Status == 0 {
+		return 301
+	}
+	return r.Status
+}
+
+// redirectsFile returns the contents of the _redirects file.  The platforms
+// share the format of Netlify, one "from to status" rule per line, and
+// differ in the features they support, which validateRedirects checks.
+func redirectsFile(redirects []redirect) string {
+	var b strings.Builder
+	for _, r := range redirects {
+		fmt.Fprintf(&b, "%s %s %d\n", r.From, r.To, r.status())
+	}
+	return b.String()
+}
+
+// writeRedirects generates the redirects file for the configured hosting
+// platform.
+func writeRedirects(conf siteConfig) error {
+	if len(conf.Redirects) == 0 {
+		return nil
+	}
+	outpath := filepath.Join(conf.DestinationPath, "_redirects")
+	fmt.Printf("   Saving %s redirects: %s\n", conf.Hosting, outpath)
+	if err := os.WriteFile(outpath, []byte(redirectsFile(conf.Redirects)), 0666); err != nil {
+		return fmt.Errorf("writing redirects %q: %w", outpath, err)
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// refRe matches the ref shortcode, {{< ref "name" >}}, where name identifies
+// a page and may end in a #fragment.
+var refRe = regexp.MustCompile(`{{<\s*ref\s+"([^"]*)"\s*>}}`)
+
+// wikilinkRe matches wikilinks, [[Page Title]] or [[Page Title|label]].  The
+// optional leading ! marks an embed, which is left unchanged.
+var wikilinkRe = regexp.MustCompile(`(!?)\[\[([^\[\]|]+)(?:\|([^\[\]]+))?\]\]`)
+
+// pageIndex maps the names by which pages can be referenced to their URLs
+// relative to the site root.  Ambiguous names map to an empty URL.
+type pageIndex struct {
+	// names holds the source path of each page relative to SourcePath,
+	// without the extension, and its file name alone if that is unique.
+	names map[string]string
+	// titles holds the slugs of the title and file name of each page, for
+	// wikilinks.
+	titles map[string]string
+	// headings maps the URL of each page to the IDs of its headings, by
+	// their slugified text and by ID.
+	headings map[string]map[string]string
+	// sources maps the URL of each page to the URL it would have without
+	// PrettyURLs, which the relative links in its source are relative to,
+	// and pretty maps them back.  Both are empty without PrettyURLs.
+	sources map[string]string
+	pretty  map[string]string
+	// wikilinks enables wikilinks, which are otherwise left as they are.
+	wikilinks bool
+}
+
+// addUnique maps key to url, or to an empty URL if key is already mapped to
+// another page.
+func addUnique(m map[string]string, key, url string) {
+	if existing, exists := m[key]; exists && existing != url {
+		m[key] = ""
+	} else {
+		m[key] = url
+	}
+}
+
+// slugify converts text to the form of the IDs generated for headings:
+// lowercase letters and numbers separated by dashes.
+func slugify(text string) string {
+	var slug []rune
+	dash := false
+	for _, r := range text {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsNumber(r):
+			if dash && len(slug) > 0 {
+				slug = append(slug, '-')
+			}
+			dash = false
+			slug = append(slug, unicode.ToLower(r))
+		default:
+			dash = true
+		}
+	}
+	return string(slug)
+}
+
+// newPageIndex reads the titles of the pages and indexes them by name and
+// title.
+func newPageIndex(pagesmd []string, conf siteConfig) (pageIndex, error) {
+	idx := pageIndex{
+		names:     map[string]string{},
+		titles:    map[string]string{},
+		headings:  map[string]map[string]string{},
+		sources:   map[string]string{},
+		pretty:    map[string]string{},
+		wikilinks: conf.Wikilinks,
+	}
+	plain := conf
+	plain.PrettyURLs = false
+	for _, fname := range pagesmd {
+		url := siteURL(outputPath(fname, conf), conf)
+		if conf.PrettyURLs {
+			source := siteURL(outputPath(fname, plain), plain)
+			idx.sources[url] = source
+			idx.pretty[source] = url
+		}
+		rel, err := filepath.Rel(conf.SourcePath, fname)
+		if err != nil {
+			rel = fname
+		}
+		name := strings.TrimSuffix(filepath.ToSlash(rel), filepath.Ext(rel))
+		idx.names[name] = url
+		base := path.Base(name)
+		if base != name {
+			addUnique(idx.names, base, url)
+		}
+
+		pagemd, _, err := readSource(fname)
+		if err != nil {
+			return pageIndex{}, err
+		}
+		addUnique(idx.titles, slugify(base), url)
+		if title := parsePost(pagemd).title; title != "" {
+			addUnique(idx.titles, slugify(title), url)
+		}
+		ids := map[string]string{}
+		doc := parseMDWithExtensions(stripFrontMatter(pagemd), conf.Markdown.extensions())
+		for _, heading := range collectHeadings(doc) {
+			if _, exists := ids[slugify(heading.Text)]; !exists {
+				ids[slugify(heading.Text)] = heading.ID
+			}
+			ids[heading.ID] = heading.ID
+		}
+		idx.headings[url] = ids
+	}
+	return idx, nil
+}
+
+// sourceURL returns the URL that the relative links in the source of the
+// page at pageURL are relative to: the URL of the page without PrettyURLs.
+func (idx pageIndex) sourceURL(pageURL string) string {
+	if source, ok := idx.sources[pageURL]; ok {
+		return source
+	}
+	return pageURL
+}
+
+// resolve returns the URL of the referenced page relative to the site root.
+func (idx pageIndex) resolve(name string) (string, error) {
+	name, fragment, hasFragment := strings.Cut(name, "#")
+	name = strings.TrimSuffix(strings.TrimPrefix(name, "/"), ".md")
+	url, ok := idx.names[name]
+	if !ok {
+		return "", fmt.Errorf("ref %q: page not found", name)
+	}
+	if url == "" {
+		return "", fmt.Errorf("ref %q: ambiguous page name (use the path under the source directory)", name)
+	}
+	if hasFragment {
+		url += "#" + fragment
+	}
+	return url, nil
+}
+
+// resolveWikilink returns the URL, relative to the site root, of the page
+// with the given title, file name, or path under the source directory, as
+// Obsidian writes them.  A #fragment names a heading on the page, by its text
+// or ID, and a #fragment alone names a heading on the page at pageURL,
+// returned as the fragment.
+func (idx pageIndex) resolveWikilink(target, pageURL string) (string, error) {
+	title, heading, hasHeading := strings.Cut(target, "#")
+	title = strings.TrimSuffix(title, ".md")
+	var url string
+	var ok bool
+	switch {
+	case title == "" && hasHeading:
+		url, ok = pageURL, true
+	case strings.Contains(title, "/"):
+		url, ok = idx.names[strings.TrimPrefix(title, "/")]
+	default:
+		url, ok = idx.titles[slugify(title)]
+	}
+	if !ok {
+		return "", fmt.Errorf("wikilink [[%s]]: page not found", target)
+	}
+	if url == "" {
+		return "", fmt.Errorf("wikilink [[%s]]: ambiguous page title", target)
+	}
+	if !hasHeading {
+		return url, nil
+	}
+	id, ok := idx.headings[url][slugify(heading)]
+	if !ok {
+		return "", fmt.Errorf("wikilink [[%s]]: heading not found", target)
+	}
+	if title == "" {
+		return "#" + id, nil
+	}
+	return url + "#" + id, nil
+}
+
+// resolveLinks replaces the ref shortcodes and wikilinks in the markdown
+// source of a page with links to the referenced pages, relative to the source
+// of the page, like the other links in it.  Those in fenced code blocks and
+// code spans are left unchanged.
+func resolveLinks(md []byte, pageURL string, idx pageIndex) ([]byte, error) {
+	relroot := relRootOf(idx.sourceURL(pageURL))
+	var errs []string
+	resolved := replaceOutsideCode(refRe, md, func(match []byte) []byte {
+		name := string(refRe.FindSubmatch(match)[1])
+		url, err := idx.resolve(name)
+		if err != nil {
+			errs = append(errs, err.Error())
+			return match
+		}
+		return []byte(path.Join(relroot, url))
+	})
+	if idx.wikilinks {
+		resolved = replaceOutsideCode(wikilinkRe, resolved, func(match []byte) []byte {
+			sub := wikilinkRe.FindSubmatch(match)
+			if len(sub[1]) > 0 {
+				return match
+			}
+			target := strings.TrimSpace(string(sub[2]))
+			url, err := idx.resolveWikilink(target, pageURL)
+			if err != nil {
+				errs = append(errs, err.Error())
+				return match
+			}
+			if !strings.HasPrefix(url, "#") {
+				url = path.Join(relroot, url)
+			}
+			label := strings.TrimSpace(string(sub[3]))
+			if label == "" {
+				title, heading, hasHeading := strings.Cut(target, "#")
+				label = strings.TrimSuffix(title, ".md")
+				if hasHeading && label == "" {
+					label = heading
+				} else if hasHeading {
+					label += " > " + heading
+				}
+			}
+			return []byte(fmt.Sprintf("[%s](%s)", label, url))
+		})
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("resolving links in %q: %s", pageURL, strings.Join(errs, "; "))
+	}
+	return resolved, nil
+}
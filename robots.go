@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type robotsConfig struct {
+	// Enabled generates robots.txt in the destination root.
+	Enabled bool `mapstructure:"Enabled"`
+	// Disallow lists the URL paths crawlers are asked not to visit.
+	Disallow []string `mapstructure:"Disallow"`
+	// Sitemap is the URL of the sitemap of the site, which robots.txt
+	// references.  It must be absolute unless BaseURL is set, and defaults
+	// to the generated sitemap, if any.
+	Sitemap string `mapstructure:"Sitemap"`
+}
+
+func (c robotsConfig) validate(baseURL string) error {
+	if c.Sitemap != "" && !isRemoteURL(c.Sitemap) && baseURL == "" {
+		return fmt.Errorf("robots.txt sitemap %q must be an absolute URL or BaseURL must be set", c.Sitemap)
+	}
+	return nil
+}
+
+// robotsTxt returns the contents of robots.txt.  Without disallowed paths,
+// all crawlers are allowed everywhere.
+func robotsTxt(rc robotsConfig) string {
+	var b strings.Builder
+	b.WriteString("User-agent: *\n")
+	if len(rc.Disallow) == 0 {
+		b.WriteString("Disallow:\n")
+	}
+	for _, p := range rc.Disallow {
+		if !strings.HasPrefix(p, "/") {
+			p = "/" + p
+		}
+		fmt.Fprintf(&b, "Disallow: %s\n", p)
+	}
+	if rc.Sitemap != "" {
+		fmt.Fprintf(&b, "\nSitemap: %s\n", rc.Sitemap)
+	}
+	return b.String()
+}
+
+func writeRobots(conf siteConfig) error {
+	if !conf.Robots.Enabled {
+		return nil
+	}
+	outpath := filepath.Join(conf.DestinationPath, "robots.txt")
+	fmt.Printf("   Saving robots.txt: %s\n", outpath)
+	rc := conf.Robots
+	if rc.Sitemap == "" {
+		rc.Sitemap = conf.SitemapOutput
+	}
+	rc.Sitemap = conf.absoluteURL(rc.Sitemap)
+	if err := os.WriteFile(outpath, []byte(robotsTxt(rc)), 0666); err != nil {
+		return fmt.Errorf("writing robots.txt %q: %w", outpath, err)
+	}
+	return nil
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"text/template/parse"
+
+	"golang.org/x/net/html"
+)
+
+// sandboxConfig configures the sandbox of templates, for themes from third
+// parties.  Templates cannot read files or run commands in any case; the
+// sandbox also keeps them from calling functions in the template data,
+// referring to hosts that are not allowed, and producing runaway output.
+type sandboxConfig struct {
+	// Enabled turns on the sandbox for all templates.
+	Enabled bool `mapstructure:"Enabled"`
+	// AllowedHosts lists the hosts that the templates may refer to in URLs,
+	// e.g. of web fonts or analytics.  Other hosts fail the build.
+	AllowedHosts []string `mapstructure:"AllowedHosts"`
+	// MaxOutput is the size in kilobytes of the largest page a template may
+	// produce.
+	MaxOutput int `mapstructure:"MaxOutput"`
+}
+
+func (c sandboxConfig) validate() error {
+	if c.MaxOutput <= 0 {
+		return fmt.Errorf("invalid sandbox output limit %d", c.MaxOutput)
+	}
+	return nil
+}
+
+// sandboxDeniedFuncs are the template functions that sandboxed templates may
+// not use.
+var sandboxDeniedFuncs = map[string]string{
+	"call": "calls functions in the template data",
+}
+
+// urlHostRe matches the hosts of absolute and protocol-relative URLs.
+var urlHostRe = regexp.MustCompile(`(?i)(?:https?:)?//([a-z0-9-]+(?:\.[a-z0-9-]+)+)`)
+
+// urlHosts returns the hosts of the URLs in text.
+func urlHosts(text string) []string {
+	var hosts []string
+	for _, match := range urlHostRe.FindAllStringSubmatch(text, -1) {
+		hosts = append(hosts, strings.ToLower(match[1]))
+	}
+	return hosts
+}
+
+// urlAttrs are the attributes whose URLs make browsers load or send to
+// other hosts.
+var urlAttrs = map[string]bool{"href": true, "src": true, "action": true}
+
+// htmlHosts returns the hosts of the URLs in the href, src, and action
+// attributes of HTML.  Namespaces, doctypes, text, and scripts are not
+// links, so their URLs are ignored.
+func htmlHosts(content []byte) []string {
+	var hosts []string
+	tokenizer := html.NewTokenizer(bytes.NewReader(content))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return hosts
+		case html.StartTagToken, html.SelfClosingTagToken:
+			_, hasAttr := tokenizer.TagName()
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = tokenizer.TagAttr()
+				if !urlAttrs[string(key)] {
+					continue
+				}
+				u, err := url.Parse(strings.TrimSpace(string(val)))
+				if err == nil && u.Hostname() != "" {
+					hosts = append(hosts, strings.ToLower(u.Hostname()))
+				}
+			}
+		}
+	}
+}
+
+// templateUsage describes what a template touches.
+type templateUsage struct {
+	// Fields lists the fields and methods of the data that the template
+	// reads, relative to the data of the action they are in.
+	Fields []string
+	// Funcs lists the template functions the template uses.
+	Funcs []string
+	// Templates lists the templates the template includes.
+	Templates []string
+	// Hosts lists the hosts of the URLs in the links of the template text.
+	// Templates can also build URLs from their data, which only their
+	// output shows.
+	Hosts []string
+}
+
+// usageCollector gathers the usage of the nodes of parse trees.
+type usageCollector map[string]map[string]bool
+
+func (uc usageCollector) add(kind, value string) {
+	if uc[kind] == nil {
+		uc[kind] = map[string]bool{}
+	}
+	uc[kind][value] = true
+}
+
+func (uc usageCollector) walk(node parse.Node) {
+	switch node := node.(type) {
+	case *parse.ListNode:
+		if node == nil {
+			return
+		}
+		for _, child := range node.Nodes {
+			uc.walk(child)
+		}
+	case *parse.ActionNode:
+		uc.walk(node.Pipe)
+	case *parse.PipeNode:
+		if node == nil {
+			return
+		}
+		for _, cmd := range node.Cmds {
+			uc.walk(cmd)
+		}
+	case *parse.CommandNode:
+		for _, arg := range node.Args {
+			uc.walk(arg)
+		}
+	case *parse.IfNode:
+		uc.walkBranch(&node.BranchNode)
+	case *parse.RangeNode:
+		uc.walkBranch(&node.BranchNode)
+	case *parse.WithNode:
+		uc.walkBranch(&node.BranchNode)
+	case *parse.TemplateNode:
+		uc.add("templates", node.Name)
+		uc.walk(node.Pipe)
+	case *parse.FieldNode:
+		uc.add("fields", strings.Join(node.Ident, "."))
+	case *parse.ChainNode:
+		uc.walk(node.Node)
+		uc.add("fields", strings.Join(node.Field, "."))
+	case *parse.VariableNode:
+		if len(node.Ident) > 1 && node.Ident[0] == "$" {
+			uc.add("fields", strings.Join(node.Ident[1:], "."))
+		}
+	case *parse.IdentifierNode:
+		uc.add("funcs", node.Ident)
+	}
+}
+
+func (uc usageCollector) walkBranch(node *parse.BranchNode) {
+	uc.walk(node.Pipe)
+	uc.walk(node.List)
+	uc.walk(node.ElseList)
+}
+
+func (uc usageCollector) sorted(kind string) []string {
+	values := make([]string, 0, len(uc[kind]))
+	for value := range uc[kind] {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	return values
+}
+
+// addText adds the hosts of the links in the text of a parse tree, with the
+// actions left out.
+func (uc usageCollector) addText(node parse.Node) {
+	var text bytes.Buffer
+	writeTemplateText(&text, node)
+	for _, host := range htmlHosts(text.Bytes()) {
+		uc.add("hosts", host)
+	}
+}
+
+// writeTemplateText writes the text of the nodes of a parse tree, in order.
+func writeTemplateText(w *bytes.Buffer, node parse.Node) {
+	switch node := node.(type) {
+	case *parse.ListNode:
+		if node == nil {
+			return
+		}
+		for _, child := range node.Nodes {
+			writeTemplateText(w, child)
+		}
+	case *parse.TextNode:
+		w.Write(node.Text)
+	case *parse.IfNode:
+		writeTemplateText(w, node.List)
+		writeTemplateText(w, node.ElseList)
+	case *parse.RangeNode:
+		writeTemplateText(w, node.List)
+		writeTemplateText(w, node.ElseList)
+	case *parse.WithNode:
+		writeTemplateText(w, node.List)
+		writeTemplateText(w, node.ElseList)
+	}
+}
+
+func (uc usageCollector) usage() templateUsage {
+	return templateUsage{
+		Fields:    uc.sorted("fields"),
+		Funcs:     uc.sorted("funcs"),
+		Templates: uc.sorted("templates"),
+		Hosts:     uc.sorted("hosts"),
+	}
+}
+
+// inspectTemplateFile parses a template file on its own and returns what it
+// touches, including the templates it defines.
+func inspectTemplateFile(fname string) (templateUsage, error) {
+	content, err := os.ReadFile(fname)
+	if err != nil {
+		return templateUsage{}, fmt.Errorf("reading template file %q: %w", fname, err)
+	}
+	tree := parse.New(fname)
+	tree.Mode = parse.SkipFuncCheck
+	trees := map[string]*parse.Tree{}
+	if _, err := tree.Parse(string(content), "", "", trees); err != nil {
+		return templateUsage{}, newTemplateError(fname, err)
+	}
+	uc := usageCollector{}
+	for _, t := range trees {
+		uc.walk(t.Root)
+		uc.addText(t.Root)
+	}
+	return uc.usage(), nil
+}
+
+// problems returns what the sandbox does not allow in a template.  The hosts
+// a template refers to are checked in its output, see checkOutput.
+func (c sandboxConfig) problems(usage templateUsage) []string {
+	var problems []string
+	for _, fn := range usage.Funcs {
+		if reason, denied := sandboxDeniedFuncs[fn]; denied {
+			problems = append(problems, fmt.Sprintf("uses %s, which %s", fn, reason))
+		}
+	}
+	return problems
+}
+
+// checkTemplates fails if template files are not allowed by the sandbox.
+// Template files may not be symlinks, which could read files outside of a
+// theme.  It runs once per build, before any template is executed.
+func (c sandboxConfig) checkTemplates(files []string) error {
+	for _, fname := range files {
+		info, err := os.Lstat(fname)
+		if err != nil {
+			continue
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("template %q is a symlink, which the template sandbox does not allow", fname)
+		}
+		usage, err := inspectTemplateFile(fname)
+		if err != nil {
+			return err
+		}
+		if problems := c.problems(usage); len(problems) > 0 {
+			return fmt.Errorf("template %q %s", fname, strings.Join(problems, "; "))
+		}
+	}
+	return nil
+}
+
+// checkOutput fails if the output of a template links to a host that is
+// neither allowed nor in the data of the template.  The data comes from the
+// site, e.g. the links of a page, so its hosts are the site's choice, not the
+// template's.
+func (c sandboxConfig) checkOutput(name string, out []byte, data any) error {
+	chosen := map[string]bool{}
+	if encoded, err := json.Marshal(data); err == nil {
+		for _, host := range urlHosts(string(encoded)) {
+			chosen[host] = true
+		}
+	}
+	for _, host := range htmlHosts(out) {
+		if !chosen[host] && !slices.Contains(c.AllowedHosts, host) {
+			return fmt.Errorf("template %q refers to %s, which is not in Sandbox.AllowedHosts", name, host)
+		}
+	}
+	return nil
+}
+
+// errOutputLimit is returned when a sandboxed template produces more than
+// the output limit.
+var errOutputLimit = errors.New("output exceeds the sandbox limit")
+
+// limitedWriter fails writes past a number of bytes.
+type limitedWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (lw *limitedWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > lw.n {
+		return 0, errOutputLimit
+	}
+	lw.n -= int64(len(p))
+	return lw.w.Write(p)
+}
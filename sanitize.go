@@ -0,0 +1,13 @@
+package main
+
+import "github.com/microcosm-cc/bluemonday"
+
+// sanitizerPolicy allows the markup produced by the markdown renderer and
+// common formatting elements, while removing scripts, styles, event handler
+// attributes, and unsafe URL schemes.
+var sanitizerPolicy = bluemonday.UGCPolicy()
+
+// sanitizeHTML applies the sanitizer policy to rendered HTML.
+func sanitizeHTML(rendered []byte) []byte {
+	return sanitizerPolicy.SanitizeBytes(rendered)
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// defaultReleaseURL is the release endpoint queried by self-update.
+const defaultReleaseURL = "https://api.github.com/repos/achilleas-k/statiko/releases/latest"
+
+// checksumsAssetName is the name of the release asset listing the SHA-256
+// checksums of all the release binaries, in the format of sha256sum(1).
+//
+// The checksums come from the same release as the binaries and are not
+// signed, so they only protect against corrupted and truncated downloads.
+// Anyone who can replace the binary of a release can replace its checksums
+// too; self-update trusts the release host and TLS for that.
+const checksumsAssetName = "SHA256SUMS"
+
+type releaseAsset struct {
+	Name        string `json:"name"`
+	DownloadURL string `json:"browser_download_url"`
+}
+
+type releaseInfo struct {
+	Tag    string         `json:"tag_name"`
+	Assets []releaseAsset `json:"assets"`
+}
+
+func (r releaseInfo) asset(name string) (releaseAsset, bool) {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return releaseAsset{}, false
+}
+
+// binaryAssetName returns the name of the release binary for the current
+// platform.
+func binaryAssetName() string {
+	name := fmt.Sprintf("statiko-%s-%s", runtime.GOOS, runtime.GOARCH)
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+var httpClient = &http.Client{Timeout: 5 * time.Minute}
+
+func httpGet(url string) ([]byte, error) {
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %q: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func fetchRelease(url string) (releaseInfo, error) {
+	var release releaseInfo
+	body, err := httpGet(url)
+	if err != nil {
+		return release, fmt.Errorf("fetching release info: %w", err)
+	}
+	if err := json.Unmarshal(body, &release); err != nil {
+		return release, fmt.Errorf("decoding release info from %q: %w", url, err)
+	}
+	return release, nil
+}
+
+// parseChecksums reads a sha256sum(1) formatted list and returns the checksum
+// for the given file name.
+func parseChecksums(sums []byte, name string) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(sums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		// binary mode entries are prefixed with '*'
+		if strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("no checksum found for %q", name)
+}
+
+func fileChecksum(fname string) (string, error) {
+	fp, err := os.Open(fname)
+	if err != nil {
+		return "", err
+	}
+	defer fp.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, fp); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// replaceExecutable atomically replaces the executable at exepath with the
+// given data by writing it next to the original and renaming it over it.
+func replaceExecutable(exepath string, data []byte) error {
+	info, err := os.Stat(exepath)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(exepath), ".statiko-update-*")
+	if err != nil {
+		return err
+	}
+	tmpname := tmp.Name()
+	defer os.Remove(tmpname) // no-op after a successful rename
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpname, info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Rename(tmpname, exepath)
+}
+
+func selfUpdate(releaseURL string, checkOnly bool) error {
+	exepath, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("self-update: locating running executable: %w", err)
+	}
+	exepath, err = filepath.EvalSymlinks(exepath)
+	if err != nil {
+		return fmt.Errorf("self-update: locating running executable: %w", err)
+	}
+
+	fmt.Printf(":: Checking for updates at %s\n", releaseURL)
+	release, err := fetchRelease(releaseURL)
+	if err != nil {
+		return fmt.Errorf("self-update: %w", err)
+	}
+
+	binName := binaryAssetName()
+	binAsset, ok := release.asset(binName)
+	if !ok {
+		return fmt.Errorf("self-update: release %s has no binary for this platform (%s)", release.Tag, binName)
+	}
+	sumsAsset, ok := release.asset(checksumsAssetName)
+	if !ok {
+		return fmt.Errorf("self-update: release %s has no %s file; refusing to install an unverified binary", release.Tag, checksumsAssetName)
+	}
+
+	sums, err := httpGet(sumsAsset.DownloadURL)
+	if err != nil {
+		return fmt.Errorf("self-update: fetching checksums: %w", err)
+	}
+	expected, err := parseChecksums(sums, binName)
+	if err != nil {
+		return fmt.Errorf("self-update: %w", err)
+	}
+
+	current, err := fileChecksum(exepath)
+	if err != nil {
+		return fmt.Errorf("self-update: hashing running executable: %w", err)
+	}
+	if current == expected {
+		fmt.Printf("   Already up to date (%s)\n", release.Tag)
+		return nil
+	}
+	if checkOnly {
+		fmt.Printf("   Update available: %s\n", release.Tag)
+		return nil
+	}
+
+	fmt.Printf("   Downloading %s (%s)\n", binName, release.Tag)
+	binary, err := httpGet(binAsset.DownloadURL)
+	if err != nil {
+		return fmt.Errorf("self-update: downloading binary: %w", err)
+	}
+	actualSum := sha256.Sum256(binary)
+	if actual := hex.EncodeToString(actualSum[:]); actual != expected {
+		return errors.New("self-update: checksum mismatch for downloaded binary; not installing")
+	}
+
+	fmt.Printf("   Checksum matches %s (an integrity check; releases are not signed)\n", checksumsAssetName)
+	if err := replaceExecutable(exepath, binary); err != nil {
+		return fmt.Errorf("self-update: replacing %q: %w", exepath, err)
+	}
+	fmt.Printf("   Updated %s to %s\n", exepath, release.Tag)
+	return nil
+}
+
+func runSelfUpdate(args []string) error {
+	flags := flag.NewFlagSet("self-update", flag.ExitOnError)
+	releaseURL := flags.String("url", defaultReleaseURL, "release endpoint to query")
+	checkOnly := flags.Bool("check", false, "only check whether an update is available")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: statiko self-update [options]\n\nReplace the binary with the latest release.  The download is checked against\nthe SHA256SUMS of the release, which catches corruption but not a tampered\nrelease, since the checksums are not signed.\n\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	return selfUpdate(*releaseURL, *checkOnly)
+}
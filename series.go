@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// seriesDir is the directory of the combined pages and feeds of series in the
+// destination.
+const seriesDir = "series"
+
+// seriesPart is a post of a series with the document of its body, which is
+// merged into the combined page of the series.
+type seriesPart struct {
+	post post
+	doc  ast.Node
+}
+
+// series is a sequence of posts sharing the series name of their front
+// matter, in reading order.
+type series struct {
+	name  string
+	parts []seriesPart
+}
+
+// url returns the URL of the combined page of the series relative to the
+// site root.  Its feed is next to it with the .xml extension.
+func (s series) url() string {
+	return path.Join(seriesDir, slugify(s.name)+".html")
+}
+
+// collectSeries groups the parts by the slug of their series name, keeping the
+// spelling of the first part.  Parts are ordered by their part number and then
+// by date.
+func collectSeries(parts []seriesPart) []series {
+	bySlug := map[string]*series{}
+	var slugs []string
+	for _, part := range parts {
+		slug := slugify(part.post.front.Series)
+		s, ok := bySlug[slug]
+		if !ok {
+			s = &series{name: part.post.front.Series}
+			bySlug[slug] = s
+			slugs = append(slugs, slug)
+		}
+		s.parts = append(s.parts, part)
+	}
+	sort.Strings(slugs)
+	sorted := make([]series, 0, len(slugs))
+	for _, slug := range slugs {
+		s := bySlug[slug]
+		sort.SliceStable(s.parts, func(i, j int) bool {
+			pi, pj := s.parts[i].post, s.parts[j].post
+			if pi.front.Part != pj.front.Part {
+				return pi.front.Part < pj.front.Part
+			}
+			return pi.date().Before(pj.date())
+		})
+		sorted = append(sorted, *s)
+	}
+	return sorted
+}
+
+// rebasePart prepares the document of a part for the combined page: headings
+// move down a level, below the title of the series, heading IDs get the
+// prefix of the part so they stay unique across parts, and relative links are
+// rewritten for the URL of the combined page.  A part without a title heading
+// gets one.
+func rebasePart(part seriesPart, prefix, seriesURL string) {
+	doc := part.doc
+	children := doc.GetChildren()
+	if len(children) == 0 || !isTitleHeading(children[0]) {
+		title := &ast.Heading{Level: 1, HeadingID: slugify(part.post.title)}
+		ast.AppendChild(title, &ast.Text{Leaf: ast.Leaf{Literal: []byte(part.post.title)}})
+		title.SetParent(doc)
+		doc.SetChildren(append([]ast.Node{title}, children...))
+	}
+
+	relroot := relRootOf(seriesURL)
+	rebase := func(dest []byte) []byte {
+		link := string(dest)
+		switch {
+		case strings.HasPrefix(link, "#"):
+			return []byte("#" + prefix + link[1:])
+		case link == "" || isRemoteURL(link) || strings.HasPrefix(link, "//"):
+			return dest
+		}
+		return []byte(path.Join(relroot, siteRelativeURL(part.post.url, link)))
+	}
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if !entering {
+			return ast.GoToNext
+		}
+		switch node := node.(type) {
+		case *ast.Heading:
+			node.Level = min(node.Level+1, 6)
+			if node.HeadingID != "" {
+				node.HeadingID = prefix + node.HeadingID
+			}
+		case *ast.Link:
+			node.Destination = rebase(node.Destination)
+		case *ast.Image:
+			node.Destination = rebase(node.Destination)
+		}
+		return ast.GoToNext
+	})
+}
+
+// seriesNav is the position of a post in its series, for the navigation
+// between the parts of the series.
+type seriesNav struct {
+	Name string
+	// URL is the URL of the combined page of the series relative to the
+	// site root.
+	URL string
+	// Part is the position of the post in the series, starting at 1.
+	Part int
+	// Parts lists the parts of the series in order, with URLs relative to
+	// the site root.
+	Parts []pageLink
+}
+
+// collectSeriesNav returns the navigation of each part of a series by URL,
+// so each part can link to the parts after it.
+func collectSeriesNav(posts postSet) map[string]seriesNav {
+	var parts []seriesPart
+	for _, p := range posts {
+		if p.front.Series != "" {
+			parts = append(parts, seriesPart{post: p})
+		}
+	}
+	navs := map[string]seriesNav{}
+	for _, s := range collectSeries(parts) {
+		links := make([]pageLink, len(s.parts))
+		for idx, part := range s.parts {
+			links[idx] = pageLink{Title: part.post.title, URL: part.post.url}
+		}
+		for idx, part := range s.parts {
+			navs[part.post.url] = seriesNav{Name: s.name, URL: s.url(), Part: idx + 1, Parts: links}
+		}
+	}
+	return navs
+}
+
+// addSeriesNav adds the position of the post in its series and the list of
+// the parts of the series below the title of the post.
+func addSeriesNav(doc ast.Node, nav seriesNav, pageURL string, conf siteConfig) {
+	relroot := relRootOf(pageURL)
+	navmd := fmt.Sprintf("Part %d of %d in the series [%s](%s)\n\n", nav.Part, len(nav.Parts), nav.Name, conf.pageLink(relroot, nav.URL))
+	for idx, part := range nav.Parts {
+		if idx+1 == nav.Part {
+			navmd += fmt.Sprintf("%d. **%s**\n", idx+1, part.Title)
+		} else {
+			navmd += fmt.Sprintf("%d. [%s](%s)\n", idx+1, part.Title, conf.pageLink(relroot, part.URL))
+		}
+	}
+	open := &ast.HTMLBlock{Leaf: ast.Leaf{Literal: []byte(`<nav class="series-nav">`)}}
+	end := &ast.HTMLBlock{Leaf: ast.Leaf{Literal: []byte(`</nav>`)}}
+	nodes := append([]ast.Node{open}, parseMD([]byte(navmd)).GetChildren()...)
+	nodes = append(nodes, end)
+
+	children := doc.GetChildren()
+	pos := 0
+	if len(children) > 0 && isTitleHeading(children[0]) {
+		pos = 1
+	}
+	updated := make([]ast.Node, 0, len(children)+len(nodes))
+	updated = append(updated, children[:pos]...)
+	updated = append(updated, nodes...)
+	updated = append(updated, children[pos:]...)
+	doc.SetChildren(updated)
+	for _, node := range nodes {
+		node.SetParent(doc)
+	}
+}
+
+func isTitleHeading(node ast.Node) bool {
+	heading, ok := node.(*ast.Heading)
+	return ok && heading.Level == 1
+}
+
+// seriesTOCEntry is a heading of the merged table of contents of a series:
+// the title of a part, with its sections.
+type seriesTOCEntry struct {
+	Title    string
+	ID       string
+	Sections []seriesTOCEntry
+}
+
+// partTOC returns the table of contents entry of a rendered part, from its
+// level 2 and 3 headings, which were the title and sections of the post.
+func partTOC(doc ast.Node) seriesTOCEntry {
+	var entry seriesTOCEntry
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		heading, ok := node.(*ast.Heading)
+		if !ok || !entering {
+			return ast.GoToNext
+		}
+		item := seriesTOCEntry{Title: childLiterals(heading), ID: heading.HeadingID}
+		switch {
+		case heading.Level == 2 && entry.Title == "":
+			entry = item
+		case heading.Level == 3:
+			entry.Sections = append(entry.Sections, item)
+		}
+		return ast.SkipChildren
+	})
+	return entry
+}
+
+type seriesPartData struct {
+	Body template.HTML
+	URL  string
+}
+
+type seriesData struct {
+	Name  string
+	TOC   []seriesTOCEntry
+	Parts []seriesPartData
+}
+
+const seriesHTML = `<h1>{{.Name}}</h1>
+<nav class="series-toc">
+<ol>
+{{- range .TOC}}
+<li><a href="#{{.ID}}">{{.Title}}</a>
+{{- if .Sections}}
+<ul>
+{{- range .Sections}}
+<li><a href="#{{.ID}}">{{.Title}}</a></li>
+{{- end}}
+</ul>
+{{- end}}
+</li>
+{{- end}}
+</ol>
+</nav>
+{{- range .Parts}}
+<article class="series-part">
+{{.Body}}
+<p class="series-part-link"><a href="{{.URL}}">Read this part on its own</a></p>
+</article>
+{{- end}}
+`
+
+var seriesTemplate = template.Must(template.New("series").Parse(seriesHTML))
+
+// renderSeriesPages generates, for each series, a combined page with all of
+// its parts in order under a merged table of contents and an RSS feed of its
+// parts, and an index page of the series.
+func renderSeriesPages(parts []seriesPart, data templateData, conf siteConfig) error {
+	if len(parts) == 0 {
+		return nil
+	}
+	all := collectSeries(parts)
+	fmt.Printf(":: Found %d series\n", len(all))
+	outdir := filepath.Join(conf.DestinationPath, seriesDir)
+	if err := os.MkdirAll(outdir, 0777); err != nil {
+		return fmt.Errorf("creating path %q: %w", outdir, err)
+	}
+	index := "# Series\n\n"
+	for _, s := range all {
+		seriesURL := s.url()
+		relroot := relRootOf(seriesURL)
+		sdata := seriesData{Name: s.name}
+		channel := rssChannel{
+			Title:       fmt.Sprintf("%s: %s", conf.SiteName, s.name),
+			Link:        conf.absoluteURL(seriesURL),
+			Description: fmt.Sprintf("The parts of the series %s", s.name),
+		}
+		for idx, part := range s.parts {
+			rebasePart(part, fmt.Sprintf("part-%d-", idx+1), seriesURL)
+			body := template.HTML(renderBody(part.doc, newPageRenderer(conf), conf))
+			// the renderer makes heading IDs unique, so the table of contents
+			// is collected after rendering
+			sdata.TOC = append(sdata.TOC, partTOC(part.doc))
+			sdata.Parts = append(sdata.Parts, seriesPartData{Body: body, URL: conf.pageLink(relroot, part.post.url)})
+
+			link := conf.absoluteURL(part.post.url)
+			item := rssItem{
+				Title:       part.post.title,
+				Link:        link,
+				Description: part.post.summary,
+				GUID:        rssGUID{IsPermaLink: conf.BaseURL != "", Value: link},
+			}
+			if date := part.post.date(); !date.IsZero() {
+				item.PubDate = rssTime(date)
+			}
+			channel.Items = append(channel.Items, item)
+		}
+
+		body := new(bytes.Buffer)
+		if err := seriesTemplate.Execute(body, sdata); err != nil {
+			return fmt.Errorf("rendering series %q: %w", s.name, err)
+		}
+		data.Body = template.HTML(body.String())
+		data.Page = frontMatter{Title: s.name}
+		data.RelRoot = relroot
+		data.Permalink = conf.absoluteURL(seriesURL)
+		outpath := filepath.Join(conf.DestinationPath, filepath.FromSlash(seriesURL))
+		fmt.Printf("   Saving series %q (%d part%s): %s\n", s.name, len(s.parts), plural(len(s.parts)), outpath)
+		htmlData, err := makeHTML(data, conf.PageTemplateFile, conf)
+		if err != nil {
+			return fmt.Errorf("making html for series page %q: %w", outpath, err)
+		}
+		if err := os.WriteFile(outpath, htmlData, 0666); err != nil {
+			return fmt.Errorf("writing series page %q: %w", outpath, err)
+		}
+		feedpath := strings.TrimSuffix(outpath, ".html") + ".xml"
+		if err := writeRSSFeed(channel, feedpath); err != nil {
+			return fmt.Errorf("writing series feed: %w", err)
+		}
+
+		n := len(s.parts)
+		index += fmt.Sprintf("## [%s](%s) {#%s}\n\n%d part%s\n\n", s.name, path.Base(seriesURL), slugify(s.name), n, plural(n))
+		for idx, part := range s.parts {
+			index += fmt.Sprintf("%d. [%s](%s)\n", idx+1, part.post.title, conf.pageLink(relroot, part.post.url))
+		}
+		index += "\n"
+	}
+
+	indexURL := path.Join(seriesDir, "index.html")
+	outpath := filepath.Join(conf.DestinationPath, filepath.FromSlash(indexURL))
+	fmt.Printf("   Saving series index: %s\n", outpath)
+	data.Body = template.HTML(renderBody(parseMD([]byte(index)), newPageRenderer(conf), conf))
+	data.Page = frontMatter{Title: "Series"}
+	data.RelRoot = relRootOf(indexURL)
+	data.Permalink = conf.absoluteURL(indexURL)
+	htmlData, err := makeHTML(data, conf.listTemplate(), conf)
+	if err != nil {
+		return fmt.Errorf("making html for series index %q: %w", outpath, err)
+	}
+	if err := os.WriteFile(outpath, htmlData, 0666); err != nil {
+		return fmt.Errorf("writing series index %q: %w", outpath, err)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// runServe builds the site and serves the destination over HTTP.  With
+// -watch, the site is rebuilt while it is being served and the pages open in
+// browsers reload after each rebuild.  With -share, the site is served to
+// others through a token-protected preview link.
+func runServe(args []string) error {
+	var opts buildOptions
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	opts.register(flags)
+	addr := flags.String("addr", "localhost", "address to listen on")
+	port := flags.Int("port", 8080, "port to listen on")
+	share := flags.Bool("share", false, "share a preview with others through a token-protected link, on all interfaces or through the Share.Tunnel command")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	addrSet := false
+	flags.Visit(func(f *flag.Flag) {
+		addrSet = addrSet || f.Name == "addr"
+	})
+
+	watch := opts.watch
+	opts.watch = false
+	// served sites are previews
+	opts.preview = true
+	start := time.Now()
+	if _, err := runBuild(opts); err != nil {
+		return err
+	}
+	conf, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	if *share && len(conf.Share.Tunnel) == 0 && !addrSet {
+		// others reach the preview directly
+		*addr = ""
+	}
+	listener, err := net.Listen("tcp", net.JoinHostPort(*addr, strconv.Itoa(*port)))
+	if err != nil {
+		return fmt.Errorf("serve: %w", err)
+	}
+	fmt.Printf(":: Serving %s at http://%s/\n", conf.DestinationPath, listener.Addr())
+	handler := http.FileServer(http.Dir(conf.DestinationPath))
+	if watch {
+		// pages reload in the browser after each rebuild
+		reloads := newReloadBroadcaster()
+		handler = liveReloadHandler(conf.DestinationPath, reloads)
+		metrics, err := startMetrics(opts.metricsAddr, start)
+		if err != nil {
+			return err
+		}
+		go func() {
+			if err := watchSite(conf, reloads.notify, metrics); err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			}
+		}()
+	}
+	if *share {
+		token, err := conf.Share.shareToken()
+		if err != nil {
+			return err
+		}
+		handler = shareHandler(token, handler)
+		localURL := fmt.Sprintf("http://localhost:%d", listener.Addr().(*net.TCPAddr).Port)
+		if len(conf.Share.Tunnel) > 0 {
+			tunnel, err := startTunnel(conf.Share.Tunnel, localURL)
+			if err != nil {
+				return err
+			}
+			defer tunnel.Process.Kill()
+			fmt.Printf(":: Sharing a preview through %s\n", conf.Share.Tunnel[0])
+			fmt.Printf("   Add /?token=%s to the tunnel URL to open the preview\n", token)
+		} else {
+			host, err := os.Hostname()
+			if err != nil {
+				host = "localhost"
+			}
+			fmt.Printf(":: Sharing a preview at http://%s:%d/?token=%s\n", host, listener.Addr().(*net.TCPAddr).Port, token)
+		}
+		fmt.Printf("   Open it yourself at %s/?token=%s\n", localURL, token)
+	}
+	server := &http.Server{Handler: handler}
+	if err := server.Serve(listener); err != nil {
+		return fmt.Errorf("serve: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// shareConfig configures the previews shared by serve -share.
+type shareConfig struct {
+	// Token is the secret of the preview links.  Empty generates a new
+	// token each time the server starts, so old links stop working.
+	Token string `mapstructure:"Token"`
+	// Tunnel is a command, with its arguments, that makes the server
+	// reachable from elsewhere, such as ["cloudflared", "tunnel", "--url",
+	// "{url}"].  {url} is replaced by the local URL of the server.  Without a
+	// tunnel, the server listens on all interfaces instead.
+	Tunnel []string `mapstructure:"Tunnel"`
+}
+
+// shareCookie holds the token of a browser that opened a preview link, so the
+// links between pages work without the token.
+const shareCookie = "statiko_preview"
+
+// shareToken returns the configured token, or a new random one.
+func (c shareConfig) shareToken() (string, error) {
+	if c.Token != "" {
+		return c.Token, nil
+	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generating preview token: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// shareHandler serves only the requests with the token, given either in the
+// token query parameter of a preview link or in the cookie set when a link
+// is opened.
+func shareHandler(token string, handler http.Handler) http.Handler {
+	valid := func(value string) bool {
+		return subtle.ConstantTimeCompare([]byte(value), []byte(token)) == 1
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if query := r.URL.Query(); query.Has("token") {
+			if !valid(query.Get("token")) {
+				http.Error(w, "invalid preview link", http.StatusForbidden)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{Name: shareCookie, Value: token, Path: "/", HttpOnly: true, SameSite: http.SameSiteLaxMode})
+			// drop the token from the address bar
+			query.Del("token")
+			target := *r.URL
+			target.RawQuery = query.Encode()
+			http.Redirect(w, r, target.RequestURI(), http.StatusSeeOther)
+			return
+		}
+		if cookie, err := r.Cookie(shareCookie); err != nil || !valid(cookie.Value) {
+			http.Error(w, "this preview needs a preview link", http.StatusForbidden)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// startTunnel runs the tunnel command for the server at localURL.  The
+// output of the command, which usually includes the public URL, goes to
+// the standard error.
+func startTunnel(tunnel []string, localURL string) (*exec.Cmd, error) {
+	args := make([]string, len(tunnel))
+	for idx, arg := range tunnel {
+		args[idx] = strings.ReplaceAll(arg, "{url}", localURL)
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("starting tunnel: %w", err)
+	}
+	return cmd, nil
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/gomarkdown/markdown"
+	"github.com/gomarkdown/markdown/html"
+)
+
+// shortcodeRe matches the opening tag of a shortcode, {{< name args >}}.
+// Paired shortcodes end with {{< /name >}}.
+var shortcodeRe = regexp.MustCompile(`{{<\s*([a-zA-Z][\w-]*)((?:\s+(?:[\w-]+=)?(?:"[^"]*"|[^\s">]+))*)\s*>}}`)
+
+// shortcodeArgRe matches the arguments of a shortcode: positional values and
+// key=value parameters, with values quoted if they contain spaces.
+var shortcodeArgRe = regexp.MustCompile(`(?:([\w-]+)=)?(?:"([^"]*)"|(\S+))`)
+
+// builtinShortcodes are the shortcodes with their own expansion, which
+// shortcode templates cannot replace.
+var builtinShortcodes = map[string]bool{"ref": true, "hotspots": true, "variant": true}
+
+// defaultShortcodes are the shortcode templates used when the shortcode
+// directory has no template of the same name.
+var defaultShortcodes = map[string]string{
+	"youtube": `<div class="video youtube">
+<iframe src="https://www.youtube-nocookie.com/embed/{{index .Args 0}}" title="{{or (.Get "title") "YouTube video"}}" loading="lazy" allow="encrypted-media; picture-in-picture; fullscreen" allowfullscreen></iframe>
+</div>`,
+	"figure": `<figure{{with .Get "class"}} class="{{.}}"{{end}}>
+{{- if .Get "link"}}<a href="{{.Link "link"}}">{{end -}}
+<img src="{{.Link "src"}}" alt="{{or (.Get "alt") (.Get "caption")}}"{{with .Get "width"}} width="{{.}}"{{end}}{{with .Get "height"}} height="{{.}}"{{end}} loading="lazy">
+{{- if .Get "link"}}</a>{{end}}
+{{- with .Get "caption"}}
+<figcaption>{{.}}</figcaption>
+{{- end}}
+</figure>`,
+}
+
+// shortcodeData is the data of shortcode templates.
+type shortcodeData struct {
+	Name string
+	// Args are the positional arguments and Params the key=value ones.
+	Args   []string
+	Params map[string]string
+	// Inner is the content between the tags of a paired shortcode, rendered
+	// from markdown.
+	Inner template.HTML
+	// RelRoot is the relative path from the page to the site root.
+	RelRoot string
+	// rebase rebases links relative to the page source for the page.
+	rebase func(link string) string
+}
+
+// Get returns a key=value parameter, or the positional argument of an index.
+func (d shortcodeData) Get(key any) string {
+	switch key := key.(type) {
+	case string:
+		return d.Params[key]
+	case int:
+		if key >= 0 && key < len(d.Args) {
+			return d.Args[key]
+		}
+	}
+	return ""
+}
+
+// Link returns a parameter or argument, like Get, holding a link relative to
+// the page source, as a link relative to the page.  They differ with
+// PrettyURLs.
+func (d shortcodeData) Link(key any) string {
+	link := d.Get(key)
+	if d.rebase == nil {
+		return link
+	}
+	return d.rebase(link)
+}
+
+// shortcodeSet holds the shortcode templates by name.
+type shortcodeSet struct {
+	templates map[string]*template.Template
+	// sandboxed lists the templates of the shortcode directory, which run in
+	// the template sandbox if it is enabled.  The default templates do not.
+	sandboxed map[string]bool
+	sandbox   sandboxConfig
+}
+
+// loadShortcodes parses the default shortcode templates and the .html files
+// in the shortcode directory, which are named after their file names.
+func loadShortcodes(conf siteConfig) (shortcodeSet, error) {
+	set := shortcodeSet{
+		templates: map[string]*template.Template{},
+		sandboxed: map[string]bool{},
+		sandbox:   conf.Sandbox,
+	}
+	for name, text := range defaultShortcodes {
+		set.templates[name] = template.Must(template.New(name).Parse(text))
+	}
+	if conf.ShortcodePath == "" {
+		return set, nil
+	}
+	entries, err := os.ReadDir(conf.ShortcodePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return set, nil
+	}
+	if err != nil {
+		return shortcodeSet{}, fmt.Errorf("loading shortcodes: %w", err)
+	}
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".html")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		if builtinShortcodes[name] {
+			return shortcodeSet{}, fmt.Errorf("loading shortcodes: %q replaces the built-in %s shortcode", entry.Name(), name)
+		}
+		fname := filepath.Join(conf.ShortcodePath, entry.Name())
+		content, err := os.ReadFile(fname)
+		if err != nil {
+			return shortcodeSet{}, fmt.Errorf("loading shortcodes: %w", err)
+		}
+		tmpl, err := template.New(name).Parse(string(content))
+		if err != nil {
+			return shortcodeSet{}, fmt.Errorf("loading shortcodes: %w", err)
+		}
+		if conf.Sandbox.Enabled {
+			if err := conf.Sandbox.checkTemplates([]string{fname}); err != nil {
+				return shortcodeSet{}, fmt.Errorf("loading shortcodes: %w", err)
+			}
+			set.sandboxed[name] = true
+		}
+		set.templates[name] = tmpl
+	}
+	return set, nil
+}
+
+// parseShortcodeArgs splits the arguments of a shortcode into positional
+// arguments and parameters.
+func parseShortcodeArgs(args string) ([]string, map[string]string) {
+	var positional []string
+	params := map[string]string{}
+	for _, arg := range shortcodeArgRe.FindAllStringSubmatch(args, -1) {
+		value := arg[2] + arg[3]
+		if arg[1] != "" {
+			params[arg[1]] = value
+		} else {
+			positional = append(positional, value)
+		}
+	}
+	return positional, params
+}
+
+// onOwnLine reports whether md[start:end] is alone on its line.
+func onOwnLine(md []byte, start, end int) bool {
+	before := md[:start]
+	if nl := bytes.LastIndexByte(before, '\n'); nl >= 0 {
+		before = before[nl+1:]
+	}
+	after := md[end:]
+	if nl := bytes.IndexByte(after, '\n'); nl >= 0 {
+		after = after[:nl]
+	}
+	return len(bytes.TrimSpace(before)) == 0 && len(bytes.TrimSpace(after)) == 0
+}
+
+// expand replaces the shortcodes in the markdown source of a page with their
+// templates.  Shortcodes on lines of their own become blocks of raw HTML,
+// others inline HTML.  The built-in shortcodes, and shortcodes in fenced code
+// blocks and code spans, are left unchanged.
+func (set shortcodeSet) expand(md []byte, fname, pageURL string, idx pageIndex, conf siteConfig) ([]byte, error) {
+	var out bytes.Buffer
+	var errs []string
+	ranges := codeRanges(md)
+	cursor := 0
+	for {
+		loc := shortcodeRe.FindSubmatchIndex(md[cursor:])
+		if loc == nil {
+			break
+		}
+		start, end := cursor+loc[0], cursor+loc[1]
+		name := string(md[cursor+loc[2] : cursor+loc[3]])
+		if builtinShortcodes[name] || inCode(ranges, start, end) {
+			out.Write(md[cursor:end])
+			cursor = end
+			continue
+		}
+		data := shortcodeData{Name: name, RelRoot: relRootOf(pageURL), rebase: func(link string) string {
+			return idx.rebaseLink(link, pageURL, conf)
+		}}
+		data.Args, data.Params = parseShortcodeArgs(string(md[cursor+loc[4] : cursor+loc[5]]))
+		var inner []byte
+		closeRe := regexp.MustCompile(`{{<\s*/` + regexp.QuoteMeta(name) + `\s*>}}`)
+		for _, closing := range closeRe.FindAllIndex(md[end:], -1) {
+			if !inCode(ranges, end+closing[0], end+closing[1]) {
+				inner = md[end : end+closing[0]]
+				end += closing[1]
+				break
+			}
+		}
+		block := onOwnLine(md, start, end)
+		if inner != nil {
+			renderer := html.NewRenderer(html.RendererOptions{})
+			rendered := string(bytes.TrimSpace(markdown.Render(parseMD(inner), renderer)))
+			if !block && strings.Count(rendered, "<p>") == 1 {
+				// the content of inline shortcodes is not a paragraph
+				rendered = strings.TrimSuffix(strings.TrimPrefix(rendered, "<p>"), "</p>")
+			}
+			data.Inner = template.HTML(rendered)
+		}
+		out.Write(md[cursor:start])
+		cursor = end
+		tmpl, ok := set.templates[name]
+		if !ok {
+			errs = append(errs, fmt.Sprintf("unknown shortcode %q", name))
+			continue
+		}
+		var expanded bytes.Buffer
+		var w io.Writer = &expanded
+		if set.sandboxed[name] {
+			w = &limitedWriter{w: &expanded, n: int64(set.sandbox.MaxOutput) << 10}
+		}
+		if err := tmpl.Execute(w, data); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		if set.sandboxed[name] {
+			if err := set.sandbox.checkOutput(name, expanded.Bytes(), data); err != nil {
+				errs = append(errs, err.Error())
+				continue
+			}
+		}
+		if block {
+			// blank lines keep the output a block of raw HTML
+			out.WriteString("\n" + strings.TrimSpace(expanded.String()) + "\n")
+		} else {
+			out.WriteString(strings.TrimSpace(expanded.String()))
+		}
+	}
+	out.Write(md[cursor:])
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("expanding shortcodes in %q: %s", fname, strings.Join(errs, "; "))
+	}
+	return out.Bytes(), nil
+}
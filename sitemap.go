@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Sitemap document types.
+
+type sitemapURL struct {
+	Loc string `xml:"loc"`
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+// sitemapPages returns the URLs, relative to the site root, of the pages in
+// the destination that belong in the sitemap.  With the "first" pagination
+// rule, the pages of listings after the first are left out.
+func sitemapPages(conf siteConfig) ([]string, error) {
+	files, err := outputFiles(conf.DestinationPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	var pages []string
+	for rel := range files {
+		if !strings.EqualFold(filepath.Ext(rel), ".html") {
+			continue
+		}
+		if conf.Pagination.Sitemap == sitemapFirstPage && paginatedPageRe.MatchString(rel) {
+			continue
+		}
+		pages = append(pages, rel)
+	}
+	sort.Strings(pages)
+	return pages, nil
+}
+
+// writeSitemap writes the sitemap of the pages in the destination.
+func writeSitemap(conf siteConfig) error {
+	if conf.SitemapOutput == "" {
+		return nil
+	}
+	pages, err := sitemapPages(conf)
+	if err != nil {
+		return fmt.Errorf("writing sitemap: %w", err)
+	}
+	urlset := sitemapURLSet{}
+	for _, page := range pages {
+		urlset.URLs = append(urlset.URLs, sitemapURL{Loc: conf.absoluteURL(page)})
+	}
+	out, err := xml.MarshalIndent(urlset, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding sitemap: %w", err)
+	}
+	out = append([]byte(xml.Header), out...)
+	outpath := filepath.Join(conf.DestinationPath, conf.SitemapOutput)
+	fmt.Printf(":: Writing sitemap %s (%d page%s)\n", outpath, len(pages), plural(len(pages)))
+	if err := os.WriteFile(outpath, out, 0666); err != nil {
+		return fmt.Errorf("writing sitemap %q: %w", outpath, err)
+	}
+	return nil
+}
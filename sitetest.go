@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// siteTestConfig configures the comparison of the built site with its
+// expected output by `statiko test`.
+type siteTestConfig struct {
+	// Expected is the directory holding the expected output of the build.
+	Expected string `mapstructure:"Expected"`
+	// Normalize rules are applied to the text files of both outputs before
+	// they are compared, to mask content that changes between builds, such
+	// as timestamps.
+	Normalize []normalizeRule `mapstructure:"Normalize"`
+	// Ignore lists glob patterns, matched against paths relative to the
+	// output root, of files that are not compared.
+	Ignore []string `mapstructure:"Ignore"`
+}
+
+// normalizeRule replaces the matches of Pattern with Replace, which may refer
+// to submatches as in regexp.Expand.
+type normalizeRule struct {
+	Pattern string `mapstructure:"Pattern"`
+	Replace string `mapstructure:"Replace"`
+}
+
+type compiledNormalizeRule struct {
+	re      *regexp.Regexp
+	replace []byte
+}
+
+func compileNormalizeRules(rules []normalizeRule) ([]compiledNormalizeRule, error) {
+	compiled := make([]compiledNormalizeRule, len(rules))
+	for idx, rule := range rules {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("compiling Test.Normalize[%d] pattern: %w", idx, err)
+		}
+		compiled[idx] = compiledNormalizeRule{re: re, replace: []byte(rule.Replace)}
+	}
+	return compiled, nil
+}
+
+// normalize applies the rules to text content and unifies line endings.
+// Binary content is returned unchanged.
+func normalize(content []byte, rules []compiledNormalizeRule) []byte {
+	if !utf8.Valid(content) {
+		return content
+	}
+	content = bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+	for _, rule := range rules {
+		content = rule.re.ReplaceAll(content, rule.replace)
+	}
+	return content
+}
+
+// outputFiles returns the paths of the files under root, relative to it,
+// except the ones matching an ignore pattern.
+func outputFiles(root string, ignore []string) (map[string]bool, error) {
+	files := map[string]bool{}
+	walker := func(loc string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, loc)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		for _, pattern := range ignore {
+			if matched, _ := filepath.Match(pattern, rel); matched {
+				return nil
+			}
+		}
+		files[rel] = true
+		return nil
+	}
+	if err := filepath.Walk(root, walker); err != nil {
+		return nil, fmt.Errorf("listing output %q: %w", root, err)
+	}
+	return files, nil
+}
+
+// firstDifference returns the number and contents of the first line that
+// differs between two texts.
+func firstDifference(expected, got []byte) (int, string, string) {
+	elines := strings.Split(string(expected), "\n")
+	glines := strings.Split(string(got), "\n")
+	for idx := 0; ; idx++ {
+		var eline, gline string
+		if idx < len(elines) {
+			eline = elines[idx]
+		}
+		if idx < len(glines) {
+			gline = glines[idx]
+		}
+		if idx >= len(elines) || idx >= len(glines) || eline != gline {
+			return idx + 1, eline, gline
+		}
+	}
+}
+
+// compareOutput prints the differences between the expected output and the
+// output of a build and returns their number.
+func compareOutput(expected, got string, conf siteTestConfig) (int, error) {
+	rules, err := compileNormalizeRules(conf.Normalize)
+	if err != nil {
+		return 0, err
+	}
+	efiles, err := outputFiles(expected, conf.Ignore)
+	if err != nil {
+		return 0, err
+	}
+	gfiles, err := outputFiles(got, conf.Ignore)
+	if err != nil {
+		return 0, err
+	}
+	all := make([]string, 0, len(efiles))
+	for rel := range efiles {
+		all = append(all, rel)
+	}
+	for rel := range gfiles {
+		if !efiles[rel] {
+			all = append(all, rel)
+		}
+	}
+	sort.Strings(all)
+
+	ndiffs := 0
+	for _, rel := range all {
+		switch {
+		case !gfiles[rel]:
+			fmt.Printf("   missing: %s\n", rel)
+			ndiffs++
+			continue
+		case !efiles[rel]:
+			fmt.Printf("   unexpected: %s\n", rel)
+			ndiffs++
+			continue
+		}
+		econtent, err := os.ReadFile(filepath.Join(expected, filepath.FromSlash(rel)))
+		if err != nil {
+			return 0, fmt.Errorf("reading expected output: %w", err)
+		}
+		gcontent, err := os.ReadFile(filepath.Join(got, filepath.FromSlash(rel)))
+		if err != nil {
+			return 0, fmt.Errorf("reading build output: %w", err)
+		}
+		econtent, gcontent = normalize(econtent, rules), normalize(gcontent, rules)
+		if bytes.Equal(econtent, gcontent) {
+			continue
+		}
+		ndiffs++
+		if !utf8.Valid(econtent) || !utf8.Valid(gcontent) {
+			fmt.Printf("   changed: %s (binary)\n", rel)
+			continue
+		}
+		line, eline, gline := firstDifference(econtent, gcontent)
+		fmt.Printf("   changed: %s (line %d)\n", rel, line)
+		fmt.Printf("     - %s\n", eline)
+		fmt.Printf("     + %s\n", gline)
+	}
+	return ndiffs, nil
+}
+
+// copyTree replaces the contents of dst with a copy of src.
+func copyTree(src, dst string) error {
+	if err := os.RemoveAll(dst); err != nil {
+		return fmt.Errorf("removing %q: %w", dst, err)
+	}
+	walker := func(loc string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, loc)
+		if err != nil {
+			return err
+		}
+		dstloc := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(dstloc, 0777)
+		}
+		return copyFile(loc, dstloc)
+	}
+	if err := filepath.Walk(src, walker); err != nil {
+		return fmt.Errorf("copying %q to %q: %w", src, dst, err)
+	}
+	return nil
+}
+
+// runSiteTest builds the site into a temporary directory and compares it
+// with the expected output, or replaces the expected output with it.
+func runSiteTest(args []string) error {
+	flags := flag.NewFlagSet("test", flag.ExitOnError)
+	expected := flags.String("expected", "", "directory with the expected output (default: Test.Expected from the config)")
+	update := flags.Bool("update", false, "replace the expected output with the output of the build")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	conf, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if *expected == "" {
+		*expected = conf.Test.Expected
+	} else {
+		*expected = argPath(*expected)
+	}
+
+	ws, err := openWorkspace(conf)
+	if err != nil {
+		return err
+	}
+	defer ws.close()
+	tmpdir, err := ws.mkdirTemp("test-")
+	if err != nil {
+		return fmt.Errorf("creating build directory: %w", err)
+	}
+	conf.DestinationPath = filepath.Join(tmpdir, "html")
+	// outputs outside the destination are not part of the test
+	conf.FragmentPath = ""
+	conf.DebugTemplates = false
+	conf.Dashboard.Enabled = false
+	// the build cache describes the real destination
+	conf.Incremental = false
+	if err := buildSite(&conf); err != nil {
+		return err
+	}
+
+	if *update {
+		fmt.Printf(":: Updating expected output %s\n", *expected)
+		return copyTree(conf.DestinationPath, *expected)
+	}
+	if _, err := os.Stat(*expected); err != nil {
+		return fmt.Errorf("test: reading expected output: %w (create it with -update)", err)
+	}
+	fmt.Printf(":: Comparing the build with %s\n", *expected)
+	ndiffs, err := compareOutput(*expected, conf.DestinationPath, conf.Test)
+	if err != nil {
+		return err
+	}
+	if ndiffs > 0 {
+		return fmt.Errorf("test: %d difference%s from the expected output", ndiffs, plural(ndiffs))
+	}
+	fmt.Println(":: Output matches")
+	return nil
+}
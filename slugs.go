@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// pageSlug returns the slug of the front matter of a source file, which
+// replaces its file name in its output path.  Sources that cannot be read or
+// parsed, and invalid slugs, have no slug here; they are reported by
+// checkOutputPaths and when the page is rendered.
+func pageSlug(fname string) string {
+	md, _, err := readSource(fname)
+	if err != nil {
+		return ""
+	}
+	front, _, err := parseFrontMatter(md)
+	if err != nil || validateSlug(front.Slug) != nil {
+		return ""
+	}
+	return front.Slug
+}
+
+// validateSlug checks that a slug is a plain name, so that the page stays in
+// the directory of its source.
+func validateSlug(slug string) error {
+	if strings.ContainsAny(slug, `/\`) || slug == "." || slug == ".." {
+		return fmt.Errorf("slug %q must be a name without a directory", slug)
+	}
+	return nil
+}
+
+// checkOutputPaths reports invalid slugs and pages that would be written to
+// the same output file, which would silently overwrite each other.
+func checkOutputPaths(pagesmd []string, conf siteConfig) error {
+	sources := map[string][]string{}
+	for _, fname := range pagesmd {
+		md, _, err := readSource(fname)
+		if err != nil {
+			return err
+		}
+		if front, _, err := parseFrontMatter(md); err == nil {
+			if err := validateSlug(front.Slug); err != nil {
+				return fmt.Errorf("%s: %w", fname, err)
+			}
+		}
+		outpath := outputPath(fname, conf)
+		sources[outpath] = append(sources[outpath], fname)
+	}
+	var collisions []string
+	for outpath, fnames := range sources {
+		if len(fnames) > 1 {
+			collisions = append(collisions, fmt.Sprintf("%s (%s)", outpath, strings.Join(fnames, ", ")))
+		}
+	}
+	if len(collisions) > 0 {
+		sort.Strings(collisions)
+		return fmt.Errorf("pages with the same output file: %s", strings.Join(collisions, "; "))
+	}
+	return nil
+}
+
+// slugOutputName returns the name, without extension, of the output file of a
+// source file: its slug, or else its file name.
+func slugOutputName(fname string) string {
+	if slug := pageSlug(fname); slug != "" {
+		return slug
+	}
+	base := filepath.Base(fname)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// snapshotTimeFormat is the format of the names of snapshots, the UTC time of
+// the snapshot like in Wayback Machine URLs.
+const snapshotTimeFormat = "20060102150405"
+
+// snapshotNameRe matches the directory names of snapshots.
+var snapshotNameRe = regexp.MustCompile(`^[0-9]{14}$`)
+
+// validateSnapshotPath fails if the snapshots and the destination of the site
+// or of an audience contain each other.  Snapshots in the destination would
+// be copied into later snapshots and removed by clean -orphans, and a
+// destination in the snapshots would be listed as a snapshot.
+func validateSnapshotPath(conf siteConfig) error {
+	snapshots := absPath(conf.SnapshotPath)
+	dests := []string{conf.DestinationPath}
+	for _, audience := range conf.Audiences {
+		dests = append(dests, audience.DestinationPath)
+	}
+	for _, dest := range dests {
+		if abs := absPath(dest); isUnder(snapshots, abs) || isUnder(abs, snapshots) {
+			return fmt.Errorf("snapshot path %q and destination %q must not contain each other", conf.SnapshotPath, dest)
+		}
+	}
+	return nil
+}
+
+// listSnapshots returns the names of the snapshots in dir, oldest first.
+func listSnapshots(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("listing snapshots in %q: %w", dir, err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() && snapshotNameRe.MatchString(entry.Name()) {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// sameContent reports whether two files have the same contents.
+func sameContent(a, b string) bool {
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	if errA != nil || errB != nil || infoA.Size() != infoB.Size() {
+		return false
+	}
+	fpA, errA := os.Open(a)
+	if errA != nil {
+		return false
+	}
+	defer fpA.Close()
+	fpB, errB := os.Open(b)
+	if errB != nil {
+		return false
+	}
+	defer fpB.Close()
+	return sameReaderContent(fpA, fpB)
+}
+
+// snapshotSite copies the tree under src to dst.  Files that are unchanged
+// since the previous snapshot prev are hard links to its copies, so each
+// snapshot only takes the space of the files that changed.  It returns the
+// numbers of linked and copied files.
+func snapshotSite(src, dst, prev string) (int, int, error) {
+	var linked, copied int
+	walker := func(loc string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, loc)
+		if err != nil {
+			return err
+		}
+		dstloc := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(dstloc, 0777)
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		if prev != "" {
+			prevloc := filepath.Join(prev, rel)
+			// linking fails across file systems, where the file is copied
+			if sameContent(loc, prevloc) && os.Link(prevloc, dstloc) == nil {
+				linked++
+				return nil
+			}
+		}
+		copied++
+		return copyFile(loc, dstloc)
+	}
+	if err := filepath.Walk(src, walker); err != nil {
+		return linked, copied, fmt.Errorf("copying %q to %q: %w", src, dst, err)
+	}
+	return linked, copied, nil
+}
+
+type snapshotEntry struct {
+	Name  string
+	Time  time.Time
+	Files int
+}
+
+const snapshotsHTML = `<h1>Snapshots</h1>
+<p>{{len .}} snapshot{{if ne (len .) 1}}s{{end}} of the site.</p>
+<ul class="snapshots">
+{{- range .}}
+<li><a href="{{.Name}}/"><time datetime="{{.Time.Format "2006-01-02T15:04:05Z07:00"}}">{{.Time.Format "2006-01-02 15:04 MST"}}</time></a> ({{.Files}} file{{if ne .Files 1}}s{{end}})</li>
+{{- end}}
+</ul>
+`
+
+var snapshotsTemplate = template.Must(template.New("snapshots").Parse(snapshotsHTML))
+
+// writeSnapshotIndex writes the index page of the snapshots in dir, newest
+// first, with the page template of the site.
+func writeSnapshotIndex(dir string, conf siteConfig) error {
+	names, err := listSnapshots(dir)
+	if err != nil {
+		return err
+	}
+	entries := make([]snapshotEntry, 0, len(names))
+	for idx := len(names) - 1; idx >= 0; idx-- {
+		taken, err := time.Parse(snapshotTimeFormat, names[idx])
+		if err != nil {
+			return fmt.Errorf("reading snapshot %q: %w", names[idx], err)
+		}
+		files, err := outputFiles(filepath.Join(dir, names[idx]), nil)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, snapshotEntry{Name: names[idx], Time: taken, Files: len(files)})
+	}
+
+	body := new(bytes.Buffer)
+	if err := snapshotsTemplate.Execute(body, entries); err != nil {
+		return fmt.Errorf("rendering snapshot index: %w", err)
+	}
+	data := newTemplateData(conf)
+	data.Body = template.HTML(body.String())
+	data.Page = frontMatter{Title: "Snapshots"}
+	// the page links to the resources of the site like its pages do
+	data.RelRoot, _ = filepath.Rel(absPath(dir), absPath(conf.DestinationPath))
+	data.RelRoot = filepath.ToSlash(data.RelRoot)
+	page, err := makeHTML(data, conf.PageTemplateFile, conf)
+	if err != nil {
+		return fmt.Errorf("rendering snapshot index: %w", err)
+	}
+	outpath := filepath.Join(dir, "index.html")
+	fmt.Printf(":: Writing snapshot index %s (%d snapshot%s)\n", outpath, len(entries), plural(len(entries)))
+	if err := os.WriteFile(outpath, page, 0666); err != nil {
+		return fmt.Errorf("writing snapshot index %q: %w", outpath, err)
+	}
+	return nil
+}
+
+// runSnapshot copies the current build into a new snapshot named after the
+// time, and updates the index of the snapshots.
+func runSnapshot(args []string) error {
+	flags := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	wait := flags.Bool("wait", false, "wait for a running build to finish instead of failing")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	conf, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	// the snapshot is of a complete build
+	lock, err := lockDestination(conf, *wait)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+	if info, err := os.Stat(conf.DestinationPath); err != nil || !info.IsDir() {
+		return fmt.Errorf("snapshot: no destination %q; build the site first", conf.DestinationPath)
+	}
+	dir := conf.SnapshotPath
+	names, err := listSnapshots(dir)
+	if err != nil {
+		return err
+	}
+	var prev string
+	if len(names) > 0 {
+		prev = filepath.Join(dir, names[len(names)-1])
+	}
+	name := time.Now().UTC().Format(snapshotTimeFormat)
+	if len(names) > 0 && names[len(names)-1] == name {
+		return fmt.Errorf("snapshot: snapshot %q already exists", name)
+	}
+	dst := filepath.Join(dir, name)
+	fmt.Printf(":: Saving snapshot %s\n", dst)
+	linked, copied, err := snapshotSite(conf.DestinationPath, dst, prev)
+	if err != nil {
+		return fmt.Errorf("snapshot: %w", err)
+	}
+	fmt.Printf("   %d file%s copied, %d unchanged file%s linked\n", copied, plural(copied), linked, plural(linked))
+	return writeSnapshotIndex(dir, conf)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// staleNoticeConfig configures the notice added to old posts, since outdated
+// technical posts mislead readers.
+type staleNoticeConfig struct {
+	// Years is the age, since the post was posted or last edited, of posts
+	// that get the notice.  Zero disables the notice.
+	Years int `mapstructure:"Years"`
+	// Text is the markdown of the notice.  {years} is replaced with Years.
+	Text string `mapstructure:"Text"`
+}
+
+// lastUpdate returns the latest of the posted and edited dates of a post, or
+// the zero time if it has none.
+func (p post) lastUpdate() time.Time {
+	updated := p.date()
+	if p.metadata != nil {
+		for _, edited := range p.metadata.DatesEdited {
+			if edited.After(updated) {
+				updated = edited
+			}
+		}
+	}
+	return updated
+}
+
+// staleNotice returns the text of the notice for a post, or an empty string
+// if the post is recent, undated, or marked as evergreen.
+func staleNotice(p post, conf staleNoticeConfig, now time.Time) string {
+	updated := p.lastUpdate()
+	if conf.Years <= 0 || p.front.Evergreen || updated.IsZero() {
+		return ""
+	}
+	if updated.After(now.AddDate(-conf.Years, 0, 0)) {
+		return ""
+	}
+	return strings.ReplaceAll(conf.Text, "{years}", strconv.Itoa(conf.Years))
+}
+
+// addStaleNotice inserts the notice, in an aside with the stale-notice class,
+// after the title heading of a post, or at its start if it has none.
+func addStaleNotice(doc ast.Node, notice string) {
+	open := &ast.HTMLBlock{Leaf: ast.Leaf{Literal: []byte(`<aside class="stale-notice">`)}}
+	end := &ast.HTMLBlock{Leaf: ast.Leaf{Literal: []byte(`</aside>`)}}
+	nodes := append([]ast.Node{open}, parseMD([]byte(notice)).GetChildren()...)
+	nodes = append(nodes, end)
+
+	children := doc.GetChildren()
+	pos := 0
+	if len(children) > 0 {
+		if heading, ok := children[0].(*ast.Heading); ok && heading.Level == 1 {
+			pos = 1
+		}
+	}
+	updated := make([]ast.Node, 0, len(children)+len(nodes))
+	updated = append(updated, children[:pos]...)
+	updated = append(updated, nodes...)
+	updated = append(updated, children[pos:]...)
+	doc.SetChildren(updated)
+	for _, node := range nodes {
+		node.SetParent(doc)
+	}
+}
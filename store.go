@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Build state storage backends.
+const (
+	storageFile     = "file"
+	storageS3       = "s3"
+	storageGitNotes = "git-notes"
+)
+
+// storageConfig selects where build state, such as the manifest of the
+// output, is kept between builds.  Remote backends let stateless CI runners
+// keep state between runs.
+type storageConfig struct {
+	// Backend is "file", "s3", or "git-notes".  Empty disables the storage.
+	Backend string `mapstructure:"Backend"`
+	// Location is the directory of the file backend (default .statiko), the
+	// s3://bucket/prefix URL of the s3 backend, or the notes ref of the
+	// git-notes backend (default refs/notes/statiko).
+	Location string `mapstructure:"Location"`
+}
+
+func (c storageConfig) validate() error {
+	switch c.Backend {
+	case "", storageFile, storageGitNotes:
+		return nil
+	case storageS3:
+		if !strings.HasPrefix(c.Location, "s3://") {
+			return fmt.Errorf("storage location %q must be an s3:// URL", c.Location)
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid storage backend %q (must be %q, %q, or %q)", c.Backend, storageFile, storageS3, storageGitNotes)
+}
+
+// buildStore keeps named objects between builds.
+type buildStore interface {
+	// Load returns the stored object, or nil if there is none.
+	Load(name string) ([]byte, error)
+	Save(name string, data []byte) error
+}
+
+// newBuildStore returns the configured store, or nil if storage is disabled.
+func newBuildStore(c storageConfig) buildStore {
+	switch c.Backend {
+	case storageFile:
+		if c.Location == "" {
+			return fileStore(".statiko")
+		}
+		return fileStore(c.Location)
+	case storageS3:
+		return s3Store(strings.TrimSuffix(c.Location, "/"))
+	case storageGitNotes:
+		if c.Location == "" {
+			return gitNotesStore("refs/notes/statiko")
+		}
+		return gitNotesStore(c.Location)
+	}
+	return nil
+}
+
+// fileStore keeps objects as files in a local directory.
+type fileStore string
+
+func (fs fileStore) Load(name string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(string(fs), name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loading %q: %w", name, err)
+	}
+	return data, nil
+}
+
+func (fs fileStore) Save(name string, data []byte) error {
+	if err := os.MkdirAll(string(fs), 0777); err != nil {
+		return fmt.Errorf("creating path %q: %w", string(fs), err)
+	}
+	if err := os.WriteFile(filepath.Join(string(fs), name), data, 0666); err != nil {
+		return fmt.Errorf("saving %q: %w", name, err)
+	}
+	return nil
+}
+
+// runCommand runs a command with input on its standard input and returns its
+// output.  The error includes the standard error of the command.
+func runCommand(input []byte, name string, args ...string) ([]byte, error) {
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = bytes.NewReader(input)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s: %w: %s", name, err, msg)
+		}
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return out, nil
+}
+
+// exitStatus returns the exit status of a command that failed with err, or
+// -1 if the command did not run to completion, e.g. because it is missing.
+func exitStatus(err error) int {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// s3Store keeps objects in an S3 bucket, under the prefix of an s3:// URL,
+// through the AWS command line client and its usual credentials.
+type s3Store string
+
+func (s3 s3Store) Load(name string) ([]byte, error) {
+	url := string(s3) + "/" + name
+	listing, err := runCommand(nil, "aws", "s3", "ls", url)
+	if err != nil && exitStatus(err) != 1 {
+		// ls exits with 1 when nothing matches, and with other statuses
+		// for failed requests, such as with expired credentials
+		return nil, fmt.Errorf("loading %q: %w", url, err)
+	}
+	found := false
+	for _, line := range strings.Split(string(listing), "\n") {
+		// ls lists all the objects whose names start with the name
+		found = found || strings.HasSuffix(strings.TrimSpace(line), " "+name)
+	}
+	if !found {
+		return nil, nil
+	}
+	data, err := runCommand(nil, "aws", "s3", "cp", url, "-")
+	if err != nil {
+		return nil, fmt.Errorf("loading %q: %w", url, err)
+	}
+	return data, nil
+}
+
+func (s3 s3Store) Save(name string, data []byte) error {
+	url := string(s3) + "/" + name
+	if _, err := runCommand(data, "aws", "s3", "cp", "-", url); err != nil {
+		return fmt.Errorf("saving %q: %w", url, err)
+	}
+	return nil
+}
+
+// gitNotesStore keeps objects as git notes under a notes ref of the
+// repository in the working directory, which CI runners can fetch and push
+// with the rest of the repository.  Each object is the note of a blob
+// derived from its name, so it does not depend on the commit being built.
+type gitNotesStore string
+
+// anchor returns the ID of the blob the note of an object is attached to,
+// writing the blob to the repository.
+func (gn gitNotesStore) anchor(name string) (string, error) {
+	out, err := runCommand([]byte("statiko build state: "+name+"\n"), "git", "hash-object", "-w", "--stdin")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (gn gitNotesStore) Load(name string) ([]byte, error) {
+	obj, err := gn.anchor(name)
+	if err != nil {
+		return nil, fmt.Errorf("loading %q: %w", name, err)
+	}
+	if _, err := runCommand(nil, "git", "notes", "--ref", string(gn), "list", obj); err != nil {
+		if exitStatus(err) == 1 {
+			// list exits with 1 when the object has no note
+			return nil, nil
+		}
+		return nil, fmt.Errorf("loading %q: %w", name, err)
+	}
+	data, err := runCommand(nil, "git", "notes", "--ref", string(gn), "show", obj)
+	if err != nil {
+		return nil, fmt.Errorf("loading %q: %w", name, err)
+	}
+	return data, nil
+}
+
+func (gn gitNotesStore) Save(name string, data []byte) error {
+	obj, err := gn.anchor(name)
+	if err != nil {
+		return fmt.Errorf("saving %q: %w", name, err)
+	}
+	// notes are commits on the notes ref, which need an identity that CI
+	// runners often lack
+	if _, err := runCommand(data, "git", "-c", "user.name=statiko", "-c", "user.email=statiko@localhost", "notes", "--ref", string(gn), "add", "-f", "-F", "-", obj); err != nil {
+		return fmt.Errorf("saving %q: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/gomarkdown/markdown/parser"
+)
+
+// taxonomy is a classification of posts, such as tags, with a listing page
+// for each of its terms and an overview page of all terms.
+type taxonomy struct {
+	// dir is the directory of the term listing pages in the destination.
+	// The overview page is dir.html.
+	dir string
+	// term is the name of a single term, e.g. "tag"; dir names many.
+	term string
+	// title is the heading of the overview page and termTitle the format of
+	// the heading of a term listing page.
+	title     string
+	termTitle string
+	// terms returns the terms of a post.
+	terms func(p post) []string
+	// label returns the display name of a term and intro the markdown
+	// shown under the heading of its listing page.  Both are optional.
+	label func(term string) string
+	intro func(term string) string
+}
+
+// termLabel returns the display name of a term.
+func (tx taxonomy) termLabel(term string) string {
+	if tx.label == nil {
+		return term
+	}
+	return tx.label(term)
+}
+
+var (
+	tagTaxonomy = taxonomy{
+		dir:       "tags",
+		term:      "tag",
+		title:     "Tags",
+		termTitle: "Posts tagged %q",
+		terms:     func(p post) []string { return p.tags },
+	}
+	categoryTaxonomy = taxonomy{
+		dir:       "categories",
+		term:      "category",
+		title:     "Categories",
+		termTitle: "Posts in %s",
+		terms: func(p post) []string {
+			if p.category == "" {
+				return nil
+			}
+			return []string{p.category}
+		},
+	}
+)
+
+// termURL returns the URL of the listing page of a term relative to the site
+// root.
+func (tx taxonomy) termURL(term string) string {
+	return path.Join(tx.dir, slugify(term)+".html")
+}
+
+// tagURL returns the URL of the listing page of a tag relative to the site
+// root.
+func tagURL(tag string) string {
+	return tagTaxonomy.termURL(tag)
+}
+
+// mergeTags appends the tags of b that are not in a, ignoring case.
+func mergeTags(a, b []string) []string {
+	seen := map[string]bool{}
+	for _, tag := range a {
+		seen[strings.ToLower(tag)] = true
+	}
+	for _, tag := range b {
+		if !seen[strings.ToLower(tag)] {
+			seen[strings.ToLower(tag)] = true
+			a = append(a, tag)
+		}
+	}
+	return a
+}
+
+// sameTerm reports whether two spellings of a term name the same term: they
+// differ only in case and in the spaces, dashes, and underscores between
+// words.  Other terms with the same slug, like C and C++, would share a
+// listing page.
+func sameTerm(a, b string) bool {
+	key := func(term string) string {
+		return strings.Join(strings.FieldsFunc(strings.ToLower(term), func(r rune) bool {
+			return unicode.IsSpace(r) || r == '-' || r == '_'
+		}), "-")
+	}
+	return key(a) == key(b)
+}
+
+// escapeMD escapes the characters of text that markdown would interpret,
+// for text written into generated markdown.
+func escapeMD(text string) string {
+	var escaped strings.Builder
+	for _, c := range []byte(text) {
+		if bytes.IndexByte(parser.EscapeChars, c) >= 0 {
+			escaped.WriteByte('\\')
+		}
+		escaped.WriteByte(c)
+	}
+	return escaped.String()
+}
+
+// tagLinks renders tags as comma separated markdown links to their listing
+// pages, relative to relroot.
+func tagLinks(tags []string, relroot string) string {
+	links := make([]string, len(tags))
+	for idx, tag := range tags {
+		links[idx] = fmt.Sprintf("[%s](%s)", escapeMD(tag), path.Join(relroot, tagURL(tag)))
+	}
+	return strings.Join(links, ", ")
+}
+
+// renderTaxonomyPages generates a listing page for each term of the posts,
+// under the directory of the taxonomy, and an overview page of all terms.
+func renderTaxonomyPages(tx taxonomy, posts postSet, data templateData, conf siteConfig) error {
+	tagged := map[string]postSet{}
+	// names keeps the spelling of the first use of each term
+	names := map[string]string{}
+	for _, p := range posts {
+		for _, term := range tx.terms(p) {
+			slug := slugify(term)
+			if slug == "" {
+				return fmt.Errorf("%s %q has no letters or digits for the URL of its page", tx.term, term)
+			}
+			first, ok := names[slug]
+			if !ok {
+				names[slug] = term
+				tagged[slug] = posts.WithTerm(tx, term)
+			} else if !sameTerm(first, term) {
+				return fmt.Errorf("%s %q and %q would share the page %s", tx.dir, first, term, tx.termURL(term))
+			}
+		}
+	}
+	if len(tagged) == 0 {
+		return nil
+	}
+	found := tx.dir
+	if len(tagged) == 1 {
+		found = tx.term
+	}
+	fmt.Printf(":: Found %d %s\n", len(tagged), found)
+	slugs := make([]string, 0, len(tagged))
+	for slug := range tagged {
+		slugs = append(slugs, slug)
+	}
+	sort.Strings(slugs)
+
+	templateFile := conf.listTemplate()
+	outdir := filepath.Join(conf.DestinationPath, tx.dir)
+	if err := os.MkdirAll(outdir, 0777); err != nil {
+		return fmt.Errorf("creating path %q: %w", outdir, err)
+	}
+	writeListing := func(outpath, bodystr string) error {
+		// each listing page gets its own renderer, which keeps heading IDs
+		// the same on every page
+		data.Body = template.HTML(renderBody(parseMD([]byte(bodystr)), newPageRenderer(conf), conf))
+		htmlData, err := makeHTML(data, templateFile, conf)
+		if err != nil {
+			return fmt.Errorf("making html for listing page %q: %w", outpath, err)
+		}
+		if err := os.WriteFile(outpath, htmlData, 0666); err != nil {
+			return fmt.Errorf("writing listing page %q: %w", outpath, err)
+		}
+		return nil
+	}
+
+	data.RelRoot = ".."
+	for _, slug := range slugs {
+		termURL := tx.termURL(names[slug])
+		title := escapeMD(fmt.Sprintf(tx.termTitle, tx.termLabel(names[slug])))
+		pages := paginate(tagged[slug], conf.Pagination.PageSize)
+		for idx, posts := range pages {
+			url := paginatedURL(termURL, idx+1)
+			outpath := filepath.Join(conf.DestinationPath, filepath.FromSlash(url))
+			fmt.Printf("   Saving %q: %s\n", names[slug], outpath)
+			var intro string
+			if tx.intro != nil && idx == 0 {
+				intro = tx.intro(names[slug])
+			}
+			data.Pagination, data.Canonical = listingPagination(termURL, idx+1, len(pages), conf)
+			bodystr := fmt.Sprintf("# %s\n\n%s%s%s", title, intro, postListMarkdown(posts, data.RelRoot, conf), data.Pagination.markdown())
+			if err := writeListing(outpath, bodystr); err != nil {
+				return err
+			}
+		}
+	}
+	data.Pagination, data.Canonical = pagination{}, ""
+
+	data.RelRoot = "."
+	bodystr := fmt.Sprintf("# %s\n\n", tx.title)
+	for _, slug := range slugs {
+		n := len(tagged[slug])
+		bodystr += fmt.Sprintf("- [%s](%s) (%d post%s)\n", escapeMD(tx.termLabel(names[slug])), tx.termURL(names[slug]), n, plural(n))
+	}
+	outpath := filepath.Join(conf.DestinationPath, tx.dir+".html")
+	fmt.Printf("   Saving %s overview: %s\n", tx.dir, outpath)
+	return writeListing(outpath, bodystr)
+}
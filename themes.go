@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// themeAssetsDir is the directory inside a theme holding its static assets.
+const themeAssetsDir = "assets"
+
+// themePartialsDir is the directory inside a theme holding its partial
+// templates.
+const themePartialsDir = "partials"
+
+// minifyCSS removes comments and collapses whitespace in a stylesheet.
+// Quoted strings are copied unchanged.
+func minifyCSS(src []byte) []byte {
+	// punctuation that needs no whitespace after or before it; whitespace
+	// before a colon is kept since it is significant in selectors
+	const tightAfter = "{}:;,>"
+	const tightBefore = "{};,>"
+	out := make([]byte, 0, len(src))
+	pendingSpace := false
+	emit := func(c byte) {
+		if pendingSpace && len(out) > 0 && strings.IndexByte(tightAfter, out[len(out)-1]) < 0 && strings.IndexByte(tightBefore, c) < 0 {
+			out = append(out, ' ')
+		}
+		pendingSpace = false
+		if c == '}' && len(out) > 0 && out[len(out)-1] == ';' {
+			// drop the last semicolon of a block
+			out = out[:len(out)-1]
+		}
+		out = append(out, c)
+	}
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			end := strings.Index(string(src[i+2:]), "*/")
+			if end < 0 {
+				i = len(src)
+			} else {
+				i += end + 3
+			}
+			pendingSpace = true
+		case c == '"' || c == '\'':
+			emit(c)
+			for i++; i < len(src) && src[i] != c; i++ {
+				if src[i] == '\\' && i+1 < len(src) {
+					out = append(out, src[i])
+					i++
+				}
+				out = append(out, src[i])
+			}
+			if i < len(src) {
+				out = append(out, c)
+			}
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			pendingSpace = true
+		default:
+			emit(c)
+		}
+	}
+	return out
+}
+
+// minifyJS removes indentation, trailing whitespace, and blank lines from a
+// script.  String, template, and regular expression literals and comments are
+// copied unchanged, since whitespace inside them, e.g. after a backslash
+// continuing a string on the next line, is significant.
+func minifyJS(src []byte) []byte {
+	out := make([]byte, 0, len(src))
+	lineStart := true
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case c == '\n':
+			out = bytes.TrimRight(out, " \t\r")
+			if len(out) > 0 && out[len(out)-1] != '\n' {
+				out = append(out, '\n')
+			}
+			lineStart = true
+			continue
+		case lineStart && (c == ' ' || c == '\t' || c == '\r'):
+			continue
+		}
+		lineStart = false
+		end := i + 1
+		switch {
+		case c == '"' || c == '\'' || c == '`':
+			end = jsLiteralEnd(src, i)
+		case c == '/' && i+1 < len(src) && src[i+1] == '/':
+			if end = bytes.IndexByte(src[i:], '\n'); end < 0 {
+				end = len(src)
+			} else {
+				end += i
+			}
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			if end = bytes.Index(src[i+2:], []byte("*/")); end < 0 {
+				end = len(src)
+			} else {
+				end += i + 4
+			}
+		case c == '/' && jsRegexpAllowed(out):
+			end = jsRegexpEnd(src, i)
+		}
+		out = append(out, src[i:end]...)
+		i = end - 1
+	}
+	out = bytes.TrimRight(out, " \t\r\n")
+	return append(out, '\n')
+}
+
+// jsLiteralEnd returns the index after the end of the string or template
+// literal starting at src[start].  Template literals may contain expressions
+// with literals of their own.
+func jsLiteralEnd(src []byte, start int) int {
+	quote := src[start]
+	for i := start + 1; i < len(src); i++ {
+		switch {
+		case src[i] == '\\':
+			i++
+		case src[i] == quote:
+			return i + 1
+		case quote == '`' && src[i] == '$' && i+1 < len(src) && src[i+1] == '{':
+			i = jsExprEnd(src, i+2) - 1
+		}
+	}
+	return len(src)
+}
+
+// jsExprEnd returns the index after the brace closing the expression of a
+// template literal that starts at src[start].
+func jsExprEnd(src []byte, start int) int {
+	depth := 0
+	for i := start; i < len(src); i++ {
+		switch src[i] {
+		case '"', '\'', '`':
+			i = jsLiteralEnd(src, i) - 1
+		case '{':
+			depth++
+		case '}':
+			if depth == 0 {
+				return i + 1
+			}
+			depth--
+		}
+	}
+	return len(src)
+}
+
+// jsRegexpAllowed reports whether a slash after the script so far starts a
+// regular expression literal rather than a division.
+func jsRegexpAllowed(out []byte) bool {
+	out = bytes.TrimRight(out, " \t\r\n")
+	if len(out) == 0 || bytes.HasSuffix(out, []byte("return")) || bytes.HasSuffix(out, []byte("typeof")) {
+		return true
+	}
+	return strings.IndexByte("(,=:[!&|?{};+-*%<>~^", out[len(out)-1]) >= 0
+}
+
+// jsRegexpEnd returns the index after the end of the regular expression
+// literal starting at src[start], or the end of its line if it is not closed
+// there.
+func jsRegexpEnd(src []byte, start int) int {
+	inClass := false
+	for i := start + 1; i < len(src); i++ {
+		switch src[i] {
+		case '\\':
+			i++
+		case '[':
+			inClass = true
+		case ']':
+			inClass = false
+		case '/':
+			if !inClass {
+				return i + 1
+			}
+		case '\n':
+			return i
+		}
+	}
+	return len(src)
+}
+
+// fingerprint inserts a short hash of the content into a file name, before
+// the extension.
+func fingerprint(name string, content []byte) string {
+	sum := sha256.Sum256(content)
+	ext := path.Ext(name)
+	return fmt.Sprintf("%s.%s%s", strings.TrimSuffix(name, ext), hex.EncodeToString(sum[:])[:10], ext)
+}
+
+// processThemeAssets minifies and fingerprints the files in the theme's
+// assets directory and writes them to the resource directory in the
+// destination.  Files with the same path in the site's ResourcePath override
+// the theme's files and are copied by copyResources instead.  The returned
+// manifest maps the path of each asset, relative to the assets directory, to
+// its URL relative to the site root.
+func processThemeAssets(conf siteConfig) (map[string]string, error) {
+	manifest := map[string]string{}
+	if conf.ThemePath == "" {
+		return manifest, nil
+	}
+	assetsroot := filepath.Join(conf.ThemePath, themeAssetsDir)
+	if _, err := os.Stat(assetsroot); errors.Is(err, os.ErrNotExist) {
+		return manifest, nil
+	}
+	fmt.Println(":: Processing theme assets")
+
+	walker := func(srcloc string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(assetsroot, srcloc)
+		if err != nil {
+			return err
+		}
+		relslash := filepath.ToSlash(rel)
+
+		siteloc := filepath.Join(conf.ResourcePath, rel)
+		if _, err := os.Stat(siteloc); err == nil {
+			fmt.Printf("   %s overridden by %s\n", srcloc, siteloc)
+			manifest[relslash] = path.Join(filepath.ToSlash(conf.ResourcePath), relslash)
+			return nil
+		}
+
+		content, err := os.ReadFile(srcloc)
+		if err != nil {
+			return fmt.Errorf("reading theme asset %q: %w", srcloc, err)
+		}
+		switch strings.ToLower(filepath.Ext(srcloc)) {
+		case ".css":
+			content = minifyCSS(content)
+		case ".js":
+			content = minifyJS(content)
+		}
+		outrel := path.Join(filepath.ToSlash(conf.ResourcePath), fingerprint(relslash, content))
+		dstloc := filepath.Join(conf.DestinationPath, outrel)
+		if err := os.MkdirAll(filepath.Dir(dstloc), 0777); err != nil {
+			return fmt.Errorf("creating path %q: %w", filepath.Dir(dstloc), err)
+		}
+		fmt.Printf("   %s -> %s\n", srcloc, dstloc)
+		if err := os.WriteFile(dstloc, content, 0666); err != nil {
+			return fmt.Errorf("writing theme asset %q: %w", dstloc, err)
+		}
+		manifest[relslash] = outrel
+		return nil
+	}
+	if err := filepath.Walk(assetsroot, walker); err != nil {
+		return nil, fmt.Errorf("processing theme assets: %w", err)
+	}
+	return manifest, nil
+}
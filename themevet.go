@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// runTheme runs the theme subcommands.  theme vet reports what the templates
+// and assets of a theme touch and what the template sandbox would refuse.
+func runTheme(args []string) error {
+	if len(args) == 0 || args[0] != "vet" {
+		return errors.New("usage: statiko theme vet [theme directory]")
+	}
+	flags := flag.NewFlagSet("theme vet", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: statiko theme vet [theme directory]\n\nReport what the templates and assets of a theme, ThemePath by default, touch.\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	conf, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	themePath := conf.ThemePath
+	if flags.NArg() > 0 {
+		themePath = argPath(flags.Arg(0))
+	}
+	if themePath == "" {
+		return errors.New("theme vet: no theme directory given and no ThemePath in the config")
+	}
+	if _, err := os.Stat(themePath); err != nil {
+		return fmt.Errorf("theme vet: %w", err)
+	}
+	problems, err := vetTheme(themePath, conf.Sandbox)
+	if err != nil {
+		return fmt.Errorf("theme vet: %w", err)
+	}
+	if len(problems) == 0 {
+		fmt.Println(":: No problems under the template sandbox")
+		return nil
+	}
+	fmt.Printf(":: %d problem%s under the template sandbox\n", len(problems), plural(len(problems)))
+	for _, problem := range problems {
+		fmt.Printf("   %s\n", problem)
+	}
+	return fmt.Errorf("theme vet: %d problem%s", len(problems), plural(len(problems)))
+}
+
+// vetTheme prints what the templates and assets of a theme touch and returns
+// the problems the sandbox configured by sandbox would refuse.
+func vetTheme(themePath string, sandbox sandboxConfig) ([]string, error) {
+	fmt.Printf(":: Vetting theme %s\n", themePath)
+	fmt.Println("   Templates only see the data of the page; they cannot read files or run commands")
+	var problems []string
+
+	partials, _ := filepath.Glob(filepath.Join(themePath, themePartialsDir, "*.html"))
+	fmt.Printf(":: %d template%s\n", len(partials), plural(len(partials)))
+	for _, fname := range partials {
+		fmt.Printf("   %s (as %q)\n", fname, partialName(fname))
+		if info, err := os.Lstat(fname); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			problems = append(problems, fmt.Sprintf("%s: is a symlink", fname))
+			continue
+		}
+		usage, err := inspectTemplateFile(fname)
+		if err != nil {
+			return nil, err
+		}
+		printUsage("data", usage.Fields)
+		printUsage("functions", usage.Funcs)
+		printUsage("includes", usage.Templates)
+		printUsage("hosts", usage.Hosts)
+		for _, problem := range sandbox.problems(usage) {
+			problems = append(problems, fmt.Sprintf("%s: %s", fname, problem))
+		}
+		for _, host := range usage.Hosts {
+			if !slices.Contains(sandbox.AllowedHosts, host) {
+				problems = append(problems, fmt.Sprintf("%s: links to %s, which is not in Sandbox.AllowedHosts", fname, host))
+			}
+		}
+	}
+
+	assetsroot := filepath.Join(themePath, themeAssetsDir)
+	var assets, symlinks []string
+	hosts := map[string][]string{}
+	walker := func(loc string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if entry.Type()&fs.ModeSymlink != 0 {
+			target, _ := os.Readlink(loc)
+			symlinks = append(symlinks, fmt.Sprintf("%s -> %s", loc, target))
+			return nil
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		assets = append(assets, loc)
+		var assetHosts func([]byte) []string
+		switch strings.ToLower(filepath.Ext(loc)) {
+		case ".html", ".svg":
+			assetHosts = htmlHosts
+		case ".css", ".js":
+			assetHosts = func(content []byte) []string { return urlHosts(string(content)) }
+		}
+		if assetHosts != nil {
+			content, err := os.ReadFile(loc)
+			if err != nil {
+				return err
+			}
+			for _, host := range assetHosts(content) {
+				if files := hosts[host]; len(files) == 0 || files[len(files)-1] != loc {
+					hosts[host] = append(files, loc)
+				}
+			}
+		}
+		return nil
+	}
+	if err := filepath.WalkDir(assetsroot, walker); err != nil {
+		return nil, fmt.Errorf("reading theme assets: %w", err)
+	}
+	fmt.Printf(":: %d asset%s\n", len(assets), plural(len(assets)))
+	for _, symlink := range symlinks {
+		fmt.Printf("   %s is a symlink, which is never copied\n", symlink)
+	}
+	names := make([]string, 0, len(hosts))
+	for host := range hosts {
+		names = append(names, host)
+	}
+	sort.Strings(names)
+	for _, host := range names {
+		fmt.Printf("   %s is loaded by %s\n", host, strings.Join(hosts[host], ", "))
+	}
+	return problems, nil
+}
+
+// printUsage prints a line of the usage of a template, if there is any.
+func printUsage(label string, values []string) {
+	if len(values) > 0 {
+		fmt.Printf("      %s: %s\n", label, strings.Join(values, ", "))
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// tocHeading is a heading of a page, for building tables of contents and
+// scroll-spy navigation in templates and scripts.
+type tocHeading struct {
+	// ID is the id attribute of the heading, the anchor to link to.
+	ID    string `json:"id"`
+	Level int    `json:"level"`
+	Text  string `json:"text"`
+}
+
+// collectHeadings returns the headings of a rendered document in document
+// order.  The document must be rendered first, since the renderer makes the
+// heading IDs unique.
+func collectHeadings(doc ast.Node) []tocHeading {
+	var headings []tocHeading
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		heading, ok := node.(*ast.Heading)
+		if !ok || !entering {
+			return ast.GoToNext
+		}
+		if heading.HeadingID != "" && !heading.IsTitleblock {
+			headings = append(headings, tocHeading{ID: heading.HeadingID, Level: heading.Level, Text: childLiterals(heading)})
+		}
+		return ast.SkipChildren
+	})
+	return headings
+}
+
+// tocPath returns the path of the headings file of a page: the page with the
+// .toc.json extension.
+func tocPath(outpath string) string {
+	return strings.TrimSuffix(outpath, ".html") + ".toc.json"
+}
+
+// writeTOC saves the headings of a page as JSON next to it.
+func writeTOC(outpath string, headings []tocHeading) error {
+	if headings == nil {
+		headings = []tocHeading{}
+	}
+	out, err := json.MarshalIndent(headings, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding headings of %q: %w", outpath, err)
+	}
+	tocpath := tocPath(outpath)
+	if err := os.WriteFile(tocpath, out, 0666); err != nil {
+		return fmt.Errorf("writing headings %q: %w", tocpath, err)
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// astTransform modifies a parsed markdown document in place before it is
+// rendered.
+type astTransform func(doc ast.Node)
+
+// transformConfig selects a built-in transform by name along with its
+// options.  Option names are case insensitive.
+type transformConfig struct {
+	Name    string            `mapstructure:"Name"`
+	Options map[string]string `mapstructure:"Options"`
+}
+
+type transformBuilder func(opts map[string]string) (astTransform, error)
+
+// transformBuilders maps the names of the built-in transforms to the
+// functions that configure them.
+var transformBuilders = map[string]transformBuilder{
+	"demote-headings": newDemoteHeadings,
+	"table-class":     newTableClass,
+	"link-images":     newLinkImages,
+}
+
+// buildTransforms configures the transform pipeline in the order it is
+// listed in the config.
+func buildTransforms(confs []transformConfig) ([]astTransform, error) {
+	transforms := make([]astTransform, 0, len(confs))
+	for _, tc := range confs {
+		builder, ok := transformBuilders[tc.Name]
+		if !ok {
+			names := make([]string, 0, len(transformBuilders))
+			for name := range transformBuilders {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("unknown transform %q (available: %s)", tc.Name, strings.Join(names, ", "))
+		}
+		opts := make(map[string]string, len(tc.Options))
+		for k, v := range tc.Options {
+			opts[strings.ToLower(k)] = v
+		}
+		transform, err := builder(opts)
+		if err != nil {
+			return nil, fmt.Errorf("configuring transform %q: %w", tc.Name, err)
+		}
+		transforms = append(transforms, transform)
+	}
+	return transforms, nil
+}
+
+func applyTransforms(doc ast.Node, transforms []astTransform) {
+	for _, transform := range transforms {
+		transform(doc)
+	}
+}
+
+// replaceNode puts the given nodes in the place of old in old's parent.
+func replaceNode(old ast.Node, nodes ...ast.Node) {
+	parent := old.GetParent()
+	var children []ast.Node
+	for _, child := range parent.GetChildren() {
+		if child == old {
+			children = append(children, nodes...)
+			continue
+		}
+		children = append(children, child)
+	}
+	parent.SetChildren(children)
+	for _, node := range nodes {
+		node.SetParent(parent)
+	}
+	old.SetParent(nil)
+}
+
+// cloneNode returns a deep copy of node and its children, without a parent,
+// for putting the same content in more than one place of a document.
+func cloneNode(node ast.Node) ast.Node {
+	orig := reflect.ValueOf(node).Elem()
+	copied := reflect.New(orig.Type())
+	copied.Elem().Set(orig)
+	clone := copied.Interface().(ast.Node)
+	clone.SetParent(nil)
+	if children := node.GetChildren(); len(children) > 0 {
+		cloned := make([]ast.Node, len(children))
+		for idx, child := range children {
+			cloned[idx] = cloneNode(child)
+			cloned[idx].SetParent(clone)
+		}
+		clone.SetChildren(cloned)
+	}
+	return clone
+}
+
+// newDemoteHeadings increases the level of every heading by the "levels"
+// option (default 1), capped at level 6.
+func newDemoteHeadings(opts map[string]string) (astTransform, error) {
+	levels := 1
+	if lvlstr, ok := opts["levels"]; ok {
+		var err error
+		if levels, err = strconv.Atoi(lvlstr); err != nil {
+			return nil, fmt.Errorf("invalid levels %q: %w", lvlstr, err)
+		}
+	}
+	return func(doc ast.Node) {
+		visitor := func(node ast.Node, entering bool) ast.WalkStatus {
+			if heading, ok := node.(*ast.Heading); ok && entering {
+				heading.Level = min(max(heading.Level+levels, 1), 6)
+			}
+			return ast.GoToNext
+		}
+		ast.WalkFunc(doc, visitor)
+	}, nil
+}
+
+// newTableClass adds the class given by the "class" option to every table.
+func newTableClass(opts map[string]string) (astTransform, error) {
+	class := opts["class"]
+	if class == "" {
+		return nil, fmt.Errorf("missing class option")
+	}
+	return func(doc ast.Node) {
+		visitor := func(node ast.Node, entering bool) ast.WalkStatus {
+			if table, ok := node.(*ast.Table); ok && entering {
+				if table.Attribute == nil {
+					table.Attribute = &ast.Attribute{}
+				}
+				table.Classes = append(table.Classes, []byte(class))
+			}
+			return ast.GoToNext
+		}
+		ast.WalkFunc(doc, visitor)
+	}, nil
+}
+
+// newLinkImages wraps every image that is not already inside a link with a
+// link to the image itself.
+func newLinkImages(_ map[string]string) (astTransform, error) {
+	return func(doc ast.Node) {
+		var images []*ast.Image
+		visitor := func(node ast.Node, entering bool) ast.WalkStatus {
+			if img, ok := node.(*ast.Image); ok && entering {
+				if _, inLink := img.GetParent().(*ast.Link); !inLink {
+					images = append(images, img)
+				}
+			}
+			return ast.GoToNext
+		}
+		ast.WalkFunc(doc, visitor)
+
+		// modify the tree after walking it
+		for _, img := range images {
+			link := &ast.Link{Destination: img.Destination}
+			replaceNode(img, link)
+			link.SetChildren([]ast.Node{img})
+			img.SetParent(link)
+		}
+	}, nil
+}
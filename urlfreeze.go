@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// URL freeze modes.
+const (
+	urlFreezeWarn = "warn"
+	urlFreezeFail = "fail"
+)
+
+// urlFreezeConfig configures the check that the URLs of published pages keep
+// working: a page URL that was published for long enough must not disappear
+// from a build unless a redirect covers it.
+type urlFreezeConfig struct {
+	// Mode is "warn", which reports the removed URLs, or "fail", which also
+	// fails the build.  Empty disables the check.
+	Mode string `mapstructure:"Mode"`
+	// Days is the number of days since a URL first appeared in a build
+	// after which it is frozen.  Zero freezes every URL of a build.
+	Days int `mapstructure:"Days"`
+}
+
+func (c urlFreezeConfig) validate(storage storageConfig) error {
+	switch c.Mode {
+	case "":
+		return nil
+	case urlFreezeWarn, urlFreezeFail:
+	default:
+		return fmt.Errorf("invalid URL freeze mode %q (must be %q or %q)", c.Mode, urlFreezeWarn, urlFreezeFail)
+	}
+	if c.Days < 0 {
+		return fmt.Errorf("invalid URL freeze days %d", c.Days)
+	}
+	if storage.Backend == "" {
+		return fmt.Errorf("URL freeze requires a storage backend for its manifest")
+	}
+	return nil
+}
+
+// urlManifestName is the name of the manifest of the published page URLs in
+// the build store.  It maps the URLs, as paths relative to the destination,
+// to the time of the first build they appeared in.
+const urlManifestName = "url-manifest.json"
+
+// redirected reports whether a redirect covers a page URL, given as a path
+// relative to the destination.  Redirects may refer to pages with or without
+// their .html extension, or to the directories of index pages.
+func redirected(url string, redirects []redirect) bool {
+	candidates := []string{url, strings.TrimSuffix(url, ".html")}
+	if path.Base(url) == "index.html" {
+		dir := strings.TrimSuffix(url, "index.html")
+		candidates = append(candidates, dir, strings.TrimSuffix(dir, "/"))
+	}
+	for _, r := range redirects {
+		from := strings.TrimPrefix(r.From, "/")
+		if prefix, ok := strings.CutSuffix(from, "*"); ok {
+			if strings.HasPrefix(url, prefix) {
+				return true
+			}
+			continue
+		}
+		for _, candidate := range candidates {
+			if from == candidate {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkFrozenURLs compares the URLs of the pages rendered by a build with the
+// URL manifest of the previous builds and reports the frozen URLs that
+// disappeared without a redirect.  The files in the destination are not
+// used, since pages removed from the site leave their files behind.  In fail
+// mode the build fails and the manifest is left as it was, so the check fails
+// until the URLs are restored or redirected.
+// Removed URLs that are not frozen yet are dropped from the manifest.
+func checkFrozenURLs(store buildStore, pages []string, conf siteConfig, now time.Time) error {
+	if conf.URLFreeze.Mode == "" {
+		return nil
+	}
+	published := map[string]time.Time{}
+	data, err := store.Load(urlManifestName)
+	if err != nil {
+		return fmt.Errorf("loading URL manifest: %w", err)
+	}
+	if data != nil {
+		if err := json.Unmarshal(data, &published); err != nil {
+			return fmt.Errorf("loading URL manifest: %w", err)
+		}
+	}
+	rendered := make(map[string]bool, len(pages))
+	for _, url := range pages {
+		rendered[url] = true
+	}
+
+	frozenAge := time.Duration(conf.URLFreeze.Days) * 24 * time.Hour
+	var removed []string
+	for url, first := range published {
+		if rendered[url] {
+			continue
+		}
+		if now.Sub(first) < frozenAge || redirected(url, conf.Redirects) {
+			delete(published, url)
+			continue
+		}
+		removed = append(removed, url)
+	}
+	for _, url := range pages {
+		if _, ok := published[url]; !ok {
+			published[url] = now.UTC().Truncate(time.Second)
+		}
+	}
+
+	sort.Strings(removed)
+	for _, url := range removed {
+		fmt.Fprintf(os.Stderr, "warning: %s was published on %s and removed without a redirect\n", url, published[url].Format("2006-01-02"))
+	}
+	if len(removed) > 0 && conf.URLFreeze.Mode == urlFreezeFail {
+		return fmt.Errorf("%d frozen URL%s removed without a redirect", len(removed), plural(len(removed)))
+	}
+	if data, err = json.MarshalIndent(published, "", "  "); err != nil {
+		return fmt.Errorf("saving URL manifest: %w", err)
+	}
+	if err := store.Save(urlManifestName, data); err != nil {
+		return fmt.Errorf("saving URL manifest: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// variantOpenRe and variantCloseRe match the tags of a content variant
+// block:
+//
+//	{{< variant "name" >}}
+//	content
+//	{{< /variant >}}
+var (
+	variantOpenRe  = regexp.MustCompile(`{{<\s*variant\s+"([^"]+)"\s*>}}\n?`)
+	variantCloseRe = regexp.MustCompile(`{{<\s*/variant\s*>}}\n?`)
+)
+
+// variantBlock is a content variant block of a page source: md[start:end],
+// with its content at md[inner[0]:inner[1]].
+type variantBlock struct {
+	name       string
+	start, end int
+	inner      [2]int
+}
+
+// variantBlocks returns the content variant blocks of a page source.  Tags
+// in fenced code blocks and code spans are left unchanged, so that pages can
+// show their syntax.
+func variantBlocks(md []byte) []variantBlock {
+	ranges := codeRanges(md)
+	var blocks []variantBlock
+	cursor := 0
+	for cursor < len(md) {
+		open := variantOpenRe.FindSubmatchIndex(md[cursor:])
+		if open == nil {
+			break
+		}
+		block := variantBlock{name: string(md[cursor+open[2] : cursor+open[3]]), start: cursor + open[0]}
+		innerStart := cursor + open[1]
+		cursor = innerStart
+		if inCode(ranges, block.start, innerStart) {
+			continue
+		}
+		for _, closing := range variantCloseRe.FindAllIndex(md[innerStart:], -1) {
+			if !inCode(ranges, innerStart+closing[0], innerStart+closing[1]) {
+				block.inner = [2]int{innerStart, innerStart + closing[0]}
+				block.end = innerStart + closing[1]
+				break
+			}
+		}
+		if block.end == 0 {
+			// unclosed blocks are not variants
+			break
+		}
+		blocks = append(blocks, block)
+		cursor = block.end
+	}
+	return blocks
+}
+
+// pageVariants returns the names of the content variants of a page source in
+// order of first appearance.  Names whose variant pages would have the same
+// path are rejected.
+func pageVariants(md []byte) ([]string, error) {
+	var names []string
+	seen := map[string]bool{}
+	slugs := map[string]string{}
+	for _, block := range variantBlocks(md) {
+		if seen[block.name] {
+			continue
+		}
+		slug := slugify(block.name)
+		if slug == "" {
+			return nil, fmt.Errorf("variant %q has no letters or digits for its path", block.name)
+		}
+		if other, exists := slugs[slug]; exists {
+			return nil, fmt.Errorf("variants %q and %q have the same path", other, block.name)
+		}
+		seen[block.name] = true
+		slugs[slug] = block.name
+		names = append(names, block.name)
+	}
+	return names, nil
+}
+
+// controlVariant returns the variant shown on the canonical page: the first
+// one defined.
+func controlVariant(variants []string) string {
+	if len(variants) == 0 {
+		return ""
+	}
+	return variants[0]
+}
+
+// selectVariant keeps the contents of the blocks of the given variant and
+// removes the blocks of all other variants.
+func selectVariant(md []byte, variant string) []byte {
+	var out bytes.Buffer
+	cursor := 0
+	for _, block := range variantBlocks(md) {
+		out.Write(md[cursor:block.start])
+		if block.name == variant {
+			out.Write(md[block.inner[0]:block.inner[1]])
+		}
+		cursor = block.end
+	}
+	out.Write(md[cursor:])
+	return out.Bytes()
+}
+
+// variantPath returns the output path of a variant of a page: the variant
+// name is inserted before the extension.
+func variantPath(outpath, variant string) string {
+	ext := filepath.Ext(outpath)
+	return fmt.Sprintf("%s.%s%s", strings.TrimSuffix(outpath, ext), slugify(variant), ext)
+}
+
+// writeVariantMap saves the mapping of pages to the URLs of their variants,
+// for edge routers that split traffic between them.
+func writeVariantMap(variants map[string]map[string]string, conf siteConfig) error {
+	if len(variants) == 0 {
+		return nil
+	}
+	out, err := json.MarshalIndent(variants, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding variant map: %w", err)
+	}
+	outpath := filepath.Join(conf.DestinationPath, conf.VariantsOutput)
+	if err := os.MkdirAll(filepath.Dir(outpath), 0777); err != nil {
+		return fmt.Errorf("creating path %q: %w", filepath.Dir(outpath), err)
+	}
+	fmt.Printf("   Saving variant map: %s\n", outpath)
+	if err := os.WriteFile(outpath, out, 0666); err != nil {
+		return fmt.Errorf("writing variant map %q: %w", outpath, err)
+	}
+	return nil
+}
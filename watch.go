@@ -0,0 +1,248 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+// watchDebounce is how long the watcher waits for further changes before
+// rebuilding, so that a burst of writes (e.g. an editor saving several files)
+// triggers a single rebuild.
+const watchDebounce = 200 * time.Millisecond
+
+// changeKind classifies a changed file by the part of the build it
+// invalidates.
+type changeKind uint8
+
+const (
+	changeContent changeKind = 1 << iota
+	changeResources
+	changeConfig
+	changeTheme
+)
+
+// absPath returns the absolute form of p, or p cleaned if it cannot be
+// resolved.
+func absPath(p string) string {
+	if ap, err := filepath.Abs(p); err == nil {
+		return ap
+	}
+	return filepath.Clean(p)
+}
+
+// isUnder reports whether p is the directory dir or a path under it.  Both
+// paths must be absolute.
+func isUnder(p, dir string) bool {
+	return p == dir || strings.HasPrefix(p, dir+string(filepath.Separator))
+}
+
+// siteWatcher tracks the files that make up a site and rebuilds the parts of
+// the site affected by changes to them.
+type siteWatcher struct {
+	watcher    *fsnotify.Watcher
+	conf       siteConfig
+	configFile string
+}
+
+// addTree adds watches for the directory root and all its subdirectories.
+func (sw *siteWatcher) addTree(root string) error {
+	walker := func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return sw.watcher.Add(path)
+		}
+		return nil
+	}
+	return filepath.Walk(root, walker)
+}
+
+// resetWatches removes all existing watches and adds watches for the paths
+// in the current configuration.  The config and template files are watched
+// through their parent directories, since many editors save files by
+// replacing them, which drops watches on the files themselves.
+func (sw *siteWatcher) resetWatches() error {
+	for _, p := range sw.watcher.WatchList() {
+		_ = sw.watcher.Remove(p)
+	}
+	for _, root := range []string{sw.conf.SourcePath, sw.conf.ResourcePath, sw.conf.ThemePath, sw.conf.BundlePath, sw.conf.ShortcodePath, sw.conf.PartialsPath} {
+		if root == "" {
+			continue
+		}
+		if _, err := os.Stat(root); err != nil {
+			continue
+		}
+		if err := sw.addTree(root); err != nil {
+			return fmt.Errorf("watching %q: %w", root, err)
+		}
+	}
+	for _, fname := range append(sw.conf.templateFiles(), sw.configFile) {
+		if fname == "" {
+			continue
+		}
+		dir := filepath.Dir(fname)
+		if err := sw.watcher.Add(dir); err != nil {
+			return fmt.Errorf("watching %q: %w", dir, err)
+		}
+	}
+	return nil
+}
+
+// classify returns the kind of change an event on the given path represents.
+func (sw *siteWatcher) classify(name string) changeKind {
+	p := absPath(name)
+	switch {
+	case sw.configFile != "" && p == absPath(sw.configFile):
+		return changeConfig
+	case sw.configFile != "" && configEnv != "" && p == absPath(configOverlayPath(sw.configFile)):
+		return changeConfig
+	case isUnder(p, absPath(sw.conf.DestinationPath)):
+		// never react to our own output
+		return 0
+	case isUnder(p, absPath(sw.conf.SourcePath)):
+		return changeContent
+	case sw.conf.BundlePath != "" && isUnder(p, absPath(sw.conf.BundlePath)):
+		// bundles are written when the pages using them are rendered
+		return changeContent
+	case sw.conf.ShortcodePath != "" && isUnder(p, absPath(sw.conf.ShortcodePath)):
+		return changeContent
+	}
+	for _, fname := range sw.conf.templateFiles() {
+		if p == absPath(fname) {
+			// templates are used by both pages and resource indexes
+			return changeContent | changeResources
+		}
+	}
+	if isUnder(p, absPath(sw.conf.ResourcePath)) {
+		// resources can override theme assets
+		return changeResources | changeTheme
+	}
+	if sw.conf.ThemePath != "" && isUnder(p, absPath(sw.conf.ThemePath)) {
+		return changeTheme
+	}
+	return 0
+}
+
+// rebuild reloads the configuration if it changed and rebuilds the parts of
+// the site invalidated by the accumulated changes.
+func (sw *siteWatcher) rebuild(changes changeKind) error {
+	// wait for builds started outside the watcher, e.g. by cron
+	lock, err := lockDestination(sw.conf, true)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+
+	if changes&changeConfig != 0 {
+		fmt.Printf(":: Reloading config %s\n", sw.configFile)
+		conf, err := loadConfig()
+		if err != nil {
+			// keep the previous configuration until the file is fixed
+			return err
+		}
+		sw.conf = conf
+		if err := sw.resetWatches(); err != nil {
+			return err
+		}
+		return buildSite(&sw.conf)
+	}
+	if changes&changeTheme != 0 && sw.conf.ThemePath != "" {
+		// asset fingerprints end up in every page
+		return buildSite(&sw.conf)
+	}
+	if sw.conf.CSSPruning.Enabled || len(sw.conf.Fonts.Files) > 0 {
+		// pruning and font subsetting depend on every page, and pruning
+		// needs fresh copies of the stylesheets
+		return buildSite(&sw.conf)
+	}
+	if changes&changeContent != 0 {
+		// builds while watching are not published, so the rendered URLs
+		// are not collected for the URL freeze check
+		sw.conf.rendered = nil
+		if err := buildContent(sw.conf); err != nil {
+			return err
+		}
+	}
+	if changes&changeResources != 0 {
+		if err := buildResources(sw.conf); err != nil {
+			return err
+		}
+	}
+	// partial rebuilds can add and remove files
+	if err := writeSitemap(sw.conf); err != nil {
+		return err
+	}
+	return writeCacheManifest(sw.conf)
+}
+
+// watchSite watches the site sources, templates, resources, and config file
+// and rebuilds the site when they change.  onRebuild, if not nil, is called
+// after each successful rebuild, and metrics, if not nil, records each
+// rebuild.  It runs until the watcher fails.
+func watchSite(conf siteConfig, onRebuild func(), metrics *buildMetrics) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("starting watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	sw := &siteWatcher{
+		watcher:    watcher,
+		conf:       conf,
+		configFile: viper.ConfigFileUsed(),
+	}
+	if err := sw.resetWatches(); err != nil {
+		return err
+	}
+	fmt.Println(":: Watching for changes (press Ctrl+C to stop)")
+
+	var pending changeKind
+	timer := time.NewTimer(watchDebounce)
+	timer.Stop()
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			kind := sw.classify(event.Name)
+			if kind == 0 {
+				continue
+			}
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if err := sw.addTree(event.Name); err != nil {
+						fmt.Fprintf(os.Stderr, "error: watching %q: %v\n", event.Name, err)
+					}
+				}
+			}
+			pending |= kind
+			timer.Reset(watchDebounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			fmt.Fprintf(os.Stderr, "error: watcher: %v\n", err)
+		case <-timer.C:
+			start := time.Now()
+			err := sw.rebuild(pending)
+			metrics.record(start, err)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			} else if onRebuild != nil {
+				onRebuild()
+			}
+			pending = 0
+		}
+	}
+}
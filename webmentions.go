@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// webmentionAuthor is the h-card of the author of a webmention.
+type webmentionAuthor struct {
+	Name  string `json:"name"`
+	Photo string `json:"photo"`
+	URL   string `json:"url"`
+}
+
+type webmentionContent struct {
+	Text string `json:"text"`
+}
+
+// webmention is an entry of a webmention.io JSON feed.  Only the fields
+// rendered on posts are decoded.
+type webmention struct {
+	Author    webmentionAuthor  `json:"author"`
+	URL       string            `json:"url"`
+	Published string            `json:"published"`
+	Content   webmentionContent `json:"content"`
+	// Target is the URL of the page the webmention is about and Property
+	// its kind, e.g. like-of or in-reply-to.
+	Target   string `json:"wm-target"`
+	Property string `json:"wm-property"`
+	Private  bool   `json:"wm-private"`
+}
+
+// Date returns the publication date of the webmention, formatted like post
+// dates, or as given if it cannot be parsed.
+func (wm webmention) Date() string {
+	published, err := time.Parse(time.RFC3339, wm.Published)
+	if err != nil {
+		return wm.Published
+	}
+	return published.Format("02 Jan 2006")
+}
+
+type webmentionFeed struct {
+	Children []webmention `json:"children"`
+}
+
+// pageMentions holds the webmentions of a page by kind.  Replies include
+// mentions, and are ordered by date.
+type pageMentions struct {
+	Likes   []webmention
+	Reposts []webmention
+	Replies []webmention
+}
+
+func (pm pageMentions) empty() bool {
+	return len(pm.Likes)+len(pm.Reposts)+len(pm.Replies) == 0
+}
+
+// loadWebmentions reads the webmention.io JSON dump of WebmentionsFile and
+// groups the public webmentions by the URL of their target page.
+func loadWebmentions(conf siteConfig) (map[string]pageMentions, error) {
+	if conf.WebmentionsFile == "" {
+		return nil, nil
+	}
+	content, err := os.ReadFile(conf.WebmentionsFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading webmentions %q: %w", conf.WebmentionsFile, err)
+	}
+	var feed webmentionFeed
+	if err := json.Unmarshal(content, &feed); err != nil {
+		return nil, fmt.Errorf("reading webmentions %q: %w", conf.WebmentionsFile, err)
+	}
+	mentions := map[string]pageMentions{}
+	for _, wm := range feed.Children {
+		if wm.Private {
+			continue
+		}
+		url := conf.pageURLOf(wm.Target)
+		pm := mentions[url]
+		switch wm.Property {
+		case "like-of":
+			pm.Likes = append(pm.Likes, wm)
+		case "repost-of":
+			pm.Reposts = append(pm.Reposts, wm)
+		case "in-reply-to", "mention-of":
+			pm.Replies = append(pm.Replies, wm)
+		default:
+			continue
+		}
+		mentions[url] = pm
+	}
+	for _, pm := range mentions {
+		sort.SliceStable(pm.Replies, func(i, j int) bool { return pm.Replies[i].Published < pm.Replies[j].Published })
+	}
+	return mentions, nil
+}
+
+const webmentionsHTML = `<section class="webmentions">
+{{- define "author"}}
+{{- if .Photo}}<img src="{{.Photo}}" alt="" width="32" height="32" loading="lazy"> {{end}}
+{{- if .URL}}<a href="{{.URL}}">{{.Name}}</a>{{else}}{{.Name}}{{end}}
+{{- end}}
+{{- if .Likes}}
+<h2>{{len .Likes}} like{{if gt (len .Likes) 1}}s{{end}}</h2>
+<ul class="webmention-likes">
+{{- range .Likes}}
+<li>{{template "author" .Author}}</li>
+{{- end}}
+</ul>
+{{- end}}
+{{- if .Reposts}}
+<h2>{{len .Reposts}} repost{{if gt (len .Reposts) 1}}s{{end}}</h2>
+<ul class="webmention-reposts">
+{{- range .Reposts}}
+<li>{{template "author" .Author}}</li>
+{{- end}}
+</ul>
+{{- end}}
+{{- if .Replies}}
+<h2>Replies</h2>
+<ol class="webmention-replies">
+{{- range .Replies}}
+<li><p>{{template "author" .Author}}{{if .URL}} <a href="{{.URL}}">{{.Date}}</a>{{end}}</p>
+{{- if .Content.Text}}
+<p>{{.Content.Text}}</p>
+{{- end}}
+</li>
+{{- end}}
+</ol>
+{{- end}}
+</section>`
+
+var webmentionsTemplate = template.Must(template.New("webmentions").Parse(webmentionsHTML))
+
+// renderWebmentions renders the likes, reposts, and replies of a page.
+func renderWebmentions(pm pageMentions) ([]byte, error) {
+	out := new(bytes.Buffer)
+	if err := webmentionsTemplate.Execute(out, pm); err != nil {
+		return nil, fmt.Errorf("rendering webmentions: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+// addWebmentions appends the rendered webmentions of a post to its document.
+func addWebmentions(doc ast.Node, rendered []byte) {
+	ast.AppendChild(doc, &ast.HTMLBlock{Leaf: ast.Leaf{Literal: rendered}})
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// workspaceConfig configures where intermediate files, such as the temporary
+// builds of the clean and test commands, are written.
+type workspaceConfig struct {
+	// Path is the directory holding the workspaces of running commands.
+	// Empty uses the temporary directory of the system.
+	Path string `mapstructure:"Path"`
+	// MaxSize is the size in megabytes that the workspaces under Path may
+	// take together.  Zero disables the limit.
+	MaxSize int `mapstructure:"MaxSize"`
+}
+
+func (c workspaceConfig) validate() error {
+	if c.MaxSize < 0 {
+		return fmt.Errorf("invalid workspace size limit %d", c.MaxSize)
+	}
+	return nil
+}
+
+// workspacePrefix starts the names of the workspace directories.  Each has a
+// lock file with the same name and the .lock extension, held while the
+// workspace is in use.
+const workspacePrefix = "statiko-"
+
+// workspace is the private directory of intermediate files of a command.
+// Concurrent commands get separate workspaces, and the workspaces of commands
+// that died are removed by the next command that opens one.
+type workspace struct {
+	dir   string
+	lock  *os.File
+	limit int64
+	root  string
+}
+
+// openWorkspace creates a workspace under the configured path, after
+// removing the workspaces left behind by commands that no longer run.
+func openWorkspace(conf siteConfig) (*workspace, error) {
+	root := conf.Workspace.Path
+	if root == "" {
+		root = os.TempDir()
+	}
+	if err := os.MkdirAll(root, 0777); err != nil {
+		return nil, fmt.Errorf("creating workspace path %q: %w", root, err)
+	}
+	removeStaleWorkspaces(root)
+	dir, err := os.MkdirTemp(root, workspacePrefix)
+	if err != nil {
+		return nil, fmt.Errorf("creating workspace: %w", err)
+	}
+	lock, err := os.OpenFile(dir+".lock", os.O_RDWR|os.O_CREATE, 0666)
+	if err == nil {
+		err = lockFile(lock, false)
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("locking workspace %q: %w", dir, err)
+	}
+	ws := &workspace{dir: dir, lock: lock, limit: int64(conf.Workspace.MaxSize) << 20, root: root}
+	if err := ws.checkSize(); err != nil {
+		ws.close()
+		return nil, err
+	}
+	return ws, nil
+}
+
+// staleAge is the age after which the lock file of a workspace that is not
+// locked is stale.  Younger lock files may belong to a workspace that is
+// being opened.
+const staleAge = time.Minute
+
+// removeStaleWorkspaces removes the workspaces under root whose lock is not
+// held.  With the lock emulation of platforms without file locks, the
+// workspaces of commands that died are kept until removed by hand.
+func removeStaleWorkspaces(root string) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		lockname, ok := strings.CutSuffix(entry.Name(), ".lock")
+		if !ok || !strings.HasPrefix(lockname, workspacePrefix) {
+			continue
+		}
+		if info, err := entry.Info(); err != nil || time.Since(info.ModTime()) < staleAge {
+			continue
+		}
+		lockpath := filepath.Join(root, entry.Name())
+		lock, err := os.OpenFile(lockpath, os.O_RDWR, 0666)
+		if err != nil {
+			continue
+		}
+		if err := lockFile(lock, false); err != nil {
+			lock.Close()
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(root, lockname)); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: removing stale workspace: %v\n", err)
+		}
+		unlockFile(lock)
+		lock.Close()
+		os.Remove(lockpath)
+	}
+}
+
+// checkSize fails if the workspaces under the workspace path take more than
+// the size limit.
+func (ws *workspace) checkSize() error {
+	if ws.limit == 0 {
+		return nil
+	}
+	entries, err := os.ReadDir(ws.root)
+	if err != nil {
+		return fmt.Errorf("measuring workspaces in %q: %w", ws.root, err)
+	}
+	var size int64
+	walker := func(loc string, info os.FileInfo, err error) error {
+		// other workspaces may be removed while walking them
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), workspacePrefix) {
+			continue
+		}
+		if err := filepath.Walk(filepath.Join(ws.root, entry.Name()), walker); err != nil {
+			return fmt.Errorf("measuring workspaces in %q: %w", ws.root, err)
+		}
+	}
+	if size > ws.limit {
+		return fmt.Errorf("workspaces in %q take %.1f MB, more than the limit of %d MB", ws.root, float64(size)/(1<<20), ws.limit>>20)
+	}
+	return nil
+}
+
+// mkdirTemp creates a new directory in the workspace, like os.MkdirTemp.
+func (ws *workspace) mkdirTemp(pattern string) (string, error) {
+	if err := ws.checkSize(); err != nil {
+		return "", err
+	}
+	return os.MkdirTemp(ws.dir, pattern)
+}
+
+// createTemp creates a new file in the workspace, like os.CreateTemp.
+func (ws *workspace) createTemp(pattern string) (*os.File, error) {
+	if err := ws.checkSize(); err != nil {
+		return nil, err
+	}
+	return os.CreateTemp(ws.dir, pattern)
+}
+
+// close removes the workspace and its intermediate files.
+func (ws *workspace) close() {
+	if err := os.RemoveAll(ws.dir); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: removing workspace: %v\n", err)
+	}
+	if err := unlockFile(ws.lock); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: releasing workspace lock: %v\n", err)
+	}
+	ws.lock.Close()
+	os.Remove(ws.lock.Name())
+}